@@ -79,10 +79,21 @@ var (
 	indexHTMLSuffix     = indexHTMLCmd.Flag("suffix", "Suffix of files").String()
 	indexHTMLDest       = indexHTMLCmd.Flag("dest", "Write to file").String()
 	indexHTMLUpload     = indexHTMLCmd.Flag("upload", "Upload to S3").String()
+	indexHTMLSidecars   = indexHTMLCmd.Flag("meta-sidecars", "Read version info from .meta.json sidecars").Bool()
+	indexHTMLObjectMeta = indexHTMLCmd.Flag("object-metadata", "Read version info from object metadata (a HEAD per release)").Bool()
+	indexHTMLPublicURL  = indexHTMLCmd.Flag("public-base-url", "Link to releases on this host (CDN) instead of S3").String()
+	indexHTMLManifest   = indexHTMLCmd.Flag("manifest", "Update incrementally from (and save) this manifest").String()
+	indexHTMLCommitLen  = indexHTMLCmd.Flag("commit-length", "Characters of the commit to show").Default("7").Int()
+	indexHTMLSafe       = indexHTMLCmd.Flag("safe-overwrite", "Only overwrite a previously generated index").Bool()
+	indexHTMLQRCodes    = indexHTMLCmd.Flag("qr-codes", "Show each platform's latest download URL with a QR code").Bool()
 
 	parseVersionCmd    = app.Command("version-parse", "Parse a sematic version string")
 	parseVersionString = parseVersionCmd.Arg("version", "Semantic version to parse").Required().String()
 
+	validateNameCmd        = app.Command("version-validate", "Check a release file name parses, before it's uploaded")
+	validateNameName       = validateNameCmd.Arg("name", "Release file name").Required().String()
+	validateNameDateLayout = validateNameCmd.Flag("date-layout", "Time layout of the date in the name, if it isn't like 20160312013917").String()
+
 	promoteReleasesCmd        = app.Command("promote-releases", "Promote releases")
 	promoteReleasesBucketName = promoteReleasesCmd.Flag("bucket-name", "Bucket name to use").Required().String()
 	promoteReleasesPlatform   = promoteReleasesCmd.Flag("platform", "Platform (darwin, linux, windows)").Required().String()
@@ -103,6 +114,17 @@ var (
 	promoteTestReleasesPlatform   = promoteTestReleasesCmd.Flag("platform", "Platform (darwin, linux, windows)").Required().String()
 	promoteTestReleasesRelease    = promoteTestReleasesCmd.Flag("release", "Specific release to promote to test").String()
 
+	promotePolicyCmd        = app.Command("promote-policy", "Run the promotions in a policy file")
+	promotePolicyBucketName = promotePolicyCmd.Flag("bucket-name", "Bucket name to use").Required().String()
+	promotePolicyPath       = promotePolicyCmd.Flag("policy", "Policy file (JSON), instead of the bucket's release-config.json").ExistingFile()
+	promotePolicyPromotedBy = promotePolicyCmd.Flag("promoted-by", "Who (or what) is promoting, stamped into the promoted update JSONs").String()
+
+	ensureACLCmd        = app.Command("ensure-acl", "Check (and fix) the ACL of the objects at a prefix")
+	ensureACLBucketName = ensureACLCmd.Flag("bucket-name", "Bucket name to use").Required().String()
+	ensureACLPrefix     = ensureACLCmd.Flag("prefix", "Prefix to check").Required().String()
+	ensureACLACL        = ensureACLCmd.Flag("acl", "Expected canned ACL (public-read, private)").Default("public-read").String()
+	ensureACLFix        = ensureACLCmd.Flag("fix", "Apply the ACL to objects that don't have it").Bool()
+
 	updatesReportCmd        = app.Command("updates-report", "Summary of updates/releases")
 	updatesReportBucketName = updatesReportCmd.Flag("bucket-name", "Bucket name to use").Required().String()
 
@@ -198,7 +220,21 @@ func main() {
 		}
 		fmt.Fprintf(os.Stdout, "%s\n", out)
 	case indexHTMLCmd.FullCommand():
-		err := update.WriteHTML(*indexHTMLBucketName, *indexHTMLPrefixes, *indexHTMLSuffix, *indexHTMLDest, *indexHTMLUpload)
+		client, err := update.NewClient()
+		if err != nil {
+			log.Fatal(err)
+		}
+		client.MetaSidecars = *indexHTMLSidecars
+		client.ObjectMetadata = *indexHTMLObjectMeta
+		client.PublicBaseURL = *indexHTMLPublicURL
+		client.CommitLength = *indexHTMLCommitLen
+		client.SafeOverwrite = *indexHTMLSafe
+		client.HTMLQRCodes = *indexHTMLQRCodes
+		if *indexHTMLManifest != "" {
+			err = client.WriteHTMLIncremental(*indexHTMLBucketName, *indexHTMLPrefixes, *indexHTMLSuffix, *indexHTMLManifest, *indexHTMLDest, *indexHTMLUpload)
+		} else {
+			err = client.WriteHTML(*indexHTMLBucketName, *indexHTMLPrefixes, *indexHTMLSuffix, *indexHTMLDest, *indexHTMLUpload)
+		}
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -211,6 +247,10 @@ func main() {
 		log.Printf("%s\n", versionShort)
 		log.Printf("%s\n", date)
 		log.Printf("%s\n", commit)
+	case validateNameCmd.FullCommand():
+		if err := (version.Parser{DateLayout: *validateNameDateLayout}).Validate(*validateNameName); err != nil {
+			log.Fatal(err)
+		}
 	case promoteReleasesCmd.FullCommand():
 		const dryRun bool = false
 		release, err := update.PromoteReleases(*promoteReleasesBucketName, *promoteReleasesPlatform)
@@ -252,6 +292,33 @@ func main() {
 		if err != nil {
 			log.Fatal(err)
 		}
+	case promotePolicyCmd.FullCommand():
+		client, err := update.NewClient()
+		if err != nil {
+			log.Fatal(err)
+		}
+		client.PromotedBy = *promotePolicyPromotedBy
+		results, err := client.PromoteFromPolicy(*promotePolicyBucketName, *promotePolicyPath)
+		for _, result := range results {
+			if jsonErr := result.WriteJSON(os.Stdout); jsonErr != nil {
+				log.Fatal(jsonErr)
+			}
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	case ensureACLCmd.FullCommand():
+		client, err := update.NewClient()
+		if err != nil {
+			log.Fatal(err)
+		}
+		drifted, err := client.EnsureACL(*ensureACLBucketName, *ensureACLPrefix, *ensureACLACL, *ensureACLFix)
+		for _, key := range drifted {
+			fmt.Println(key)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
 	case updatesReportCmd.FullCommand():
 		err := update.Report(*updatesReportBucketName, os.Stdout)
 		if err != nil {
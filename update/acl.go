@@ -0,0 +1,70 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// EnsureACL checks every object at a prefix has a canned ACL (public-read or
+// private, see cannedACL), returning the keys that don't, sorted. If fix is
+// set, the ACL is applied to them. The prefix is listed a page at a time and
+// the ACLs are read through the fetch limiter, so large prefixes are OK.
+func (c *Client) EnsureACL(bucketName string, prefix string, acl string, fix bool) ([]string, error) {
+	if acl != s3.ObjectCannedACLPublicRead && acl != s3.ObjectCannedACLPrivate {
+		return nil, fmt.Errorf("Unsupported ACL %q, must be %s or %s", acl, s3.ObjectCannedACLPublicRead, s3.ObjectCannedACLPrivate)
+	}
+	var mtx sync.Mutex
+	var drifted []string
+	var errs []error
+	err := c.listObjectPages(bucketName, normalizePrefix(prefix), func(page []*s3.Object) error {
+		c.forEachConcurrently(len(page), func(i int) {
+			key := aws.StringValue(page[i].Key)
+			var current string
+			var err error
+			c.limitFetch(func() { current, err = c.cannedACL(bucketName, key) })
+			if err != nil {
+				mtx.Lock()
+				errs = append(errs, fmt.Errorf("Error reading ACL of %s: %s", key, err))
+				mtx.Unlock()
+				return
+			}
+			if current == acl {
+				return
+			}
+			c.logf(VerbosityQuiet, "%s is %s, expected %s", key, current, acl)
+			if fix {
+				c.limitFetch(func() {
+					_, err = c.svc.PutObjectAcl(&s3.PutObjectAclInput{
+						Bucket: aws.String(bucketName),
+						Key:    aws.String(key),
+						ACL:    aws.String(acl),
+					})
+				})
+				if err != nil {
+					err = fmt.Errorf("Error setting ACL of %s: %s", key, err)
+				} else {
+					c.logf(VerbosityNormal, "Set %s to %s", key, acl)
+				}
+			}
+			mtx.Lock()
+			drifted = append(drifted, key)
+			if err != nil {
+				errs = append(errs, err)
+			}
+			mtx.Unlock()
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(drifted)
+	return drifted, CombineErrors(errs...)
+}
@@ -0,0 +1,57 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnsureACL(t *testing.T) {
+	f := newFakeS3()
+	f.PageSize = 2
+	c := newTestClient(f)
+	c.ListPageSize = 2
+	for i := 0; i < 5; i++ {
+		_, err := f.PutObject(&s3.PutObjectInput{
+			Bucket: aws.String(testBucket),
+			Key:    aws.String(fmt.Sprintf("darwin/Keybase-1.0.%d.dmg", i)),
+			Body:   bytes.NewReader([]byte("dmg")),
+			ACL:    aws.String(s3.ObjectCannedACLPublicRead),
+		})
+		require.NoError(t, err)
+	}
+	// Lost their ACL
+	f.Put(testBucket, "darwin/Keybase-1.0.5.dmg", "dmg", time.Now())
+	f.Put(testBucket, "darwin/Keybase-1.0.6.dmg", "dmg", time.Now())
+	f.Put(testBucket, "windows/Keybase.msi", "msi", time.Now())
+
+	drifted, err := c.EnsureACL(testBucket, "darwin/", s3.ObjectCannedACLPublicRead, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"darwin/Keybase-1.0.5.dmg", "darwin/Keybase-1.0.6.dmg"}, drifted)
+	assert.Equal(t, "", f.Get(testBucket, "darwin/Keybase-1.0.5.dmg").ACL)
+
+	drifted, err = c.EnsureACL(testBucket, "darwin/", s3.ObjectCannedACLPublicRead, true)
+	require.NoError(t, err)
+	assert.Len(t, drifted, 2)
+	assert.Equal(t, s3.ObjectCannedACLPublicRead, f.Get(testBucket, "darwin/Keybase-1.0.5.dmg").ACL)
+	drifted, err = c.EnsureACL(testBucket, "darwin/", s3.ObjectCannedACLPublicRead, false)
+	require.NoError(t, err)
+	assert.Empty(t, drifted)
+
+	// Everything is public, nothing is private
+	drifted, err = c.EnsureACL(testBucket, "darwin/", s3.ObjectCannedACLPrivate, false)
+	require.NoError(t, err)
+	assert.Len(t, drifted, 7)
+
+	_, err = c.EnsureACL(testBucket, "darwin/", s3.ObjectCannedACLAuthenticatedRead, false)
+	require.Error(t, err)
+}
@@ -0,0 +1,65 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"strings"
+)
+
+const (
+	// ArchAMD64 is the arch of 64-bit x86 builds
+	ArchAMD64 = "amd64"
+	// ArchARM64 is the arch of 64-bit ARM builds
+	ArchARM64 = "arm64"
+)
+
+// archNames are the ways an arch appears in artifact names
+var archNames = map[string]string{
+	"amd64":   ArchAMD64,
+	"x86_64":  ArchAMD64,
+	"arm64":   ArchARM64,
+	"aarch64": ArchARM64,
+}
+
+// archForName returns the arch in an artifact name, such as the amd64 in
+// keybase_1.0.15-20160313013917.ab12cd3_amd64.deb, or "" if there isn't one
+func archForName(name string) string {
+	parts := strings.FieldsFunc(name, func(c rune) bool {
+		return c == '-' || c == '.' || c == '+' || c == '/'
+	})
+	for _, part := range parts {
+		// x86_64 has an underscore, so check the whole part before splitting
+		if arch, ok := archNames[part]; ok {
+			return arch
+		}
+		for _, subpart := range strings.Split(part, "_") {
+			if arch, ok := archNames[subpart]; ok {
+				return arch
+			}
+		}
+	}
+	return ""
+}
+
+// archForPrefix returns the arch of the platform at a prefix, or "" if no
+// platform is
+func archForPrefix(prefix string) string {
+	for _, platform := range platformsAll {
+		if normalizePrefix(platform.Prefix) == normalizePrefix(prefix) {
+			return platform.Arch
+		}
+	}
+	return ""
+}
+
+// FilterArch returns the releases for an arch
+func FilterArch(releases []Release, arch string) []Release {
+	filtered := []Release{}
+	for _, release := range releases {
+		if release.Arch == arch {
+			filtered = append(filtered, release)
+		}
+	}
+	return filtered
+}
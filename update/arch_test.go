@@ -0,0 +1,47 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchForName(t *testing.T) {
+	assert.Equal(t, ArchAMD64, archForName("keybase_1.0.15-20160313013917.ab12cd3_amd64.deb"))
+	assert.Equal(t, ArchAMD64, archForName("keybase-1.0.15-20160313013917.ab12cd3.x86_64.rpm"))
+	assert.Equal(t, ArchARM64, archForName("keybase_1.0.15-20160313013917.ab12cd3_arm64.deb"))
+	assert.Equal(t, ArchARM64, archForName("keybase-1.0.15-20160313013917.ab12cd3.aarch64.rpm"))
+	assert.Equal(t, ArchAMD64, archForName("Keybase_1.0.15-20160313013917+ab12cd3.amd64.msi"))
+	assert.Equal(t, "", archForName("Keybase-1.0.15-20160313013917+ab12cd3.dmg"))
+}
+
+func TestReleaseArch(t *testing.T) {
+	f := newFakeS3()
+	f.Put(testBucket, "darwin/Keybase-1.0.15-20160313013917+ab12cd3.dmg", "dmg", time.Now())
+	f.Put(testBucket, "linux_binaries/deb/keybase_1.0.15-20160313013917.ab12cd3_amd64.deb", "deb", time.Now())
+	f.Put(testBucket, "linux_binaries/deb/keybase_1.0.15-20160313013917.ab12cd3_arm64.deb", "deb", time.Now())
+	c := newTestClient(f)
+
+	// Darwin names don't have an arch, so it's the platform's
+	releases, err := c.ListReleases(testBucket, "darwin/", "")
+	require.NoError(t, err)
+	require.Len(t, releases, 1)
+	assert.Equal(t, ArchAMD64, releases[0].Arch)
+
+	releases, err = c.ListReleases(testBucket, "linux_binaries/deb/", "")
+	require.NoError(t, err)
+	require.Len(t, releases, 2)
+	arm := FilterArch(releases, ArchARM64)
+	require.Len(t, arm, 1)
+	assert.Equal(t, "keybase_1.0.15-20160313013917.ab12cd3_arm64.deb", arm[0].Name)
+	assert.Len(t, FilterArch(releases, ArchAMD64), 1)
+
+	for _, platform := range platformsAll {
+		assert.Equal(t, ArchAMD64, platform.Arch, platform.Name)
+	}
+}
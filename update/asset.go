@@ -0,0 +1,76 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// assetCheckTimeout is how long checkAsset waits for a HEAD of an asset
+// outside the bucket
+const assetCheckTimeout = 30 * time.Second
+
+// bucketKeyForURL returns the key a URL is for, if it's a URL for the bucket:
+// an S3 URL (path-style or virtual-hosted, in any region) or on the
+// PublicBaseURL host
+func (c *Client) bucketKeyForURL(bucketName string, rawURL string) (string, bool) {
+	if c.PublicBaseURL != "" && strings.HasPrefix(rawURL, strings.TrimSuffix(c.PublicBaseURL, "/")+"/") {
+		rest := strings.TrimPrefix(rawURL, strings.TrimSuffix(c.PublicBaseURL, "/")+"/")
+		key, err := url.PathUnescape(rest)
+		if err != nil {
+			return "", false
+		}
+		return key, true
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || !strings.HasSuffix(u.Host, ".amazonaws.com") {
+		return "", false
+	}
+	path := strings.TrimPrefix(u.Path, "/")
+	switch {
+	case strings.HasPrefix(u.Host, bucketName+".s3.") || strings.HasPrefix(u.Host, bucketName+".s3-"):
+		return path, path != ""
+	case strings.HasPrefix(u.Host, "s3.") || strings.HasPrefix(u.Host, "s3-"):
+		if !strings.HasPrefix(path, bucketName+"/") {
+			return "", false
+		}
+		key := strings.TrimPrefix(path, bucketName+"/")
+		return key, key != ""
+	}
+	return "", false
+}
+
+// checkAsset checks an update's asset can be downloaded: that the object
+// exists, if it's in the bucket, or otherwise that a HEAD of it succeeds
+func (c *Client) checkAsset(bucketName string, upd *Update) error {
+	if upd.Asset == nil || upd.Asset.URL == "" {
+		return fmt.Errorf("Update %s has no asset URL", upd.Version)
+	}
+	assetURL := upd.Asset.URL
+	if key, ok := c.bucketKeyForURL(bucketName, assetURL); ok {
+		exists, err := c.objectExists(bucketName, key)
+		if err != nil {
+			return fmt.Errorf("Error checking asset %s for %s: %s", assetURL, upd.Version, err)
+		}
+		if !exists {
+			return fmt.Errorf("Asset %s for %s doesn't exist (no object at %s)", assetURL, upd.Version, key)
+		}
+		return nil
+	}
+
+	client := &http.Client{Timeout: assetCheckTimeout}
+	resp, err := client.Head(assetURL)
+	if err != nil {
+		return fmt.Errorf("Asset %s for %s isn't reachable: %s", assetURL, upd.Version, err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("Asset %s for %s isn't reachable: %s", assetURL, upd.Version, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/keybase/release/update/s3test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBucketKeyForURL(t *testing.T) {
+	c := newTestClient(newFakeS3())
+	c.PublicBaseURL = "https://downloads.example.com/"
+	for rawURL, expected := range map[string]string{
+		"https://s3.amazonaws.com/" + testBucket + "/darwin/Keybase-1.0.15-20160313013917%2Bab12cd3.dmg": "darwin/Keybase-1.0.15-20160313013917+ab12cd3.dmg",
+		"https://" + testBucket + ".s3.eu-west-1.amazonaws.com/darwin/Keybase.dmg":                       "darwin/Keybase.dmg",
+		"https://s3.eu-west-1.amazonaws.com/" + testBucket + "/darwin/Keybase.dmg":                       "darwin/Keybase.dmg",
+		"https://downloads.example.com/darwin/Keybase-1.0.15-20160313013917%2Bab12cd3.dmg":               "darwin/Keybase-1.0.15-20160313013917+ab12cd3.dmg",
+		"https://s3.amazonaws.com/other-bucket/darwin/Keybase.dmg":                                       "",
+		"https://other-bucket.s3.amazonaws.com/darwin/Keybase.dmg":                                       "",
+		"https://github.com/keybase/client/releases/download/v1.0.15/Keybase-1.0.15-20160313013917.dmg":  "",
+	} {
+		key, ok := c.bucketKeyForURL(testBucket, rawURL)
+		assert.Equal(t, expected != "", ok, rawURL)
+		assert.Equal(t, expected, key, rawURL)
+	}
+}
+
+func putUpdateJSONWithAsset(f *s3test.Bucket, key string, version string, assetURL string) {
+	f.Put(testBucket, key, fmt.Sprintf(`{"version": %q, "asset": {"name": "Keybase.dmg", "url": %q}}`, version, assetURL), time.Now())
+}
+
+func TestPromoteReleaseVerifyAsset(t *testing.T) {
+	f := newFakeS3()
+	version := "1.0.15-20160313013917+ab12cd3"
+	seedDarwinRelease(f, version)
+	supportKey := "darwin-support/" + SupportUpdateName(PlatformTypeDarwin, "prod", version)
+	c := newTestClient(f)
+
+	// The asset was moved
+	putUpdateJSONWithAsset(f, supportKey, version, "https://s3.amazonaws.com/"+testBucket+"/darwin/Keybase-moved.dmg")
+	_, err := c.PromoteReleaseWithOptions(testBucket, "v2", platformDarwin, "prod", PromoteOptions{VerifyAsset: true})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "doesn't exist")
+	assert.Nil(t, f.Get(testBucket, UpdateJSONName("v2", PlatformTypeDarwin, "prod")))
+
+	putUpdateJSONWithAsset(f, supportKey, version, c.publicURLForKey(testBucket, "darwin/Keybase-"+version+".dmg"))
+	result, err := c.PromoteReleaseWithOptions(testBucket, "v2", platformDarwin, "prod", PromoteOptions{VerifyAsset: true})
+	require.NoError(t, err)
+	assert.True(t, result.Promoted)
+
+	// No asset
+	putUpdateJSON(f, testBucket, supportKey, version)
+	_, err = c.PromoteReleaseWithOptions(testBucket, "test-v2", platformDarwin, "prod", PromoteOptions{VerifyAsset: true})
+	require.Error(t, err)
+}
+
+func TestCheckAssetOutsideBucket(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "HEAD", r.Method)
+		if r.URL.Path != "/Keybase.dmg" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	c := newTestClient(newFakeS3())
+	upd := &Update{Version: "1.0.15", Asset: &Asset{URL: server.URL + "/Keybase.dmg"}}
+	require.NoError(t, c.checkAsset(testBucket, upd))
+	upd.Asset.URL = server.URL + "/Keybase-moved.dmg"
+	err := c.checkAsset(testBucket, upd)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "404")
+}
@@ -0,0 +1,131 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// bucketConfigKey is where a bucket's defaults are stored
+const bucketConfigKey = "release-config.json"
+
+// ConfigChannel, passed as a channel, is the bucket config's channel. An
+// empty channel is always the base update JSON (update-<platform>-<env>.json).
+const ConfigChannel = "@config"
+
+// BucketConfig are the defaults stored in a bucket (at release-config.json),
+// used by the high-level functions when they're called with an empty env,
+// platform or policy, or with ConfigChannel.
+type BucketConfig struct {
+	Channel string `json:"channel,omitempty"`
+	Env     string `json:"env,omitempty"`
+	// Platforms are the platform names (darwin, linux, windows) to use when
+	// all platforms are asked for
+	Platforms []string `json:"platforms,omitempty"`
+	// PromotionPolicy is what PromoteFromPolicy runs without a policy file
+	PromotionPolicy
+}
+
+// defaultBucketConfig is used if a bucket has no config, or for what it
+// leaves out
+var defaultBucketConfig = BucketConfig{Env: "prod"}
+
+// Validate checks the platforms and promotions are valid
+func (b BucketConfig) Validate() error {
+	for _, name := range b.Platforms {
+		if name == "" {
+			return fmt.Errorf("Empty platform in bucket config")
+		}
+		if _, err := Platforms(name); err != nil {
+			return err
+		}
+	}
+	return b.PromotionPolicy.Validate()
+}
+
+// LoadBucketConfig reads a bucket's config. If it has none, it's the built-in
+// defaults (the base channel, prod and every platform). Unknown fields are an
+// error, like in a policy.
+func (c *Client) LoadBucketConfig(bucketName string) (*BucketConfig, error) {
+	config := defaultBucketConfig
+	resp, err := c.svc.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(bucketConfigKey),
+	})
+	if isNotFound(err) {
+		c.logf(VerbosityDebug, "No %s in %s, using defaults", bucketConfigKey, bucketName)
+		return &config, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	dec := json.NewDecoder(resp.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&config); err != nil {
+		return nil, fmt.Errorf("Invalid bucket config %s: %s", bucketConfigKey, err)
+	}
+	if config.Env == "" {
+		config.Env = defaultBucketConfig.Env
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("Invalid bucket config %s: %s", bucketConfigKey, err)
+	}
+	c.logf(VerbosityDebug, "Loaded %s from %s", bucketConfigKey, bucketName)
+	return &config, nil
+}
+
+// channelEnvDefaults fills in a ConfigChannel channel or an empty env from
+// the bucket config. The config is only read if one of them needs it.
+func (c *Client) channelEnvDefaults(bucketName string, channel string, env string) (string, string, error) {
+	if channel != ConfigChannel && env != "" {
+		return channel, env, nil
+	}
+	config, err := c.LoadBucketConfig(bucketName)
+	if err != nil {
+		return "", "", err
+	}
+	if channel == ConfigChannel {
+		channel = config.Channel
+	}
+	if env == "" {
+		env = config.Env
+	}
+	return channel, env, nil
+}
+
+// envDefault is env, or the bucket config's if it's empty, like
+// channelEnvDefaults for functions that don't take a channel
+func (c *Client) envDefault(bucketName string, env string) (string, error) {
+	_, env, err := c.channelEnvDefaults(bucketName, "", env)
+	return env, err
+}
+
+// defaultPlatforms returns the platforms for a name, or if it's empty, the
+// bucket config's platforms (all of them if it doesn't list any)
+func (c *Client) defaultPlatforms(bucketName string, name string) ([]Platform, error) {
+	if name != "" {
+		return Platforms(name)
+	}
+	config, err := c.LoadBucketConfig(bucketName)
+	if err != nil {
+		return nil, err
+	}
+	if len(config.Platforms) == 0 {
+		return Platforms("")
+	}
+	var platforms []Platform
+	for _, name := range config.Platforms {
+		p, err := Platforms(name)
+		if err != nil {
+			return nil, err
+		}
+		platforms = append(platforms, p...)
+	}
+	return platforms, nil
+}
@@ -0,0 +1,92 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadBucketConfig(t *testing.T) {
+	f := newFakeS3()
+	c := newTestClient(f)
+
+	// No config is the built-in defaults
+	config, err := c.LoadBucketConfig(testBucket)
+	require.NoError(t, err)
+	assert.Equal(t, defaultBucketConfig, *config)
+
+	f.Put(testBucket, bucketConfigKey, `{"channel": "v2", "platforms": ["darwin", "linux"], "promotions": [{"platform": "darwin", "channel": "v2", "env": "prod", "enabled": true}]}`, time.Now())
+	config, err = c.LoadBucketConfig(testBucket)
+	require.NoError(t, err)
+	assert.Equal(t, "v2", config.Channel)
+	assert.Equal(t, "prod", config.Env)
+	assert.Len(t, config.Promotions, 1)
+	platforms, err := c.defaultPlatforms(testBucket, "")
+	require.NoError(t, err)
+	assert.Equal(t, []Platform{platformDarwin, platformLinuxDeb, platformLinuxRPM}, platforms)
+
+	f.Put(testBucket, bucketConfigKey, `{"chanel": "v2"}`, time.Now())
+	_, err = c.LoadBucketConfig(testBucket)
+	require.Error(t, err)
+
+	f.Put(testBucket, bucketConfigKey, `{"platforms": ["beos"]}`, time.Now())
+	_, err = c.LoadBucketConfig(testBucket)
+	require.EqualError(t, err, "Invalid bucket config release-config.json: Invalid platform beos")
+}
+
+func TestBucketConfigDefaults(t *testing.T) {
+	f := newFakeS3()
+	version := "1.0.15-20160313013917+ab12cd3"
+	seedDarwinRelease(f, version)
+	f.Put(testBucket, bucketConfigKey, `{"channel": "v2"}`, time.Now())
+	c := newTestClient(f)
+
+	// ConfigChannel and the empty env are v2 and prod
+	require.NoError(t, c.PromoteSpecificVersion(testBucket, version, ConfigChannel, PlatformTypeDarwin, "", false))
+	assert.Equal(t, version, currentTestUpdate(t, c, "v2").Version)
+	_, _, err := c.CurrentUpdate(testBucket, "", PlatformTypeDarwin, "prod")
+	require.True(t, isNotFound(err))
+
+	pending, err := c.PendingReleases(testBucket, PlatformTypeDarwin, "", ConfigChannel)
+	require.NoError(t, err)
+	assert.Len(t, pending, 0)
+
+	// The empty channel is still the base update JSON
+	require.NoError(t, c.PromoteSpecificVersion(testBucket, version, "", PlatformTypeDarwin, "", false))
+	upd, _, err := c.CurrentUpdate(testBucket, "", PlatformTypeDarwin, "prod")
+	require.NoError(t, err)
+	assert.Equal(t, version, upd.Version)
+	pending, err = c.PendingReleases(testBucket, PlatformTypeDarwin, "", "")
+	require.NoError(t, err)
+	assert.Len(t, pending, 0)
+
+	history, err := c.GetUpdateHistory(testBucket, PlatformTypeDarwin, "")
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+}
+
+func TestLoadBucketConfigErrors(t *testing.T) {
+	f := newFakeS3()
+	c := newTestClient(f)
+
+	// Only a missing config is the defaults, so CopyLatest doesn't run on
+	// every platform because the config couldn't be read
+	for _, code := range []string{"AccessDenied", "InternalError"} {
+		f.GetErrs = map[string]error{bucketConfigKey: awserr.New(code, code, nil)}
+		_, err := c.LoadBucketConfig(testBucket)
+		require.Error(t, err)
+		_, err = c.defaultPlatforms(testBucket, "")
+		require.Error(t, err)
+	}
+
+	f.GetErrs = nil
+	f.Put(testBucket, bucketConfigKey, `{"platforms": ["beos"]}`, time.Now())
+	_, err := c.defaultPlatforms(testBucket, "")
+	require.Error(t, err)
+}
@@ -0,0 +1,74 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// LatestNameForChannel is the fixed path the newest release for a channel is
+// copied to, for example Keybase-beta.dmg for the beta channel. An empty
+// channel is the default LatestName.
+func (p Platform) LatestNameForChannel(channel string) string {
+	if channel == "" {
+		return p.LatestName
+	}
+	ext := path.Ext(p.LatestName)
+	return strings.TrimSuffix(p.LatestName, ext) + "-" + channel + ext
+}
+
+// MatchesChannel returns true if the release name has the channel as one of
+// its parts, for example Keybase-1.2.3-20160312013917+cd6f696-beta.dmg is in
+// the beta channel.
+func (r Release) MatchesChannel(channel string) bool {
+	parts := strings.FieldsFunc(r.Name, func(c rune) bool {
+		return c == '-' || c == '_' || c == '.' || c == '+'
+	})
+	for _, part := range parts {
+		if strings.EqualFold(part, channel) {
+			return true
+		}
+	}
+	return false
+}
+
+// CopyLatestForChannel copies the newest release in a channel to the channel's
+// fixed path, for each platform. Platforms without a release in the channel
+// are skipped.
+func (c *Client) CopyLatestForChannel(bucketName string, channel string) error {
+	platforms, err := Platforms("")
+	if err != nil {
+		return err
+	}
+	for _, platform := range platforms {
+		release, err := c.findRelease(bucketName, platform, func(r Release) bool {
+			return r.MatchesChannel(channel)
+		})
+		if err != nil {
+			return err
+		}
+		latestName := platform.LatestNameForChannel(channel)
+		if release == nil {
+			c.logf(VerbosityNormal, "No %s release for %s, not updating %s", channel, platform.Name, latestName)
+			continue
+		}
+		url, _ := urlStringForKey(release.Key, bucketName, platform.Prefix)
+		c.logf(VerbosityNormal, "Copying %s to %s", url, latestName)
+		_, err = c.svc.CopyObject(&s3.CopyObjectInput{
+			Bucket:       aws.String(bucketName),
+			CopySource:   aws.String(url),
+			Key:          aws.String(latestName),
+			CacheControl: aws.String(defaultCacheControl),
+			ACL:          aws.String("public-read"),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLatestNameForChannel(t *testing.T) {
+	assert.Equal(t, "Keybase.dmg", platformDarwin.LatestNameForChannel(""))
+	assert.Equal(t, "Keybase-beta.dmg", platformDarwin.LatestNameForChannel("beta"))
+	assert.Equal(t, "keybase_amd64-beta.deb", platformLinuxDeb.LatestNameForChannel("beta"))
+}
+
+func TestCopyLatestForChannel(t *testing.T) {
+	f := newFakeS3()
+	now := time.Now()
+	f.Put(testBucket, "darwin/Keybase-1.0.15-20160313013917+ab12cd3-beta.dmg", "beta1", now)
+	f.Put(testBucket, "darwin/Keybase-1.0.16-20160314013917+bc23de4-beta.dmg", "beta2", now)
+	f.Put(testBucket, "darwin/Keybase-1.0.17-20160315013917+cd34ef5.dmg", "stable", now)
+	f.Put(testBucket, "windows/Keybase_1.0.17-20160315013917+cd34ef5.amd64.msi", "stable", now)
+
+	err := newTestClient(f).CopyLatestForChannel(testBucket, "beta")
+	require.NoError(t, err)
+	latest := f.Get(testBucket, "Keybase-beta.dmg")
+	require.NotNil(t, latest)
+	assert.Equal(t, "beta2", string(latest.Body))
+	assert.Equal(t, "public-read", latest.ACL)
+	assert.Nil(t, f.Get(testBucket, "keybase_setup_amd64-beta.msi"))
+}
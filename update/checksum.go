@@ -0,0 +1,81 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// checksumSidecarSuffix is the suffix of the SHA256 the build uploads next to
+// an artifact, in sha256sum format (the hex digest, optionally followed by
+// the file name)
+const checksumSidecarSuffix = ".sha256"
+
+// remoteDigest returns the hex SHA256 of an object, from its checksum sidecar
+// if there is one, otherwise by streaming the object
+func (c *Client) remoteDigest(bucketName string, key string) (string, error) {
+	sidecarKey := key + checksumSidecarSuffix
+	resp, err := c.svc.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(sidecarKey),
+	})
+	if err == nil {
+		defer func() { _ = resp.Body.Close() }()
+		data, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return "", err
+		}
+		fields := strings.Fields(string(data))
+		if len(fields) == 0 {
+			return "", fmt.Errorf("Empty checksum in %s", sidecarKey)
+		}
+		return strings.ToLower(fields[0]), nil
+	}
+	if !isNotFound(err) {
+		return "", err
+	}
+
+	c.logf(VerbosityVerbose, "No checksum at %s, hashing %s", sidecarKey, key)
+	resp, err = c.svc.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, resp.Body); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// VerifyLocalMatchesRemote checks an uploaded object is the artifact at
+// localPath, by comparing their SHA256. The remote digest is from the
+// checksum sidecar (<key>.sha256) if there is one, otherwise the object is
+// hashed as it's downloaded, without buffering it.
+func (c *Client) VerifyLocalMatchesRemote(bucketName string, key string, localPath string) (bool, error) {
+	localDigest, err := digest(localPath)
+	if err != nil {
+		return false, err
+	}
+	remoteDigest, err := c.remoteDigest(bucketName, key)
+	if err != nil {
+		return false, err
+	}
+	if localDigest != remoteDigest {
+		c.logf(VerbosityQuiet, "%s (%s) doesn't match %s (%s)", localPath, localDigest, key, remoteDigest)
+		return false, nil
+	}
+	return true, nil
+}
@@ -0,0 +1,59 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyLocalMatchesRemote(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestVerifyLocalMatchesRemote")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	localPath := filepath.Join(dir, "Keybase.dmg")
+	require.NoError(t, ioutil.WriteFile(localPath, []byte("dmg"), 0644))
+	sum := sha256.Sum256([]byte("dmg"))
+	digest := hex.EncodeToString(sum[:])
+
+	f := newFakeS3()
+	key := "darwin/Keybase-1.0.15-20160313013917+ab12cd3.dmg"
+	f.Put(testBucket, key, "dmg", time.Now())
+	c := newTestClient(f)
+
+	// Streamed, without a sidecar
+	match, err := c.VerifyLocalMatchesRemote(testBucket, key, localPath)
+	require.NoError(t, err)
+	assert.True(t, match)
+	f.Put(testBucket, key, "other dmg", time.Now())
+	match, err = c.VerifyLocalMatchesRemote(testBucket, key, localPath)
+	require.NoError(t, err)
+	assert.False(t, match)
+
+	// The sidecar is used if there is one
+	f.Put(testBucket, key+".sha256", digest+"  Keybase-1.0.15-20160313013917+ab12cd3.dmg\n", time.Now())
+	match, err = c.VerifyLocalMatchesRemote(testBucket, key, localPath)
+	require.NoError(t, err)
+	assert.True(t, match)
+	f.Put(testBucket, key+".sha256", "ab12\n", time.Now())
+	match, err = c.VerifyLocalMatchesRemote(testBucket, key, localPath)
+	require.NoError(t, err)
+	assert.False(t, match)
+	f.Put(testBucket, key+".sha256", "", time.Now())
+	_, err = c.VerifyLocalMatchesRemote(testBucket, key, localPath)
+	require.Error(t, err)
+
+	_, err = c.VerifyLocalMatchesRemote(testBucket, "darwin/missing.dmg", localPath)
+	assert.True(t, isNotFound(err))
+	_, err = c.VerifyLocalMatchesRemote(testBucket, key, filepath.Join(dir, "missing.dmg"))
+	require.Error(t, err)
+}
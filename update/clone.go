@@ -0,0 +1,54 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"net/http"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Clone returns a client with the same settings and its own S3 connections,
+// for parallel workers. Maps are copied, so changing one client's doesn't
+// change the other's. The clone has its own fetch limiter (FetchConcurrency
+// and FetchRPS are per client). A client for a fake bucket (from
+// NewClientWithS3) shares it.
+func (c *Client) Clone() *Client {
+	cp := *c
+	clone := &cp
+	clone.fetch = &fetchLimits{}
+	clone.TagVersions = copyStringMap(c.TagVersions)
+	if c.PlatformVariants != nil {
+		clone.PlatformVariants = map[string][]Platform{}
+		for name, variants := range c.PlatformVariants {
+			clone.PlatformVariants[name] = append([]Platform(nil), variants...)
+		}
+	}
+	if c.Rings != nil {
+		clone.Rings = append([]Ring(nil), c.Rings...)
+	}
+	if c.TemplateData != nil {
+		clone.TemplateData = map[string]interface{}{}
+		for k, v := range c.TemplateData {
+			clone.TemplateData[k] = v
+		}
+	}
+	if c.sess != nil {
+		clone.sess = c.sess.Copy(&aws.Config{HTTPClient: &http.Client{}})
+		clone.svc = timeoutS3{svc: s3.New(clone.sess), client: clone}
+	}
+	return clone
+}
+
+func copyStringMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	copied := make(map[string]string, len(m))
+	for k, v := range m {
+		copied[k] = v
+	}
+	return copied
+}
@@ -0,0 +1,63 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClone(t *testing.T) {
+	c, err := NewClientInRegion("eu-west-1")
+	require.NoError(t, err)
+	c.PublicBaseURL = "https://downloads.example.com"
+	c.KeyVersionPattern = regexp.MustCompile(`^([^/]+)/`)
+	c.TagVersions = map[string]string{"v1.0.15": "1.0.15"}
+	c.PlatformVariants = map[string][]Platform{PlatformTypeDarwin: {platformDarwinArm64}}
+	c.TemplateData = map[string]interface{}{"Logo": "logo.png"}
+	c.FetchConcurrency = 3
+	c.Timeouts.Copy = time.Hour
+	c.CommitLength = 10
+
+	clone := c.Clone()
+	assert.Equal(t, c.Region, clone.Region)
+	assert.Equal(t, c.PublicBaseURL, clone.PublicBaseURL)
+	assert.Equal(t, c.KeyVersionPattern, clone.KeyVersionPattern)
+	assert.Equal(t, c.TagVersions, clone.TagVersions)
+	assert.Equal(t, c.PlatformVariants, clone.PlatformVariants)
+	assert.Equal(t, c.TemplateData, clone.TemplateData)
+	assert.Equal(t, c.FetchConcurrency, clone.FetchConcurrency)
+	assert.Equal(t, c.Timeouts, clone.Timeouts)
+	assert.Equal(t, c.CommitLength, clone.CommitLength)
+
+	// Independent S3 clients and connections
+	svc := c.svc.(timeoutS3)
+	cloneSvc := clone.svc.(timeoutS3)
+	assert.True(t, svc.client == c)
+	assert.True(t, cloneSvc.client == clone)
+	assert.True(t, svc.svc.(*s3.S3) != cloneSvc.svc.(*s3.S3))
+	assert.True(t, c.sess.Config.HTTPClient != clone.sess.Config.HTTPClient)
+	assert.Equal(t, "eu-west-1", *clone.sess.Config.Region)
+
+	// Changing the clone doesn't change the original
+	clone.TagVersions["v1.0.16"] = "1.0.16"
+	clone.TemplateData["Logo"] = "other.png"
+	assert.Len(t, c.TagVersions, 1)
+	assert.Equal(t, "logo.png", c.TemplateData["Logo"])
+	assert.True(t, c.fetchLimiter() != clone.fetchLimiter())
+}
+
+func TestCloneFake(t *testing.T) {
+	f := newFakeS3()
+	c := newTestClient(f)
+	c.ObjectMetadata = true
+	clone := c.Clone()
+	assert.True(t, clone.svc == c.svc)
+	assert.True(t, clone.ObjectMetadata)
+}
@@ -0,0 +1,56 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"sort"
+	"strings"
+)
+
+// commitMatches returns true if two commit hashes are the same, allowing for
+// either to be abbreviated
+func commitMatches(a string, b string) bool {
+	if a == "" || b == "" {
+		return false
+	}
+	return strings.HasPrefix(a, b) || strings.HasPrefix(b, a)
+}
+
+// ReleasesBetweenCommits returns the releases at prefix built from one of
+// commits, which are the commits in the range in order (for example from git
+// rev-list --reverse A^..B). Releases are returned in commit order.
+func (c *Client) ReleasesBetweenCommits(bucketName string, prefix string, suffix string, commits []string) ([]Release, error) {
+	releases, err := c.ListReleases(bucketName, prefix, suffix)
+	if err != nil {
+		return nil, err
+	}
+	return releasesBetweenCommits(releases, commits), nil
+}
+
+func releasesBetweenCommits(releases []Release, commits []string) []Release {
+	type indexedRelease struct {
+		release Release
+		index   int
+	}
+	var matched []indexedRelease
+	for _, release := range releases {
+		for i, commit := range commits {
+			if commitMatches(release.Commit, commit) {
+				matched = append(matched, indexedRelease{release: release, index: i})
+				break
+			}
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		if matched[i].index != matched[j].index {
+			return matched[i].index < matched[j].index
+		}
+		return matched[i].release.Date.Before(matched[j].release.Date)
+	})
+	result := make([]Release, 0, len(matched))
+	for _, m := range matched {
+		result = append(result, m.release)
+	}
+	return result
+}
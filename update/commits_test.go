@@ -0,0 +1,37 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReleasesBetweenCommits(t *testing.T) {
+	f := newFakeS3()
+	now := time.Now()
+	f.Put(testBucket, "darwin/Keybase-1.0.10-20160301000000+aaaaaaa.dmg", "", now)
+	f.Put(testBucket, "darwin/Keybase-1.0.11-20160302000000+bbbbbbb.dmg", "", now)
+	f.Put(testBucket, "darwin/Keybase-1.0.12-20160303000000+ccccccc.dmg", "", now)
+	f.Put(testBucket, "darwin/Keybase-1.0.13-20160304000000+ddddddd.dmg", "", now)
+
+	// Commits from the caller (oldest first), some full, some not released
+	commits := []string{
+		"bbbbbbb1234567890bbbbbbb1234567890bbbbbb",
+		"1111111",
+		"ccccccc",
+	}
+	releases, err := newTestClient(f).ReleasesBetweenCommits(testBucket, "darwin/", "", commits)
+	require.NoError(t, err)
+	require.Len(t, releases, 2)
+	assert.Equal(t, "1.0.11-20160302000000+bbbbbbb", releases[0].Version)
+	assert.Equal(t, "1.0.12-20160303000000+ccccccc", releases[1].Version)
+
+	releases, err = newTestClient(f).ReleasesBetweenCommits(testBucket, "darwin/", "", nil)
+	require.NoError(t, err)
+	assert.Empty(t, releases)
+}
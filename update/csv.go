@@ -0,0 +1,104 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"bytes"
+	"encoding/csv"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"time"
+)
+
+// csvDateFormat is a date format spreadsheets recognize
+const csvDateFormat = "2006-01-02 15:04:05"
+
+// WriteCSV writes the newest limit releases at prefix as CSV, for pasting
+// into spreadsheets. If limit is 0, all releases are written.
+func WriteCSV(path string, bucketName string, prefix string, suffix string, limit int) error {
+	client, err := NewClient()
+	if err != nil {
+		return err
+	}
+	return client.WriteCSV(path, bucketName, prefix, suffix, limit)
+}
+
+// WriteCSV writes the newest limit releases at prefix as CSV for the Client
+func (c *Client) WriteCSV(path string, bucketName string, prefix string, suffix string, limit int) error {
+	releases, err := c.listReleases(bucketName, prefix, suffix, limit)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := WriteReleasesCSV(releases, &buf); err != nil {
+		return err
+	}
+	if err := makeParentDirs(path); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// WriteReleasesCSV writes releases as CSV, with a header row
+func WriteReleasesCSV(releases []Release, writer io.Writer) error {
+	w := csv.NewWriter(writer)
+	if err := w.Write([]string{"Name", "Version", "Date", "Commit", "Size", "URL"}); err != nil {
+		return err
+	}
+	for _, release := range releases {
+		err := w.Write([]string{
+			release.Name,
+			release.Version,
+			release.Date.Format(csvDateFormat),
+			release.Commit,
+			strconv.FormatInt(release.Size, 10),
+			release.URL,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// WriteCatalogCSV writes every release at each of the (comma separated)
+// prefixes as CSV, for importing the release catalog. Dates are RFC 3339.
+// (WriteCSV is the newest releases at one prefix, for spreadsheets.)
+func (c *Client) WriteCatalogCSV(path string, bucketName string, prefixes string, suffix string) error {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write([]string{"section", "name", "version", "commit", "date", "url", "size"}); err != nil {
+		return err
+	}
+	for _, prefix := range splitPrefixes(prefixes) {
+		releases, err := c.ListReleases(bucketName, prefix, suffix)
+		if err != nil {
+			return err
+		}
+		for _, release := range releases {
+			err := w.Write([]string{
+				prefix,
+				release.Name,
+				release.Version,
+				release.Commit,
+				release.Date.Format(time.RFC3339),
+				release.URL,
+				strconv.FormatInt(release.Size, 10),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	if err := makeParentDirs(path); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, buf.Bytes(), 0644)
+}
@@ -0,0 +1,83 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"bytes"
+	"encoding/csv"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteCSV(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestWriteCSV")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	f := newFakeS3()
+	f.Put(testBucket, "darwin/Keybase-1.0.13-20160311013917+eeeeeee.dmg", "dmg", time.Now())
+	f.Put(testBucket, "darwin/Keybase-1.0.14-20160312013917+cd6f696.dmg", "dmg", time.Now())
+	f.Put(testBucket, "darwin/Keybase-1.0.15-20160313013917+ab12cd3.dmg", "dmg!", time.Now())
+	path := filepath.Join(dir, "releases.csv")
+	require.NoError(t, newTestClient(f).WriteCSV(path, testBucket, "darwin/", "", 2))
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, []string{"Name", "Version", "Date", "Commit", "Size", "URL"}, records[0])
+	assert.Equal(t, []string{
+		"Keybase-1.0.15-20160313013917+ab12cd3.dmg",
+		"1.0.15-20160313013917+ab12cd3",
+		"2016-03-12 20:39:17",
+		"ab12cd3",
+		"4",
+		"https://s3.amazonaws.com/test-bucket/darwin/Keybase-1.0.15-20160313013917%2Bab12cd3.dmg",
+	}, records[1])
+	assert.Equal(t, "1.0.14-20160312013917+cd6f696", records[2][1])
+}
+
+func TestWriteReleasesCSVQuoting(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, WriteReleasesCSV([]Release{{Name: `Keybase, "beta".dmg`, Version: "1.0.15"}}, &buf))
+	assert.Contains(t, buf.String(), `"Keybase, ""beta"".dmg",1.0.15,`)
+}
+
+func TestWriteCatalogCSV(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestWriteCatalogCSV")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	f := newFakeS3()
+	f.Put(testBucket, "darwin/Keybase-1.0.14-20160312013917+cd6f696.dmg", "dmg", time.Now())
+	f.Put(testBucket, "darwin/Keybase-1.0.15-20160313013917+ab12cd3.dmg", "dmg", time.Now())
+	f.Put(testBucket, "windows/Keybase_1.0.15-20160313013917+ab12cd3,test.amd64.msi", "msi!", time.Now())
+	path := filepath.Join(dir, "catalog.csv")
+	require.NoError(t, newTestClient(f).WriteCatalogCSV(path, testBucket, "darwin/,windows/", ""))
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 4)
+	assert.Equal(t, []string{"section", "name", "version", "commit", "date", "url", "size"}, records[0])
+	assert.Equal(t, "darwin/", records[1][0])
+	assert.Equal(t, "1.0.15-20160313013917+ab12cd3", records[1][2])
+	assert.Equal(t, "1.0.14-20160312013917+cd6f696", records[2][2])
+
+	windows := records[3]
+	assert.Equal(t, "windows/", windows[0])
+	assert.Equal(t, "Keybase_1.0.15-20160313013917+ab12cd3,test.amd64.msi", windows[1])
+	date, err := time.Parse(time.RFC3339, windows[4])
+	require.NoError(t, err)
+	assert.True(t, date.Equal(time.Date(2016, 3, 13, 1, 39, 17, 0, time.UTC)))
+	assert.Equal(t, "4", windows[6])
+}
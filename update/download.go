@@ -0,0 +1,100 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"io"
+
+	"github.com/alecthomas/template"
+)
+
+// Download is the latest release for a platform, for the download page
+type Download struct {
+	Platform string
+	OS       string
+	Arch     string
+	Name     string
+	URL      string
+	Version  string
+	Size     int64
+}
+
+// downloadOS is the OS a platform's builds are for, as reported by client
+// side detection (linux packages are all linux)
+func (p Platform) downloadOS() string {
+	switch p.Name {
+	case PlatformTypeDarwin, PlatformTypeWindows:
+		return p.Name
+	default:
+		return PlatformTypeLinux
+	}
+}
+
+// LatestDownloads returns the latest release for each platform. Platforms
+// without any releases are skipped.
+func (c *Client) LatestDownloads(bucketName string) ([]Download, error) {
+	var downloads []Download
+	for _, platform := range platformsAll {
+		release, err := c.findRelease(bucketName, platform, func(r Release) bool { return true })
+		if err != nil {
+			return nil, err
+		}
+		if release == nil {
+			c.logf(VerbosityVerbose, "No release found for %s", platform.Name)
+			continue
+		}
+		downloads = append(downloads, Download{
+			Platform: platform.Name,
+			OS:       platform.downloadOS(),
+			Arch:     platform.Arch,
+			Name:     release.Name,
+			URL:      release.URL,
+			Version:  release.Version,
+			Size:     release.Size,
+		})
+	}
+	return downloads, nil
+}
+
+var downloadTemplate = `
+<!doctype html>
+<html lang="en">
+<head>
+  <title>{{ .Title }}</title>
+</head>
+<body>
+	<ul class="downloads">
+	{{ range $index, $dl := .Downloads }}
+		<li data-os="{{ $dl.OS }}" data-arch="{{ $dl.Arch }}" data-platform="{{ $dl.Platform }}"><a href="{{ $dl.URL }}">{{ $dl.Name }}</a> <strong>{{ $dl.Version }}</strong> <span class="size" data-bytes="{{ $dl.Size }}">{{ $dl.Size }}</span></li>
+	{{ end }}
+	</ul>
+</body>
+</html>
+`
+
+// WriteDownloadPage writes a download page with the latest release for each
+// platform, with data-os and data-arch attributes so the page can highlight
+// the right download for the visitor. The per release index is WriteHTML.
+func (c *Client) WriteDownloadPage(bucketName string, title string, writer io.Writer) error {
+	downloads, err := c.LatestDownloads(bucketName)
+	if err != nil {
+		return err
+	}
+	return WriteDownloadPageForDownloads(title, downloads, writer)
+}
+
+// WriteDownloadPageForDownloads writes a download page for a set of downloads
+func WriteDownloadPageForDownloads(title string, downloads []Download, writer io.Writer) error {
+	vars := map[string]interface{}{
+		"Title":     title,
+		"Downloads": downloads,
+	}
+
+	t, err := template.New("download").Parse(downloadTemplate)
+	if err != nil {
+		return err
+	}
+
+	return t.Execute(writer, vars)
+}
@@ -0,0 +1,46 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteDownloadPage(t *testing.T) {
+	f := newFakeS3()
+	f.Put(testBucket, "darwin/Keybase-1.0.14-20160312013917+cd6f696.dmg", "old", time.Now())
+	f.Put(testBucket, "darwin/Keybase-1.0.15-20160313013917+ab12cd3.dmg", "newer", time.Now())
+	f.Put(testBucket, "linux_binaries/deb/keybase_1.0.15-20160313013917.ab12cd3_amd64.deb", "deb", time.Now())
+	c := newTestClient(f)
+
+	downloads, err := c.LatestDownloads(testBucket)
+	require.NoError(t, err)
+	require.Len(t, downloads, 2)
+	assert.Equal(t, Download{
+		Platform: PlatformTypeDarwin,
+		OS:       PlatformTypeDarwin,
+		Arch:     "amd64",
+		Name:     "Keybase-1.0.15-20160313013917+ab12cd3.dmg",
+		URL:      "https://s3.amazonaws.com/test-bucket/darwin/Keybase-1.0.15-20160313013917%2Bab12cd3.dmg",
+		Version:  "1.0.15-20160313013917+ab12cd3",
+		Size:     5,
+	}, downloads[0])
+	assert.Equal(t, "deb", downloads[1].Platform)
+	assert.Equal(t, PlatformTypeLinux, downloads[1].OS)
+
+	var buf bytes.Buffer
+	require.NoError(t, c.WriteDownloadPage(testBucket, "Download Keybase", &buf))
+	page := buf.String()
+	assert.Contains(t, page, "<title>Download Keybase</title>")
+	assert.Contains(t, page, `<li data-os="darwin" data-arch="amd64" data-platform="darwin"><a href="https://s3.amazonaws.com/test-bucket/darwin/Keybase-1.0.15-20160313013917%2Bab12cd3.dmg">Keybase-1.0.15-20160313013917+ab12cd3.dmg</a>`)
+	assert.Contains(t, page, `data-os="linux" data-arch="amd64" data-platform="deb"`)
+	assert.Contains(t, page, `data-bytes="5"`)
+	assert.NotContains(t, page, "1.0.14")
+	assert.NotContains(t, page, `data-os="windows"`)
+}
@@ -0,0 +1,131 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// electronFeedName is the name of the electron-updater feed for a platform
+func electronFeedName(platformName string) string {
+	switch platformName {
+	case PlatformTypeDarwin:
+		return "latest-mac.yml"
+	case PlatformTypeWindows:
+		return "latest.yml"
+	default:
+		return "latest-linux.yml"
+	}
+}
+
+// isElectronFeedName is whether a name is any platform's electron-updater feed
+func isElectronFeedName(name string) bool {
+	for _, platformName := range []string{PlatformTypeDarwin, PlatformTypeWindows, PlatformTypeLinux} {
+		if name == electronFeedName(platformName) {
+			return true
+		}
+	}
+	return false
+}
+
+// electronFeed is the fields of an electron-updater feed
+type electronFeed struct {
+	Version     string
+	Path        string
+	SHA512      string
+	Size        int64
+	ReleaseDate string
+}
+
+// yamlString quotes a YAML scalar, so versions, names and dates are read as
+// strings
+func yamlString(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+// YAML is the feed in electron-updater's schema. It's simple enough to write
+// without a YAML library.
+func (f electronFeed) YAML() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "version: %s\n", yamlString(f.Version))
+	fmt.Fprintf(&buf, "files:\n")
+	fmt.Fprintf(&buf, "  - url: %s\n", yamlString(f.Path))
+	fmt.Fprintf(&buf, "    sha512: %s\n", f.SHA512)
+	fmt.Fprintf(&buf, "    size: %d\n", f.Size)
+	fmt.Fprintf(&buf, "path: %s\n", yamlString(f.Path))
+	fmt.Fprintf(&buf, "sha512: %s\n", f.SHA512)
+	fmt.Fprintf(&buf, "releaseDate: %s\n", yamlString(f.ReleaseDate))
+	return buf.String()
+}
+
+// objectSHA512 is the base64 SHA512 of an object, streamed
+func (c *Client) objectSHA512(bucketName string, key string) (string, int64, error) {
+	resp, err := c.svc.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	hasher := sha512.New()
+	size, err := io.Copy(hasher, resp.Body)
+	if err != nil {
+		return "", 0, err
+	}
+	return base64.StdEncoding.EncodeToString(hasher.Sum(nil)), size, nil
+}
+
+// WriteElectronUpdaterFeed uploads an electron-updater feed (latest-mac.yml,
+// latest.yml) for the newest release of a platform, next to its releases.
+// Like CopyLatest, pre-releases are skipped unless CopyLatestPrereleases is
+// set.
+func (c *Client) WriteElectronUpdaterFeed(bucketName string, platformName string) error {
+	platform, err := platformForName(platformName)
+	if err != nil {
+		return err
+	}
+	release, err := c.findLatestRelease(bucketName, platform, func(r Release) bool {
+		return c.CopyLatestPrereleases || !r.IsPrerelease()
+	})
+	if err != nil {
+		return err
+	}
+	if release == nil {
+		return fmt.Errorf("No release found for %s", platform.Name)
+	}
+	sha, size, err := c.objectSHA512(bucketName, release.Key)
+	if err != nil {
+		return err
+	}
+	feed := electronFeed{
+		Version:     release.Version,
+		Path:        release.Name,
+		SHA512:      sha,
+		Size:        size,
+		ReleaseDate: release.Date.UTC().Format("2006-01-02T15:04:05.000Z"),
+	}
+
+	data := []byte(feed.YAML())
+	key := normalizePrefix(platform.Prefix) + electronFeedName(platform.Name)
+	c.logf(VerbosityNormal, "Writing %s for %s", key, release.Version)
+	_, err = c.svc.PutObject(&s3.PutObjectInput{
+		Bucket:        aws.String(bucketName),
+		Key:           aws.String(key),
+		CacheControl:  aws.String(defaultCacheControl),
+		ACL:           aws.String("public-read"),
+		Body:          bytes.NewReader(data),
+		ContentLength: aws.Int64(int64(len(data))),
+		ContentType:   aws.String("text/yaml"),
+	})
+	return err
+}
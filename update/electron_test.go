@@ -0,0 +1,59 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteElectronUpdaterFeed(t *testing.T) {
+	f := newFakeS3()
+	f.Put(testBucket, "darwin/Keybase-1.0.14-20160312013917+cd6f696.dmg", "older dmg", time.Now())
+	f.Put(testBucket, "darwin/Keybase-1.0.15-20160313013917+ab12cd3.dmg", "dmg", time.Now())
+	c := newTestClient(f)
+
+	require.NoError(t, c.WriteElectronUpdaterFeed(testBucket, PlatformTypeDarwin))
+	feed := f.Get(testBucket, "darwin/latest-mac.yml")
+	require.NotNil(t, feed)
+	sum := sha512.Sum512([]byte("dmg"))
+	sha := base64.StdEncoding.EncodeToString(sum[:])
+	assert.Equal(t, `version: '1.0.15-20160313013917+ab12cd3'
+files:
+  - url: 'Keybase-1.0.15-20160313013917+ab12cd3.dmg'
+    sha512: `+sha+`
+    size: 3
+path: 'Keybase-1.0.15-20160313013917+ab12cd3.dmg'
+sha512: `+sha+`
+releaseDate: '2016-03-13T01:39:17.000Z'
+`, string(feed.Body))
+	assert.Equal(t, "text/yaml", feed.ContentType)
+
+	require.Error(t, c.WriteElectronUpdaterFeed(testBucket, PlatformTypeWindows))
+	require.Error(t, c.WriteElectronUpdaterFeed(testBucket, PlatformTypeLinux))
+}
+
+func TestElectronUpdaterFeedNotListed(t *testing.T) {
+	f := newFakeS3()
+	f.Put(testBucket, "windows/Keybase_1.0.15-20160313013917+ab12cd3.amd64.msi", "msi", time.Now())
+	c := newTestClient(f)
+	require.NoError(t, c.WriteElectronUpdaterFeed(testBucket, PlatformTypeWindows))
+	require.NotNil(t, f.Get(testBucket, "windows/latest.yml"))
+
+	// Windows releases have no suffix, so the feed is skipped by name
+	releases, err := c.listReleases(testBucket, platformWindows.Prefix, platformWindows.Suffix, 0)
+	require.NoError(t, err)
+	require.Len(t, releases, 1)
+	assert.Equal(t, "Keybase_1.0.15-20160313013917+ab12cd3.amd64.msi", releases[0].Name)
+}
+
+func TestYAMLString(t *testing.T) {
+	assert.Equal(t, `'1.0.15'`, yamlString("1.0.15"))
+	assert.Equal(t, `'Keybase''s.dmg'`, yamlString("Keybase's.dmg"))
+}
@@ -0,0 +1,16 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"github.com/keybase/release/update/s3test"
+)
+
+func newFakeS3() *s3test.Bucket {
+	return s3test.NewBucket()
+}
+
+func newTestClient(svc *s3test.Bucket) *Client {
+	return NewClientWithS3(svc)
+}
@@ -0,0 +1,68 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/blang/semver"
+)
+
+// GroupFunc returns the header of the index section a release goes in
+type GroupFunc func(release Release) string
+
+// GroupByMajorVersion groups releases by major version (1.x). Releases
+// without a valid version are in "Other".
+func GroupByMajorVersion(release Release) string {
+	ver, err := semver.Make(release.Version)
+	if err != nil {
+		return "Other"
+	}
+	return fmt.Sprintf("%d.x", ver.Major)
+}
+
+// GroupByMonth groups releases by the month (Eastern) they were built
+func GroupByMonth(release Release) string {
+	return release.Date.Format("January 2006")
+}
+
+// groupSections regroups the releases in sections (a section per prefix) by
+// group. Sections are ordered by their newest release, then header, and
+// releases in a section newest first.
+func groupSections(sections []Section, group GroupFunc) []Section {
+	if group == nil {
+		return sections
+	}
+	var all []Release
+	for _, section := range sections {
+		all = append(all, section.Releases...)
+	}
+	// Stable, so releases from the same date stay in prefix order
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[j].Date.Before(all[i].Date)
+	})
+
+	var grouped []Section
+	index := map[string]int{}
+	for _, release := range all {
+		header := group(release)
+		i, ok := index[header]
+		if !ok {
+			i = len(grouped)
+			index[header] = i
+			grouped = append(grouped, Section{Header: header})
+		}
+		grouped[i].Releases = append(grouped[i].Releases, release)
+	}
+	// Newest first already, except for ties
+	sort.SliceStable(grouped, func(i, j int) bool {
+		di, dj := grouped[i].Releases[0].Date, grouped[j].Releases[0].Date
+		if !di.Equal(dj) {
+			return dj.Before(di)
+		}
+		return grouped[i].Header < grouped[j].Header
+	})
+	return grouped
+}
@@ -0,0 +1,84 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupSections(t *testing.T) {
+	date := func(month time.Month, day int) time.Time {
+		return time.Date(2016, month, day, 0, 0, 0, 0, time.UTC)
+	}
+	sections := []Section{
+		{Header: "darwin/", Releases: []Release{
+			{Key: "d2", Version: "2.0.0", Date: date(4, 2)},
+			{Key: "d1", Version: "1.0.15", Date: date(3, 13)},
+		}},
+		{Header: "windows/", Releases: []Release{
+			{Key: "w2", Version: "2.0.0", Date: date(4, 2)},
+			{Key: "w1", Version: "1.0.14", Date: date(3, 12)},
+			{Key: "w0", Version: "invalid", Date: date(2, 1)},
+		}},
+	}
+	assert.Equal(t, sections, groupSections(sections, nil))
+
+	keys := func(section Section) []string {
+		var keys []string
+		for _, release := range section.Releases {
+			keys = append(keys, release.Key)
+		}
+		return keys
+	}
+
+	grouped := groupSections(sections, GroupByMonth)
+	require.Len(t, grouped, 3)
+	assert.Equal(t, "April 2016", grouped[0].Header)
+	assert.Equal(t, []string{"d2", "w2"}, keys(grouped[0]))
+	assert.Equal(t, "March 2016", grouped[1].Header)
+	assert.Equal(t, []string{"d1", "w1"}, keys(grouped[1]))
+	assert.Equal(t, "February 2016", grouped[2].Header)
+
+	grouped = groupSections(sections, GroupByMajorVersion)
+	require.Len(t, grouped, 3)
+	assert.Equal(t, "2.x", grouped[0].Header)
+	assert.Equal(t, "1.x", grouped[1].Header)
+	assert.Equal(t, []string{"d1", "w1"}, keys(grouped[1]))
+	assert.Equal(t, "Other", grouped[2].Header)
+
+	// Ties are ordered by header
+	grouped = groupSections(sections, func(r Release) string { return r.Key[:1] })
+	require.Len(t, grouped, 2)
+	assert.Equal(t, "d", grouped[0].Header)
+	assert.Equal(t, "w", grouped[1].Header)
+}
+
+func TestWriteHTMLGrouping(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestWriteHTMLGrouping")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	f := newFakeS3()
+	f.Put(testBucket, "darwin/Keybase-1.0.15-20160313013917+ab12cd3.dmg", "dmg", time.Now())
+	f.Put(testBucket, "windows/Keybase_2.0.0-20160402013917+ef56ab7.amd64.msi", "msi", time.Now())
+	c := newTestClient(f)
+	c.HTMLGrouping = GroupByMajorVersion
+	outPath := filepath.Join(dir, "index.html")
+	require.NoError(t, c.WriteHTML(testBucket, "darwin/,windows/", "", outPath, ""))
+	data, err := ioutil.ReadFile(outPath)
+	require.NoError(t, err)
+	html := string(data)
+	assert.NotContains(t, html, "darwin/</h3>")
+	require.Contains(t, html, "2.x")
+	require.Contains(t, html, "1.x")
+	assert.True(t, strings.Index(html, "2.x") < strings.Index(html, "1.x"))
+}
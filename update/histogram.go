@@ -0,0 +1,101 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"fmt"
+	"time"
+)
+
+// histogramKey is the bucket a release date falls in: the day (2016-03-13)
+// or ISO week (2016-W10), in Eastern time like release dates
+func histogramKey(date time.Time, bucketBy string) (string, error) {
+	switch bucketBy {
+	case "day":
+		return date.Format("2006-01-02"), nil
+	case "week":
+		year, week := date.ISOWeek()
+		return fmt.Sprintf("%04d-W%02d", year, week), nil
+	default:
+		return "", fmt.Errorf("Invalid histogram bucket %q, must be day or week", bucketBy)
+	}
+}
+
+// ReleaseHistogram counts the releases at a prefix per day or week
+// (bucketBy), for release cadence charts. Releases without a date are left
+// out.
+func (c *Client) ReleaseHistogram(bucketName string, prefix string, suffix string, bucketBy string) (map[string]int, error) {
+	if _, err := histogramKey(time.Time{}, bucketBy); err != nil {
+		return nil, err
+	}
+	releases, err := c.ListReleases(bucketName, prefix, suffix)
+	if err != nil {
+		return nil, err
+	}
+	histogram := map[string]int{}
+	for _, release := range releases {
+		if release.Date.IsZero() {
+			continue
+		}
+		key, err := histogramKey(release.Date, bucketBy)
+		if err != nil {
+			return nil, err
+		}
+		histogram[key]++
+	}
+	return histogram, nil
+}
+
+// CadenceStats is how often releases have been made
+type CadenceStats struct {
+	// Releases is how many releases were made in the window
+	Releases int
+	// AverageInterval is the average time between releases in the window, or
+	// 0 if there were fewer than two
+	AverageInterval time.Duration
+	// SinceLast is how long ago the last release was made, or 0 if there are
+	// no releases
+	SinceLast time.Duration
+}
+
+// ReleaseCadence returns how many releases at a prefix were made in the last
+// window, how far apart they were on average, and how long ago the last one
+// was, for alerting when releases stall. Releases without a date are left
+// out.
+func (c *Client) ReleaseCadence(bucketName string, prefix string, suffix string, window time.Duration) (*CadenceStats, error) {
+	if window <= 0 {
+		return nil, fmt.Errorf("Invalid cadence window %s", window)
+	}
+	releases, err := c.ListReleases(bucketName, prefix, suffix)
+	if err != nil {
+		return nil, err
+	}
+	now := timeNow()
+	var stats CadenceStats
+	var last, newest, oldest time.Time
+	// Releases are newest first
+	for _, release := range releases {
+		if release.Date.IsZero() {
+			continue
+		}
+		if last.IsZero() {
+			last = release.Date
+		}
+		if now.Sub(release.Date) > window {
+			continue
+		}
+		if newest.IsZero() {
+			newest = release.Date
+		}
+		oldest = release.Date
+		stats.Releases++
+	}
+	if !last.IsZero() {
+		stats.SinceLast = now.Sub(last)
+	}
+	if stats.Releases >= 2 {
+		stats.AverageInterval = newest.Sub(oldest) / time.Duration(stats.Releases-1)
+	}
+	return &stats, nil
+}
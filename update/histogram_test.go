@@ -0,0 +1,85 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/keybase/release/update/s3test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func seedMarchReleases(f *s3test.Bucket) {
+	// A release at noon UTC on each odd day of March 2016, and two on the 1st
+	for day := 1; day <= 31; day += 2 {
+		f.Put(testBucket, fmt.Sprintf("darwin/Keybase-1.0.%d-201603%02d120000+ab12cd3.dmg", day, day), "dmg", time.Now())
+	}
+	f.Put(testBucket, "darwin/Keybase-1.0.0-20160301130000+cd6f696.dmg", "dmg", time.Now())
+	f.Put(testBucket, "darwin/Keybase-invalid.dmg", "dmg", time.Now())
+}
+
+func TestReleaseHistogramDay(t *testing.T) {
+	f := newFakeS3()
+	seedMarchReleases(f)
+	c := newTestClient(f)
+
+	histogram, err := c.ReleaseHistogram(testBucket, "darwin/", "", "day")
+	require.NoError(t, err)
+	assert.Len(t, histogram, 16)
+	assert.Equal(t, 2, histogram["2016-03-01"])
+	assert.Equal(t, 1, histogram["2016-03-31"])
+	assert.Equal(t, 0, histogram["2016-03-02"])
+}
+
+func TestReleaseHistogramWeek(t *testing.T) {
+	f := newFakeS3()
+	seedMarchReleases(f)
+	c := newTestClient(f)
+
+	histogram, err := c.ReleaseHistogram(testBucket, "darwin/", "", "week")
+	require.NoError(t, err)
+	// March 1st 2016 is a Tuesday in ISO week 9
+	assert.Equal(t, map[string]int{
+		"2016-W09": 4, // 1 (x2), 3, 5
+		"2016-W10": 4, // 7, 9, 11, 13
+		"2016-W11": 3, // 15, 17, 19
+		"2016-W12": 4, // 21, 23, 25, 27
+		"2016-W13": 2, // 29, 31
+	}, histogram)
+
+	_, err = c.ReleaseHistogram(testBucket, "darwin/", "", "month")
+	require.Error(t, err)
+}
+
+func TestReleaseCadence(t *testing.T) {
+	now := time.Date(2016, 4, 1, 12, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+	f := newFakeS3()
+	seedMarchReleases(f)
+	c := newTestClient(f)
+	day := 24 * time.Hour
+
+	// The 25th, 27th, 29th and 31st
+	stats, err := c.ReleaseCadence(testBucket, "darwin/", "", 7*day)
+	require.NoError(t, err)
+	assert.Equal(t, CadenceStats{Releases: 4, AverageInterval: 2 * day, SinceLast: day}, *stats)
+
+	// Fewer than two releases
+	stats, err = c.ReleaseCadence(testBucket, "darwin/", "", 2*day)
+	require.NoError(t, err)
+	assert.Equal(t, CadenceStats{Releases: 1, SinceLast: day}, *stats)
+	stats, err = c.ReleaseCadence(testBucket, "darwin/", "", time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, CadenceStats{SinceLast: day}, *stats)
+	stats, err = c.ReleaseCadence(testBucket, "windows/", "", 7*day)
+	require.NoError(t, err)
+	assert.Equal(t, CadenceStats{}, *stats)
+
+	_, err = c.ReleaseCadence(testBucket, "darwin/", "", 0)
+	require.Error(t, err)
+}
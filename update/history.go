@@ -0,0 +1,388 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/blang/semver"
+)
+
+// platformForName returns the single platform for a name, failing for names
+// that cover more than one platform (linux).
+func platformForName(platformName string) (Platform, error) {
+	platforms, err := Platforms(platformName)
+	if err != nil {
+		return Platform{}, err
+	}
+	if len(platforms) != 1 {
+		return Platform{}, fmt.Errorf("Platform %q is not a single platform", platformName)
+	}
+	return platforms[0], nil
+}
+
+// SupportUpdateName is the name of the versioned update JSON in the support
+// prefix for a platform.
+func SupportUpdateName(platformName string, env string, version string) string {
+	return fmt.Sprintf("update-%s-%s-%s.json", platformName, env, version)
+}
+
+// GetUpdateHistory returns the updates for a platform and env, from the
+// versioned update JSONs in the support prefix, sorted by version (oldest
+// first). Entries that can't be decoded are skipped. An empty env is the bucket
+// config's.
+func (c *Client) GetUpdateHistory(bucketName string, platformName string, env string) ([]*Update, error) {
+	platform, err := platformForName(platformName)
+	if err != nil {
+		return nil, err
+	}
+	env, err = c.envDefault(bucketName, env)
+	if err != nil {
+		return nil, err
+	}
+	if platform.PrefixSupport == "" {
+		return nil, fmt.Errorf("No support prefix for %s", platform.Name)
+	}
+
+	objs, err := c.listAllObjects(bucketName, platform.PrefixSupport)
+	if err != nil {
+		return nil, err
+	}
+
+	namePrefix := fmt.Sprintf("update-%s-%s-", platform.Name, env)
+	type versionedUpdate struct {
+		update  *Update
+		version semver.Version
+	}
+	var updates []versionedUpdate
+	for _, obj := range objs {
+		_, name := urlStringForKey(*obj.Key, bucketName, platform.PrefixSupport)
+		if !strings.HasPrefix(name, namePrefix) || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		upd, err := c.getUpdate(bucketName, *obj.Key)
+		if err != nil {
+			c.logf(VerbosityQuiet, "Skipping %s, couldn't decode update: %s", *obj.Key, err)
+			continue
+		}
+		ver, err := semver.Make(upd.Version)
+		if err != nil {
+			c.logf(VerbosityQuiet, "Skipping %s, invalid version %q: %s", *obj.Key, upd.Version, err)
+			continue
+		}
+		updates = append(updates, versionedUpdate{update: upd, version: ver})
+	}
+
+	sort.SliceStable(updates, func(i, j int) bool {
+		return updates[i].version.LT(updates[j].version)
+	})
+	history := make([]*Update, 0, len(updates))
+	for _, u := range updates {
+		history = append(history, u.update)
+	}
+	return history, nil
+}
+
+// supportUpdateVersions returns the keys of the versioned update JSONs in the
+// support prefix for a platform and env, by version
+func (c *Client) supportUpdateVersions(bucketName string, platform Platform, env string) (map[string]string, error) {
+	objs, err := c.listAllObjects(bucketName, platform.PrefixSupport)
+	if err != nil {
+		return nil, err
+	}
+	namePrefix := fmt.Sprintf("update-%s-%s-", platform.Name, env)
+	keys := map[string]string{}
+	for _, obj := range objs {
+		_, name := urlStringForKey(*obj.Key, bucketName, platform.PrefixSupport)
+		if !strings.HasPrefix(name, namePrefix) || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		version := strings.TrimSuffix(strings.TrimPrefix(name, namePrefix), ".json")
+		keys[version] = *obj.Key
+	}
+	return keys, nil
+}
+
+// OrphanedSupportUpdates returns the keys of versioned update JSONs that are
+// safe to delete: those older than what every served channel (the default
+// channels, the bucket config's, the rings' and any other with an update JSON)
+// is at. A version at or newer than the oldest channel's might still be
+// promoted, even if it has no release yet (its update JSON can be uploaded
+// first), so it's never flagged, and nothing is flagged if no channel has been
+// promoted. An empty env is the bucket config's.
+func (c *Client) OrphanedSupportUpdates(bucketName string, platformName string, env string) ([]string, error) {
+	platform, err := platformForName(platformName)
+	if err != nil {
+		return nil, err
+	}
+	if platform.PrefixSupport == "" {
+		return nil, fmt.Errorf("No support prefix for %s", platform.Name)
+	}
+	env, err = c.envDefault(bucketName, env)
+	if err != nil {
+		return nil, err
+	}
+
+	channels, err := c.servedChannels(bucketName, platform.Name, env)
+	if err != nil {
+		return nil, err
+	}
+	var oldestCurrent *semver.Version
+	for _, channel := range channels {
+		upd, _, err := c.CurrentUpdate(bucketName, channel, platform.Name, env)
+		if isNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		ver, err := semver.Make(upd.Version)
+		if err != nil {
+			return nil, err
+		}
+		if oldestCurrent == nil || ver.LT(*oldestCurrent) {
+			oldestCurrent = &ver
+		}
+	}
+	if oldestCurrent == nil {
+		return nil, nil
+	}
+
+	supportKeys, err := c.supportUpdateVersions(bucketName, platform, env)
+	if err != nil {
+		return nil, err
+	}
+	var orphans []string
+	for version, key := range supportKeys {
+		ver, err := semver.Make(version)
+		if err != nil {
+			c.logf(VerbosityQuiet, "Not pruning %s, invalid version: %s", key, err)
+			continue
+		}
+		if ver.LT(*oldestCurrent) {
+			orphans = append(orphans, key)
+		}
+	}
+	sort.Strings(orphans)
+	return orphans, nil
+}
+
+// ReleasesMissingSupport returns the releases for a platform (newest first)
+// that have no versioned update JSON in the support prefix, so they can't be
+// promoted yet. Releases without a version are left out. An empty env is the
+// bucket config's.
+func (c *Client) ReleasesMissingSupport(bucketName string, platformName string, env string) ([]Release, error) {
+	platform, err := platformForName(platformName)
+	if err != nil {
+		return nil, err
+	}
+	if platform.PrefixSupport == "" {
+		return nil, fmt.Errorf("No support prefix for %s", platform.Name)
+	}
+	env, err = c.envDefault(bucketName, env)
+	if err != nil {
+		return nil, err
+	}
+
+	releases, err := c.ListReleases(bucketName, platform.Prefix, platform.Suffix)
+	if err != nil {
+		return nil, err
+	}
+	supportKeys, err := c.supportUpdateVersions(bucketName, platform, env)
+	if err != nil {
+		return nil, err
+	}
+	missing := []Release{}
+	for _, release := range releases {
+		if release.Version == "" {
+			c.logf(VerbosityVerbose, "Skipping %s, no version", release.Key)
+			continue
+		}
+		if _, ok := supportKeys[release.Version]; !ok {
+			missing = append(missing, release)
+		}
+	}
+	return missing, nil
+}
+
+// PendingReleases returns the releases for a platform newer (by version) than
+// what a channel currently serves, newest first. If the channel has no
+// current update, all releases are pending. An empty env, or a channel of
+// ConfigChannel, is the bucket config's.
+func (c *Client) PendingReleases(bucketName string, platformName string, env string, channel string) ([]Release, error) {
+	channel, env, err := c.channelEnvDefaults(bucketName, channel, env)
+	if err != nil {
+		return nil, err
+	}
+	return c.pendingReleases(bucketName, platformName, env, channel)
+}
+
+func (c *Client) pendingReleases(bucketName string, platformName string, env string, channel string) ([]Release, error) {
+	platform, err := platformForName(platformName)
+	if err != nil {
+		return nil, err
+	}
+	releases, err := c.ListReleases(bucketName, platform.Prefix, platform.Suffix)
+	if err != nil {
+		return nil, err
+	}
+
+	currentUpdate, _, err := c.CurrentUpdate(bucketName, channel, platform.Name, env)
+	if isNotFound(err) {
+		return releases, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	currentVer, err := semver.Make(currentUpdate.Version)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid current version %q: %s", currentUpdate.Version, err)
+	}
+
+	pending := []Release{}
+	for _, release := range releases {
+		ver, err := semver.Make(release.Version)
+		if err != nil {
+			c.logf(VerbosityQuiet, "Skipping %s, invalid version %q: %s", release.Key, release.Version, err)
+			continue
+		}
+		if ver.GT(currentVer) {
+			pending = append(pending, release)
+		}
+	}
+	return pending, nil
+}
+
+// VersionCandidates are the smallest pending releases that bump each part of
+// a channel's version. A candidate is nil if no pending release bumps it.
+type VersionCandidates struct {
+	// Current is the version the channel is at
+	Current string
+	// Patch has the same major and minor version (a newer patch or build)
+	Patch *Release
+	// Minor has the same major version
+	Minor *Release
+	// Major has a newer major version
+	Major *Release
+}
+
+// Next returns the smallest increment, the release to promote next, or nil if
+// there are no pending releases
+func (v VersionCandidates) Next() *Release {
+	for _, release := range []*Release{v.Patch, v.Minor, v.Major} {
+		if release != nil {
+			return release
+		}
+	}
+	return nil
+}
+
+// NextVersionCandidates returns the pending releases that are the next patch,
+// minor and major version after what a channel serves. The channel must have
+// a current update. An empty env, or a channel of ConfigChannel, is the bucket
+// config's.
+func (c *Client) NextVersionCandidates(bucketName string, channel string, platformName string, env string) (*VersionCandidates, error) {
+	channel, env, err := c.channelEnvDefaults(bucketName, channel, env)
+	if err != nil {
+		return nil, err
+	}
+	currentUpdate, path, err := c.CurrentUpdate(bucketName, channel, platformName, env)
+	if isNotFound(err) {
+		return nil, fmt.Errorf("No current update at %s", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	currentVer, err := semver.Make(currentUpdate.Version)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid current version %q: %s", currentUpdate.Version, err)
+	}
+	pending, err := c.pendingReleases(bucketName, platformName, env, channel)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := VersionCandidates{Current: currentUpdate.Version}
+	var patchVer, minorVer, majorVer semver.Version
+	for i := range pending {
+		release := &pending[i]
+		ver, err := semver.Make(release.Version)
+		if err != nil {
+			continue
+		}
+		switch {
+		case ver.Major == currentVer.Major && ver.Minor == currentVer.Minor:
+			if candidates.Patch == nil || ver.LT(patchVer) {
+				candidates.Patch, patchVer = release, ver
+			}
+		case ver.Major == currentVer.Major:
+			if candidates.Minor == nil || ver.LT(minorVer) {
+				candidates.Minor, minorVer = release, ver
+			}
+		default:
+			if candidates.Major == nil || ver.LT(majorVer) {
+				candidates.Major, majorVer = release, ver
+			}
+		}
+	}
+	return &candidates, nil
+}
+
+// firstVersionForCommit looks up a commit in a commit to first version
+// mapping, matching abbreviated commits either way
+func firstVersionForCommit(commit string, firstVersions map[string]string) (string, error) {
+	commit = strings.ToLower(commit)
+	if commit == "" {
+		return "", fmt.Errorf("No commit")
+	}
+	var found []string
+	for c, version := range firstVersions {
+		c = strings.ToLower(c)
+		if c != "" && (strings.HasPrefix(c, commit) || strings.HasPrefix(commit, c)) {
+			found = append(found, version)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return "", fmt.Errorf("No first version for commit %s", commit)
+	case 1:
+		return found[0], nil
+	default:
+		return "", fmt.Errorf("Commit %s is ambiguous", commit)
+	}
+}
+
+// ListReleasesByCommitPresence returns, by platform, the releases that have a
+// commit: those at or after the first version with it (by semver). There's
+// no git here, so firstVersions maps commits to the first version with them.
+// Releases without a valid version are left out.
+func (c *Client) ListReleasesByCommitPresence(bucketName string, commit string, firstVersions map[string]string) (map[string][]Release, error) {
+	firstVersion, err := firstVersionForCommit(commit, firstVersions)
+	if err != nil {
+		return nil, err
+	}
+	firstVer, err := semver.Make(firstVersion)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid first version %q for %s: %s", firstVersion, commit, err)
+	}
+	byPlatform := map[string][]Release{}
+	for _, platform := range platformsAll {
+		releases, err := c.ListReleases(bucketName, platform.Prefix, platform.Suffix)
+		if err != nil {
+			return nil, err
+		}
+		for _, release := range releases {
+			ver, err := semver.Make(release.Version)
+			if err != nil {
+				continue
+			}
+			if ver.GTE(firstVer) {
+				byPlatform[platform.Name] = append(byPlatform[platform.Name], release)
+			}
+		}
+	}
+	return byPlatform, nil
+}
@@ -0,0 +1,239 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/keybase/release/update/s3test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func putUpdateJSON(f *s3test.Bucket, bucketName string, key string, version string) {
+	f.Put(bucketName, key, fmt.Sprintf(`{"version": %q, "name": "v%s"}`, version, version), time.Now())
+}
+
+func TestGetUpdateHistory(t *testing.T) {
+	f := newFakeS3()
+	bucket := "test-bucket"
+	putUpdateJSON(f, bucket, "darwin-support/update-darwin-prod-1.0.10-20160301000000+aaaaaaa.json", "1.0.10-20160301000000+aaaaaaa")
+	putUpdateJSON(f, bucket, "darwin-support/update-darwin-prod-1.0.9-20160201000000+bbbbbbb.json", "1.0.9-20160201000000+bbbbbbb")
+	putUpdateJSON(f, bucket, "darwin-support/update-darwin-prod-1.0.11-20160401000000+ccccccc.json", "1.0.11-20160401000000+ccccccc")
+	putUpdateJSON(f, bucket, "darwin-support/update-darwin-staging-1.0.12-20160501000000+ddddddd.json", "1.0.12-20160501000000+ddddddd")
+	f.Put(bucket, "darwin-support/update-darwin-prod-1.0.13-20160601000000+eeeeeee.json", "not json", time.Now())
+
+	history, err := newTestClient(f).GetUpdateHistory(bucket, PlatformTypeDarwin, "prod")
+	require.NoError(t, err)
+	require.Len(t, history, 3)
+	assert.Equal(t, "1.0.9-20160201000000+bbbbbbb", history[0].Version)
+	assert.Equal(t, "1.0.10-20160301000000+aaaaaaa", history[1].Version)
+	assert.Equal(t, "1.0.11-20160401000000+ccccccc", history[2].Version)
+}
+
+func TestGetUpdateHistoryNoSupportPrefix(t *testing.T) {
+	_, err := newTestClient(newFakeS3()).GetUpdateHistory("test-bucket", PlatformTypeLinux, "prod")
+	require.Error(t, err)
+}
+
+func TestOrphanedSupportUpdates(t *testing.T) {
+	f := newFakeS3()
+	old := "1.0.9-20160201000000+bbbbbbb"
+	current := "1.0.10-20160301000000+aaaaaaa"
+	beta := "1.0.11-20160401000000+ccccccc"
+	pending := "1.0.12-20160501000000+ddddddd"
+	noRelease := "1.0.13-20160601000000+eeeeeee"
+	for _, version := range []string{old, current, beta, pending} {
+		seedDarwinRelease(f, version)
+	}
+	putUpdateJSON(f, testBucket, "darwin-support/"+SupportUpdateName(PlatformTypeDarwin, "prod", noRelease), noRelease)
+	c := newTestClient(f)
+	require.NoError(t, c.PromoteSpecificVersion(testBucket, current, "v2", PlatformTypeDarwin, "prod", false))
+	require.NoError(t, c.PromoteSpecificVersion(testBucket, beta, "test-v2", PlatformTypeDarwin, "prod", false))
+
+	// noRelease is newer than every channel, so its release might still be
+	// uploaded
+	oldKey := "darwin-support/" + SupportUpdateName(PlatformTypeDarwin, "prod", old)
+	orphans, err := c.OrphanedSupportUpdates(testBucket, PlatformTypeDarwin, "prod")
+	require.NoError(t, err)
+	assert.Equal(t, []string{oldKey}, orphans)
+
+	// Deleting the current release still doesn't flag its update JSON
+	f.Delete(testBucket, "darwin/Keybase-"+current+".dmg")
+	orphans, err = c.OrphanedSupportUpdates(testBucket, PlatformTypeDarwin, "prod")
+	require.NoError(t, err)
+	assert.Equal(t, []string{oldKey}, orphans)
+
+	// An empty env is the bucket config's (prod)
+	orphans, err = c.OrphanedSupportUpdates(testBucket, PlatformTypeDarwin, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{oldKey}, orphans)
+}
+
+func TestOrphanedSupportUpdatesNoChannels(t *testing.T) {
+	f := newFakeS3()
+	seedDarwinRelease(f, "1.0.9-20160201000000+bbbbbbb")
+	noRelease := "1.0.13-20160601000000+eeeeeee"
+	putUpdateJSON(f, testBucket, "darwin-support/"+SupportUpdateName(PlatformTypeDarwin, "prod", noRelease), noRelease)
+
+	orphans, err := newTestClient(f).OrphanedSupportUpdates(testBucket, PlatformTypeDarwin, "prod")
+	require.NoError(t, err)
+	assert.Empty(t, orphans)
+}
+
+func TestOrphanedSupportUpdatesRingChannel(t *testing.T) {
+	f := newFakeS3()
+	old := "1.0.9-20160201000000+bbbbbbb"
+	ring := "1.0.10-20160301000000+aaaaaaa"
+	current := "1.0.11-20160401000000+ccccccc"
+	for _, version := range []string{old, ring, current} {
+		seedDarwinRelease(f, version)
+	}
+	c := newTestClient(f)
+	require.NoError(t, c.PromoteSpecificVersion(testBucket, current, "v2", PlatformTypeDarwin, "prod", false))
+	require.NoError(t, c.PromoteRing(testBucket, "ring0", old, PlatformTypeDarwin, "prod"))
+	// A channel only found by listing
+	require.NoError(t, c.PromoteSpecificVersion(testBucket, ring, "nightly", PlatformTypeDarwin, "prod", false))
+
+	orphans, err := c.OrphanedSupportUpdates(testBucket, PlatformTypeDarwin, "prod")
+	require.NoError(t, err)
+	assert.Empty(t, orphans)
+
+	// Once the ring moves on, old isn't served
+	require.NoError(t, c.PromoteRing(testBucket, "ring0", current, PlatformTypeDarwin, "prod"))
+	orphans, err = c.OrphanedSupportUpdates(testBucket, PlatformTypeDarwin, "prod")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"darwin-support/" + SupportUpdateName(PlatformTypeDarwin, "prod", old)}, orphans)
+}
+
+func TestReleasesMissingSupport(t *testing.T) {
+	f := newFakeS3()
+	complete := "1.0.14-20160312013917+cd6f696"
+	incomplete := "1.0.15-20160313013917+ab12cd3"
+	seedDarwinRelease(f, complete)
+	f.Put(testBucket, "darwin/Keybase-"+incomplete+".dmg", "dmg", time.Now())
+	// A JSON for another env doesn't count
+	putUpdateJSON(f, testBucket, "darwin-support/"+SupportUpdateName(PlatformTypeDarwin, "staging", incomplete), incomplete)
+	f.Put(testBucket, "darwin/Keybase-unversioned.dmg", "dmg", time.Now())
+	c := newTestClient(f)
+
+	missing, err := c.ReleasesMissingSupport(testBucket, PlatformTypeDarwin, "prod")
+	require.NoError(t, err)
+	require.Len(t, missing, 1)
+	assert.Equal(t, incomplete, missing[0].Version)
+
+	missing, err = c.ReleasesMissingSupport(testBucket, PlatformTypeDarwin, "staging")
+	require.NoError(t, err)
+	require.Len(t, missing, 1)
+	assert.Equal(t, complete, missing[0].Version)
+}
+
+func TestPendingReleases(t *testing.T) {
+	f := newFakeS3()
+	for _, version := range []string{
+		"1.0.13-20160311013917+eeeeeee",
+		"1.0.14-20160312013917+cd6f696",
+		"1.0.15-20160313013917+ab12cd3",
+		"1.0.16-20160314013917+ef01234",
+	} {
+		seedDarwinRelease(f, version)
+	}
+	c := newTestClient(f)
+
+	pending, err := c.PendingReleases(testBucket, PlatformTypeDarwin, "prod", "v2")
+	require.NoError(t, err)
+	assert.Len(t, pending, 4)
+
+	require.NoError(t, c.PromoteSpecificVersion(testBucket, "1.0.14-20160312013917+cd6f696", "v2", PlatformTypeDarwin, "prod", false))
+	pending, err = c.PendingReleases(testBucket, PlatformTypeDarwin, "prod", "v2")
+	require.NoError(t, err)
+	require.Len(t, pending, 2)
+	assert.Equal(t, "1.0.16-20160314013917+ef01234", pending[0].Version)
+	assert.Equal(t, "1.0.15-20160313013917+ab12cd3", pending[1].Version)
+
+	require.NoError(t, c.PromoteSpecificVersion(testBucket, "1.0.16-20160314013917+ef01234", "v2", PlatformTypeDarwin, "prod", false))
+	pending, err = c.PendingReleases(testBucket, PlatformTypeDarwin, "prod", "v2")
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+}
+
+func TestNextVersionCandidates(t *testing.T) {
+	f := newFakeS3()
+	for _, version := range []string{
+		"1.0.14-20160312013917+cd6f696",
+		"1.0.16-20160314013917+ef01234",
+		"1.0.15-20160313013917+ab12cd3",
+		"1.2.0-20160315013917+aaaaaaa",
+		"1.1.0-20160316013917+bbbbbbb",
+		"2.0.0-20160317013917+ccccccc",
+	} {
+		seedDarwinRelease(f, version)
+	}
+	c := newTestClient(f)
+
+	_, err := c.NextVersionCandidates(testBucket, "v2", PlatformTypeDarwin, "prod")
+	require.Error(t, err)
+
+	require.NoError(t, c.PromoteSpecificVersion(testBucket, "1.0.14-20160312013917+cd6f696", "v2", PlatformTypeDarwin, "prod", false))
+	candidates, err := c.NextVersionCandidates(testBucket, "v2", PlatformTypeDarwin, "prod")
+	require.NoError(t, err)
+	assert.Equal(t, "1.0.14-20160312013917+cd6f696", candidates.Current)
+	assert.Equal(t, "1.0.15-20160313013917+ab12cd3", candidates.Patch.Version)
+	assert.Equal(t, "1.1.0-20160316013917+bbbbbbb", candidates.Minor.Version)
+	assert.Equal(t, "2.0.0-20160317013917+ccccccc", candidates.Major.Version)
+	assert.Equal(t, candidates.Patch, candidates.Next())
+
+	require.NoError(t, c.PromoteSpecificVersion(testBucket, "1.2.0-20160315013917+aaaaaaa", "v2", PlatformTypeDarwin, "prod", false))
+	candidates, err = c.NextVersionCandidates(testBucket, "v2", PlatformTypeDarwin, "prod")
+	require.NoError(t, err)
+	assert.Nil(t, candidates.Patch)
+	assert.Nil(t, candidates.Minor)
+	assert.Equal(t, "2.0.0-20160317013917+ccccccc", candidates.Next().Version)
+
+	require.NoError(t, c.PromoteSpecificVersion(testBucket, "2.0.0-20160317013917+ccccccc", "v2", PlatformTypeDarwin, "prod", false))
+	candidates, err = c.NextVersionCandidates(testBucket, "v2", PlatformTypeDarwin, "prod")
+	require.NoError(t, err)
+	assert.Nil(t, candidates.Next())
+}
+
+func TestListReleasesByCommitPresence(t *testing.T) {
+	f := newFakeS3()
+	f.Put(testBucket, "darwin/Keybase-1.0.14-20160312013917+cd6f696.dmg", "dmg", time.Now())
+	f.Put(testBucket, "darwin/Keybase-1.0.15-20160313013917+ab12cd3.dmg", "dmg", time.Now())
+	f.Put(testBucket, "darwin/Keybase-1.0.16-20160314013917+ef56ab7.dmg", "dmg", time.Now())
+	f.Put(testBucket, "darwin/Keybase-invalid.dmg", "dmg", time.Now())
+	f.Put(testBucket, "windows/Keybase_1.0.14-20160312013917+cd6f696.amd64.msi", "msi", time.Now())
+	f.Put(testBucket, "windows/Keybase_1.0.15-20160313013917+ab12cd3.amd64.msi", "msi", time.Now())
+	c := newTestClient(f)
+	firstVersions := map[string]string{
+		"ab12cd34ef56ab12cd34ef56ab12cd34ef56ab12": "1.0.15-20160313013917+ab12cd3",
+		"0123456789abcdef0123456789abcdef01234567": "1.0.17",
+	}
+
+	shipped, err := c.ListReleasesByCommitPresence(testBucket, "ab12cd3", firstVersions)
+	require.NoError(t, err)
+	require.Len(t, shipped[PlatformTypeDarwin], 2)
+	assert.Equal(t, "1.0.16-20160314013917+ef56ab7", shipped[PlatformTypeDarwin][0].Version)
+	assert.Equal(t, "1.0.15-20160313013917+ab12cd3", shipped[PlatformTypeDarwin][1].Version)
+	require.Len(t, shipped[PlatformTypeWindows], 1)
+	assert.Equal(t, "1.0.15-20160313013917+ab12cd3", shipped[PlatformTypeWindows][0].Version)
+	_, ok := shipped[PlatformTypeLinux]
+	assert.False(t, ok)
+
+	// Not shipped yet
+	shipped, err = c.ListReleasesByCommitPresence(testBucket, "0123456789abcdef0123456789abcdef01234567", firstVersions)
+	require.NoError(t, err)
+	assert.Empty(t, shipped)
+
+	_, err = c.ListReleasesByCommitPresence(testBucket, "deadbee", firstVersions)
+	require.Error(t, err)
+	_, err = c.ListReleasesByCommitPresence(testBucket, "", firstVersions)
+	require.Error(t, err)
+	// Ambiguous
+	firstVersions["ab12ffff00000000000000000000000000000000"] = "1.0.16-20160314013917+ef56ab7"
+	_, err = c.ListReleasesByCommitPresence(testBucket, "ab12", firstVersions)
+	require.Error(t, err)
+}
@@ -0,0 +1,93 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	releaseVersion "github.com/keybase/release/version"
+)
+
+// buildTime is when the build for an update was made, its publishedAt or the
+// date in its version
+func (c *Client) buildTime(upd *Update) (time.Time, error) {
+	if upd.PublishedAt != nil {
+		return FromTime(*upd.PublishedAt), nil
+	}
+	_, _, date, _, err := releaseVersion.Parser{DateLayout: c.NameDateLayout}.ParseInLocation(upd.Version, c.nameDateLocation())
+	if err != nil {
+		return time.Time{}, err
+	}
+	if date.IsZero() {
+		return time.Time{}, fmt.Errorf("No date in version %s", upd.Version)
+	}
+	return date, nil
+}
+
+// PromotionLagStats returns the average, shortest and longest time between a
+// build and its promotion to a channel, for each version the channel has
+// served. Promotions are from the versions of the channel's update JSON (the
+// first one with each version), so the bucket needs versioning for more than
+// the current promotion. An empty env, or a channel of ConfigChannel, is the
+// bucket config's.
+func (c *Client) PromotionLagStats(bucketName string, platform string, env string, channel string) (avg time.Duration, min time.Duration, max time.Duration, err error) {
+	channel, env, err = c.channelEnvDefaults(bucketName, channel, env)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	jsonName := UpdateJSONName(channel, platform, env)
+	versions, err := c.ListObjectVersions(bucketName, jsonName)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	promoted := map[string]bool{}
+	var total time.Duration
+	var count int
+	// Versions are newest first
+	for i := len(versions) - 1; i >= 0; i-- {
+		v := versions[i]
+		if v.IsDeleteMarker {
+			continue
+		}
+		data, err := c.GetObjectVersion(bucketName, jsonName, v.VersionID)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		upd, err := DecodeJSON(bytes.NewReader(data))
+		if err != nil {
+			c.logf(VerbosityNormal, "Skipping %s version %s, couldn't decode update: %s", jsonName, v.VersionID, err)
+			continue
+		}
+		if promoted[upd.Version] {
+			continue
+		}
+		promoted[upd.Version] = true
+		built, err := c.buildTime(upd)
+		if err != nil {
+			c.logf(VerbosityNormal, "Skipping %s, no build time: %s", upd.Version, err)
+			continue
+		}
+		lag := v.LastModified.Sub(built)
+		if lag < 0 {
+			c.logf(VerbosityNormal, "Skipping %s, promoted (%s) before it was built (%s)", upd.Version, v.LastModified, built)
+			continue
+		}
+		c.logf(VerbosityVerbose, "%s was promoted after %s", upd.Version, lag)
+		if count == 0 || lag < min {
+			min = lag
+		}
+		if lag > max {
+			max = lag
+		}
+		total += lag
+		count++
+	}
+	if count == 0 {
+		return 0, 0, 0, fmt.Errorf("No promotions found at %s", jsonName)
+	}
+	return total / time.Duration(count), min, max, nil
+}
@@ -0,0 +1,48 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/keybase/release/update/s3test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPromotionLagStats(t *testing.T) {
+	f := newFakeS3()
+	c := newTestClient(f)
+	jsonName := UpdateJSONName("v2", PlatformTypeDarwin, "prod")
+
+	_, _, _, err := c.PromotionLagStats(testBucket, PlatformTypeDarwin, "prod", "v2")
+	require.EqualError(t, err, "No promotions found at "+jsonName)
+
+	built14 := time.Date(2016, 3, 12, 1, 39, 17, 0, time.UTC)
+	built15 := time.Date(2016, 3, 13, 1, 39, 17, 0, time.UTC)
+	published16 := time.Date(2016, 3, 15, 0, 0, 0, 0, time.UTC)
+	updateBody := func(version string) string {
+		return fmt.Sprintf(`{"version": %q}`, version)
+	}
+	f.ObjectVersions = map[string][]s3test.Version{
+		jsonName: {
+			{ID: "a", Body: updateBody("1.0.14-20160312013917+cd6f696"), LastModified: built14.Add(27 * time.Hour)},
+			// Rewriting the same version isn't another promotion
+			{ID: "b", Body: updateBody("1.0.14-20160312013917+cd6f696"), LastModified: built14.Add(50 * time.Hour)},
+			{ID: "c", Body: "not json", LastModified: built14.Add(51 * time.Hour)},
+			{ID: "d", Body: updateBody("1.0.15-20160313013917+ab12cd3"), LastModified: built15.Add(30 * time.Hour)},
+			{ID: "e", DeleteMarker: true, LastModified: built15.Add(31 * time.Hour)},
+			// publishedAt is used before the version's date
+			{ID: "f", Body: fmt.Sprintf(`{"version": "1.0.16-20160301000000+ef01234", "publishedAt": %d}`, ToTime(published16)), LastModified: published16.Add(24 * time.Hour)},
+		},
+	}
+
+	avg, min, max, err := c.PromotionLagStats(testBucket, PlatformTypeDarwin, "prod", "v2")
+	require.NoError(t, err)
+	assert.Equal(t, 27*time.Hour, avg)
+	assert.Equal(t, 24*time.Hour, min)
+	assert.Equal(t, 30*time.Hour, max)
+}
@@ -0,0 +1,57 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// LatestAge is how long ago a platform's LatestName was copied
+type LatestAge struct {
+	Platform     string
+	LatestName   string
+	LastModified time.Time
+	Age          time.Duration
+	// Missing is true if there is no LatestName object
+	Missing bool
+	// Stale is true if LatestName is missing or older than the max age
+	Stale bool
+}
+
+// CheckLatestAges HEADs each platform's LatestName and reports whether it's
+// older than maxAge, which means CopyLatest hasn't been run (successfully)
+// since then. It doesn't need to list releases, so works even if listing
+// isn't allowed.
+func (c *Client) CheckLatestAges(bucketName string, maxAge time.Duration) ([]LatestAge, error) {
+	now := timeNow()
+	var ages []LatestAge
+	for _, platform := range platformsAll {
+		age := LatestAge{Platform: platform.Name, LatestName: platform.LatestName}
+		var resp *s3.HeadObjectOutput
+		var err error
+		c.limitFetch(func() {
+			resp, err = c.svc.HeadObject(&s3.HeadObjectInput{
+				Bucket: aws.String(bucketName),
+				Key:    aws.String(platform.LatestName),
+			})
+		})
+		if isNotFound(err) {
+			age.Missing = true
+			age.Stale = true
+			ages = append(ages, age)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		age.LastModified = aws.TimeValue(resp.LastModified)
+		age.Age = now.Sub(age.LastModified)
+		age.Stale = age.Age > maxAge
+		ages = append(ages, age)
+	}
+	return ages, nil
+}
@@ -0,0 +1,40 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckLatestAges(t *testing.T) {
+	now := time.Date(2016, 3, 14, 12, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	f := newFakeS3()
+	f.Put(testBucket, "Keybase.dmg", "dmg", now.Add(-time.Hour))
+	f.Put(testBucket, "keybase_amd64.deb", "deb", now.Add(-72*time.Hour))
+	f.Put(testBucket, "keybase_amd64.rpm", "rpm", now.Add(-72*time.Hour))
+
+	ages, err := newTestClient(f).CheckLatestAges(testBucket, 48*time.Hour)
+	require.NoError(t, err)
+	require.Len(t, ages, 4)
+
+	assert.Equal(t, "Keybase.dmg", ages[0].LatestName)
+	assert.Equal(t, time.Hour, ages[0].Age)
+	assert.False(t, ages[0].Stale)
+
+	assert.Equal(t, "deb", ages[1].Platform)
+	assert.Equal(t, 72*time.Hour, ages[1].Age)
+	assert.True(t, ages[1].Stale)
+	assert.False(t, ages[1].Missing)
+
+	assert.Equal(t, PlatformTypeWindows, ages[3].Platform)
+	assert.True(t, ages[3].Missing)
+	assert.True(t, ages[3].Stale)
+}
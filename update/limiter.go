@@ -0,0 +1,121 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultFetchConcurrency is how many auxiliary fetches (sidecars, metadata
+// HEADs) run at once if FetchConcurrency isn't set
+const defaultFetchConcurrency = 8
+
+// fetchLimits is a client's semaphore for auxiliary fetches, and its rate
+// limit if FetchRPS is set. The client's constructor makes it, and they're
+// set up on the first fetch, so Client only holds a pointer and can be copied.
+type fetchLimits struct {
+	once sync.Once
+	sem  chan struct{}
+	rate *tokenBucket
+}
+
+func (c *Client) fetchLimits() *fetchLimits {
+	c.fetch.once.Do(func() {
+		c.fetch.sem = make(chan struct{}, c.fetchConcurrency())
+		if c.FetchRPS > 0 {
+			c.fetch.rate = newTokenBucket(c.FetchRPS)
+		}
+	})
+	return c.fetch
+}
+
+// fetchLimiter is the semaphore shared by all per-object auxiliary fetches,
+// so enabling several enrichments together doesn't multiply the requests in
+// flight
+func (c *Client) fetchLimiter() chan struct{} {
+	return c.fetchLimits().sem
+}
+
+func (c *Client) fetchConcurrency() int {
+	if c.FetchConcurrency <= 0 {
+		return defaultFetchConcurrency
+	}
+	return c.FetchConcurrency
+}
+
+// enrichReleases runs enrich for every release, with FetchConcurrency
+// workers. Each release is updated in place, so the order is kept. Requests
+// in enrich should go through limitFetch, which is shared with any other
+// enrichment running at the same time.
+func (c *Client) enrichReleases(releases []Release, enrich func(r *Release)) {
+	c.forEachConcurrently(len(releases), func(i int) { enrich(&releases[i]) })
+}
+
+// forEachConcurrently runs f for 0 to n-1, with FetchConcurrency workers
+func (c *Client) forEachConcurrently(n int, f func(i int)) {
+	workers := c.fetchConcurrency()
+	if workers > n {
+		workers = n
+	}
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				f(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
+
+// limitFetch runs f once there's room in the shared fetch limiter, and (if
+// FetchRPS is set) once the rate allows another request
+func (c *Client) limitFetch(f func()) {
+	limits := c.fetchLimits()
+	limits.sem <- struct{}{}
+	defer func() { <-limits.sem }()
+	if limits.rate != nil {
+		limits.rate.wait()
+	}
+	f()
+}
+
+// tokenBucket spaces requests to a rate (per second), with a burst of one
+type tokenBucket struct {
+	mtx    sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64) *tokenBucket {
+	return &tokenBucket{rate: rate, tokens: 1, last: time.Now()}
+}
+
+// wait blocks until a token is available. Tokens are taken up front, going
+// negative, so waiters are spaced out instead of all waking at once.
+func (b *tokenBucket) wait() {
+	b.mtx.Lock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > 1 {
+		b.tokens = 1
+	}
+	b.last = now
+	b.tokens--
+	var delay time.Duration
+	if b.tokens < 0 {
+		delay = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	b.mtx.Unlock()
+	time.Sleep(delay)
+}
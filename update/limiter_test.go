@@ -0,0 +1,167 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/keybase/release/update/s3test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func maxConcurrentFetches(c *Client, n int) int {
+	var mtx sync.Mutex
+	inFlight, max := 0, 0
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.limitFetch(func() {
+				mtx.Lock()
+				inFlight++
+				if inFlight > max {
+					max = inFlight
+				}
+				mtx.Unlock()
+				time.Sleep(5 * time.Millisecond)
+				mtx.Lock()
+				inFlight--
+				mtx.Unlock()
+			})
+		}()
+	}
+	wg.Wait()
+	return max
+}
+
+func TestFetchConcurrency(t *testing.T) {
+	c := newTestClient(newFakeS3())
+	assert.Equal(t, defaultFetchConcurrency, cap(c.fetchLimiter()))
+	assert.True(t, maxConcurrentFetches(c, 20) <= defaultFetchConcurrency)
+
+	c = newTestClient(newFakeS3())
+	c.FetchConcurrency = 2
+	assert.True(t, maxConcurrentFetches(c, 20) <= 2)
+}
+
+func TestFetchLimiterShared(t *testing.T) {
+	f := newFakeS3()
+	now := time.Now()
+	f.SetObject(testBucket, "darwin/Keybase-renamed.dmg", &s3test.Object{LastModified: now, Metadata: map[string]string{"Version": "1.0.15-20160313000000+ab12cd3"}})
+	f.Put(testBucket, "darwin/Keybase-renamed.dmg.meta.json", `{"commit": "ab12cd3"}`, now)
+	c := newTestClient(f)
+	c.FetchConcurrency = 1
+	c.MetaSidecars = true
+	c.ObjectMetadata = true
+
+	releases, err := c.ListReleases(testBucket, "darwin/", "")
+	assert.NoError(t, err)
+	assert.Len(t, releases, 1)
+	assert.Equal(t, "1.0.15-20160313000000+ab12cd3", releases[0].Version)
+	assert.Equal(t, "ab12cd3", releases[0].Commit)
+	// Both enrichments went through the one limiter
+	assert.Equal(t, 1, cap(c.fetchLimiter()))
+}
+
+func TestFetchRPS(t *testing.T) {
+	c := newTestClient(newFakeS3())
+	c.FetchRPS = 100
+	start := time.Now()
+	maxConcurrentFetches(c, 11)
+	// The first is free, the other 10 are 10ms apart
+	assert.True(t, time.Since(start) >= 90*time.Millisecond)
+
+	c = newTestClient(newFakeS3())
+	c.FetchRPS = 100
+	start = time.Now()
+	_, err := c.CheckLatestAges(testBucket, time.Hour)
+	assert.NoError(t, err)
+	assert.True(t, time.Since(start) >= time.Duration(len(platformsAll)-1)*9*time.Millisecond)
+}
+
+func TestEnrichReleasesOrder(t *testing.T) {
+	releases := make([]Release, 100)
+	for i := range releases {
+		releases[i].Key = fmt.Sprintf("key-%d", i)
+	}
+	c := newTestClient(newFakeS3())
+	c.FetchConcurrency = 7
+	var mtx sync.Mutex
+	inFlight, max := 0, 0
+	c.enrichReleases(releases, func(r *Release) {
+		mtx.Lock()
+		inFlight++
+		if inFlight > max {
+			max = inFlight
+		}
+		mtx.Unlock()
+		time.Sleep(time.Millisecond)
+		r.Version = r.Key + "-enriched"
+		mtx.Lock()
+		inFlight--
+		mtx.Unlock()
+	})
+	assert.True(t, max <= 7)
+	for i, release := range releases {
+		assert.Equal(t, fmt.Sprintf("key-%d-enriched", i), release.Version)
+	}
+
+	// Nothing to enrich
+	c.enrichReleases(nil, func(r *Release) { t.Fatal("unexpected") })
+}
+
+func putMetadataReleases(f *s3test.Bucket, n int) map[string]string {
+	now := time.Now()
+	versions := map[string]string{}
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("Keybase-%03d.dmg", i)
+		versions[name] = fmt.Sprintf("1.0.%d-20160313000000+ab12cd3", i)
+		f.SetObject(testBucket, "darwin/"+name, &s3test.Object{
+			LastModified: now.Add(time.Duration(i) * time.Minute),
+			Metadata:     map[string]string{"Version": versions[name]},
+		})
+	}
+	return versions
+}
+
+func TestObjectMetadataConcurrent(t *testing.T) {
+	f := newFakeS3()
+	versions := putMetadataReleases(f, 50)
+	c := newTestClient(f)
+	c.ObjectMetadata = true
+	c.FetchConcurrency = 16
+	releases, err := c.ListReleases(testBucket, "darwin/", "")
+	require.NoError(t, err)
+	require.Len(t, releases, 50)
+	for _, release := range releases {
+		assert.Equal(t, versions[release.Name], release.Version)
+	}
+}
+
+func benchmarkObjectMetadata(b *testing.B, concurrency int) {
+	f := newFakeS3()
+	f.HeadLatency = time.Millisecond
+	putMetadataReleases(f, 100)
+	for i := 0; i < b.N; i++ {
+		c := newTestClient(f)
+		c.ObjectMetadata = true
+		c.FetchConcurrency = concurrency
+		if _, err := c.ListReleases(testBucket, "darwin/", ""); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkObjectMetadataSerial(b *testing.B) {
+	benchmarkObjectMetadata(b, 1)
+}
+
+func BenchmarkObjectMetadataConcurrent(b *testing.B) {
+	benchmarkObjectMetadata(b, defaultFetchConcurrency)
+}
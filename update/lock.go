@@ -0,0 +1,84 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// promotionLockKey is the object that, when present, stops promotions, for
+// example during maintenance
+const promotionLockKey = "promotion.lock"
+
+// ifNoneMatchAny makes a PUT fail if the key already exists
+func ifNoneMatchAny(r *request.Request) {
+	r.HTTPRequest.Header.Set("If-None-Match", "*")
+}
+
+func isPreconditionFailed(err error) bool {
+	if aerr, ok := err.(awserr.Error); ok {
+		return aerr.Code() == "PreconditionFailed"
+	}
+	return false
+}
+
+// AcquirePromotionLock stops promotions until the lock is released. It fails
+// if promotions are already locked.
+func (c *Client) AcquirePromotionLock(bucketName string, reason string) error {
+	_, err := c.svc.PutObjectWithContext(aws.BackgroundContext(), &s3.PutObjectInput{
+		Bucket:        aws.String(bucketName),
+		Key:           aws.String(promotionLockKey),
+		Body:          bytes.NewReader([]byte(reason)),
+		ContentLength: aws.Int64(int64(len(reason))),
+		ContentType:   aws.String("text/plain"),
+	}, ifNoneMatchAny)
+	if isPreconditionFailed(err) {
+		current, _, lockErr := c.promotionLock(bucketName)
+		if lockErr != nil {
+			return fmt.Errorf("Promotions are already locked")
+		}
+		return fmt.Errorf("Promotions are already locked: %s", current)
+	}
+	if err != nil {
+		return err
+	}
+	c.logf(VerbosityNormal, "Locked promotions: %s", reason)
+	return nil
+}
+
+// ReleasePromotionLock lets promotions run again
+func (c *Client) ReleasePromotionLock(bucketName string) error {
+	_, err := c.svc.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(promotionLockKey),
+	})
+	return err
+}
+
+// promotionLock returns the lock's reason and whether promotions are locked
+func (c *Client) promotionLock(bucketName string) (string, bool, error) {
+	resp, err := c.svc.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(promotionLockKey),
+	})
+	if isNotFound(err) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	reason, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", false, err
+	}
+	return string(reason), true, nil
+}
@@ -0,0 +1,36 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPromotionLock(t *testing.T) {
+	f := newFakeS3()
+	version := "1.0.15-20160313013917+ab12cd3"
+	seedDarwinRelease(f, version)
+	c := newTestClient(f)
+
+	require.NoError(t, c.AcquirePromotionLock(testBucket, "db maintenance"))
+	require.EqualError(t, c.AcquirePromotionLock(testBucket, "again"), "Promotions are already locked: db maintenance")
+
+	result, err := c.PromoteReleaseWithOptions(testBucket, "v2", platformDarwin, "prod", PromoteOptions{})
+	require.NoError(t, err)
+	assert.False(t, result.Promoted)
+	assert.Equal(t, "locked", result.Reason)
+	assert.Nil(t, f.Get(testBucket, UpdateJSONName("v2", PlatformTypeDarwin, "prod")))
+
+	require.NoError(t, c.ReleasePromotionLock(testBucket))
+	result, err = c.PromoteReleaseWithOptions(testBucket, "v2", platformDarwin, "prod", PromoteOptions{})
+	require.NoError(t, err)
+	assert.True(t, result.Promoted)
+	assert.Equal(t, version, currentTestUpdate(t, c, "v2").Version)
+
+	// Can be locked again once released
+	require.NoError(t, c.AcquirePromotionLock(testBucket, "db maintenance"))
+}
@@ -0,0 +1,163 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// HTMLManifest is what an index was generated from, so it can be updated
+// without loading every release again
+type HTMLManifest struct {
+	GeneratedAt time.Time `json:"generatedAt"`
+	Sections    []Section `json:"sections"`
+	// ListedThrough is the newest LastModified in each prefix's listing (by
+	// section header). The next run loads objects modified since then, by
+	// S3's clock rather than the local one.
+	ListedThrough map[string]time.Time `json:"listedThrough,omitempty"`
+}
+
+// readHTMLManifest reads a manifest, returning nil if there isn't one
+func readHTMLManifest(path string) (*HTMLManifest, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var manifest HTMLManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, err
+	}
+	// The zone name isn't in the JSON
+	for _, section := range manifest.Sections {
+		for i := range section.Releases {
+			section.Releases[i].Date = convertEastern(section.Releases[i].Date)
+		}
+	}
+	return &manifest, nil
+}
+
+func writeHTMLManifest(path string, manifest HTMLManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := makeParentDirs(path); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0644)
+}
+
+// WriteHTMLIncremental is WriteHTML using the manifest saved at manifestPath
+// by the last run. Only objects modified since its listing are loaded (S3
+// can't filter a listing by date, so keys are still listed, but releases and
+// their sidecars aren't read again), and releases whose objects were removed
+// are dropped. A manifest from before ListedThrough continues from its
+// GeneratedAt. If there is no manifest, the index is built from scratch, as is
+// the section for a prefix that isn't in it (added since). The manifest is
+// then saved for the next run.
+func (c *Client) WriteHTMLIncremental(bucketName string, prefixes string, suffix string, manifestPath string, outPath string, uploadDest string) error {
+	previous, err := readHTMLManifest(manifestPath)
+	if err != nil {
+		return err
+	}
+	if previous == nil {
+		c.logf(VerbosityNormal, "No manifest at %s, building index from scratch", manifestPath)
+	}
+
+	manifest := HTMLManifest{GeneratedAt: timeNow(), ListedThrough: map[string]time.Time{}}
+	for _, prefix := range splitPrefixes(prefixes) {
+		var known []Release
+		inManifest := false
+		if previous != nil {
+			for _, section := range previous.Sections {
+				if section.Header == prefix {
+					known = section.Releases
+					inManifest = true
+				}
+			}
+		}
+		var releases []Release
+		var listedThrough time.Time
+		if !inManifest {
+			if previous != nil {
+				c.logf(VerbosityNormal, "No %s in manifest %s, listing it from scratch", prefix, manifestPath)
+			}
+			releases, listedThrough, err = c.listReleasesThrough(bucketName, prefix, suffix, 50)
+		} else {
+			since, ok := previous.ListedThrough[prefix]
+			if !ok {
+				since = previous.GeneratedAt
+			}
+			releases, listedThrough, err = c.mergeReleasesSince(bucketName, prefix, suffix, since, known)
+			if listedThrough.IsZero() {
+				listedThrough = since
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if !listedThrough.IsZero() {
+			manifest.ListedThrough[prefix] = listedThrough
+		}
+		manifest.Sections = append(manifest.Sections, Section{
+			Header:   prefix,
+			Releases: releases,
+		})
+	}
+
+	if err := c.writeHTMLForSections(bucketName, manifest.Sections, outPath, uploadDest); err != nil {
+		return err
+	}
+	return writeHTMLManifest(manifestPath, manifest)
+}
+
+// mergeReleasesSince loads the releases at prefix modified at or after since
+// (LastModified is to the second, so an object modified in the same second
+// as the last listing might not have been in it), and merges them with the
+// known releases that still exist. It also returns the newest LastModified in
+// the listing.
+func (c *Client) mergeReleasesSince(bucketName string, prefix string, suffix string, since time.Time, known []Release) ([]Release, time.Time, error) {
+	prefix = normalizePrefix(prefix)
+	objs, err := c.listAllObjects(bucketName, prefix)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	exists := map[string]bool{}
+	var modified []*s3.Object
+	for _, obj := range objs {
+		exists[*obj.Key] = true
+		if !aws.TimeValue(obj.LastModified).Before(since) {
+			modified = append(modified, obj)
+		}
+	}
+
+	added := c.parseReleases(modified, bucketName, prefix, suffix)
+	c.applyReleaseMetadata(bucketName, objs, added)
+	c.logf(VerbosityNormal, "Found %d new release(s) at %s", len(added), prefix)
+
+	releases := added
+	addedKeys := map[string]bool{}
+	for _, release := range added {
+		addedKeys[release.Key] = true
+	}
+	for _, release := range known {
+		if !exists[release.Key] {
+			c.logf(VerbosityVerbose, "Dropping %s, it was removed", release.Key)
+			continue
+		}
+		if !addedKeys[release.Key] {
+			releases = append(releases, release)
+		}
+	}
+	return sortReleases(releases, 50), newestModified(objs), nil
+}
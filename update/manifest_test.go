@@ -0,0 +1,101 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteHTMLIncremental(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestWriteHTMLIncremental")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	manifestPath := filepath.Join(dir, "manifest.json")
+	outPath := filepath.Join(dir, "index.html")
+
+	now := time.Date(2016, 3, 14, 12, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	f := newFakeS3()
+	removed := "darwin/Keybase-1.0.13-20160311013917+eeeeeee.dmg"
+	kept := "darwin/Keybase-1.0.14-20160312013917+cd6f696.dmg"
+	f.Put(testBucket, removed, "dmg", now.Add(-48*time.Hour))
+	f.Put(testBucket, kept, "dmg", now.Add(-24*time.Hour))
+	f.Put(testBucket, "darwin/notes.txt", "notes", now.Add(-time.Hour))
+	c := newTestClient(f)
+
+	// No manifest, so a full build
+	require.NoError(t, c.WriteHTMLIncremental(testBucket, "darwin/", ".dmg", manifestPath, outPath, ""))
+	manifest, err := readHTMLManifest(manifestPath)
+	require.NoError(t, err)
+	require.NotNil(t, manifest)
+	assert.True(t, now.Equal(manifest.GeneratedAt))
+	assert.True(t, now.Add(-time.Hour).Equal(manifest.ListedThrough["darwin/"]))
+	require.Len(t, manifest.Sections, 1)
+	require.Len(t, manifest.Sections[0].Releases, 2)
+
+	// Mark the known release, to check it isn't loaded again
+	manifest.Sections[0].Releases[0].Commit = "fromManifest"
+	require.NoError(t, writeHTMLManifest(manifestPath, *manifest))
+
+	// Uploaded before the local time the manifest was generated at (the local
+	// clock is ahead of S3's), but after the listing
+	added := "darwin/Keybase-1.0.15-20160313013917+ab12cd3.dmg"
+	f.Put(testBucket, added, "dmg", now.Add(-30*time.Minute))
+	f.Delete(testBucket, removed)
+	now = now.Add(2 * time.Hour)
+
+	require.NoError(t, c.WriteHTMLIncremental(testBucket, "darwin/", ".dmg", manifestPath, outPath, ""))
+	manifest, err = readHTMLManifest(manifestPath)
+	require.NoError(t, err)
+	releases := manifest.Sections[0].Releases
+	require.Len(t, releases, 2)
+	assert.Equal(t, added, releases[0].Key)
+	assert.Equal(t, "ab12cd3", releases[0].Commit)
+	assert.Equal(t, kept, releases[1].Key)
+	assert.Equal(t, "fromManifest", releases[1].Commit)
+
+	html, err := ioutil.ReadFile(outPath)
+	require.NoError(t, err)
+	assert.Contains(t, string(html), "Keybase-1.0.15-20160313013917+ab12cd3.dmg")
+	assert.NotContains(t, string(html), "1.0.13")
+}
+
+func TestWriteHTMLIncrementalNewPrefix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestWriteHTMLIncrementalNewPrefix")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	manifestPath := filepath.Join(dir, "manifest.json")
+	outPath := filepath.Join(dir, "index.html")
+
+	now := time.Date(2016, 3, 14, 12, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	f := newFakeS3()
+	f.Put(testBucket, "darwin/Keybase-1.0.14-20160312013917+cd6f696.dmg", "dmg", now.Add(-24*time.Hour))
+	deb := "linux_binaries/deb/keybase_1.0.14-20160312013917+cd6f696_amd64.deb"
+	f.Put(testBucket, deb, "deb", now.Add(-24*time.Hour))
+	c := newTestClient(f)
+	require.NoError(t, c.WriteHTMLIncremental(testBucket, "darwin/", "", manifestPath, outPath, ""))
+
+	// The deb prefix is added after the manifest was saved, and its release
+	// is older than it
+	now = now.Add(time.Hour)
+	require.NoError(t, c.WriteHTMLIncremental(testBucket, "darwin/,linux_binaries/deb/", "", manifestPath, outPath, ""))
+	manifest, err := readHTMLManifest(manifestPath)
+	require.NoError(t, err)
+	require.Len(t, manifest.Sections, 2)
+	assert.Len(t, manifest.Sections[0].Releases, 1)
+	require.Len(t, manifest.Sections[1].Releases, 1)
+	assert.Equal(t, deb, manifest.Sections[1].Releases[0].Key)
+}
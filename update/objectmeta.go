@@ -0,0 +1,78 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// metadataValue returns a user metadata value (x-amz-meta-<name>). The SDK
+// canonicalizes the header names, so they're matched ignoring case.
+func metadataValue(metadata map[string]*string, name string) string {
+	for k, v := range metadata {
+		if strings.EqualFold(k, name) {
+			return aws.StringValue(v)
+		}
+	}
+	return ""
+}
+
+// getObjectMeta reads the version, commit and date (RFC 3339) the build
+// pipeline stamps into an object's user metadata
+func (c *Client) getObjectMeta(bucketName string, key string) (*releaseMeta, error) {
+	resp, err := c.svc.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c.objectMeta(key, resp.Metadata), nil
+}
+
+// objectMeta is the release metadata in an object's user metadata
+func (c *Client) objectMeta(key string, metadata map[string]*string) *releaseMeta {
+	meta := releaseMeta{
+		Version: metadataValue(metadata, "version"),
+		Commit:  metadataValue(metadata, "commit"),
+	}
+	if date := metadataValue(metadata, "date"); date != "" {
+		var err error
+		meta.BuiltAt, err = time.Parse(time.RFC3339, date)
+		if err != nil {
+			c.logf(VerbosityQuiet, "Invalid date %q in metadata for %s: %s", date, key, err)
+		}
+	}
+	return &meta
+}
+
+// applyObjectMetadata updates releases from their objects' metadata. Releases
+// without metadata keep what was parsed from the name.
+func (c *Client) applyObjectMetadata(bucketName string, releases []Release) {
+	c.enrichReleases(releases, func(r *Release) {
+		var meta *releaseMeta
+		var err error
+		c.limitFetch(func() { meta, err = c.getObjectMeta(bucketName, r.Key) })
+		if err != nil {
+			c.logf(VerbosityQuiet, "Couldn't read metadata for %s, using name for version: %s", r.Key, err)
+			return
+		}
+		r.applyMeta(*meta)
+	})
+}
+
+// applyReleaseMetadata updates releases from object metadata and sidecars,
+// if enabled. Sidecars take precedence.
+func (c *Client) applyReleaseMetadata(bucketName string, objs []*s3.Object, releases []Release) {
+	if c.ObjectMetadata {
+		c.applyObjectMetadata(bucketName, releases)
+	}
+	if c.MetaSidecars {
+		c.applyMetaSidecars(bucketName, objs, releases)
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"testing"
+	"time"
+
+	"github.com/keybase/release/update/s3test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListReleasesObjectMetadata(t *testing.T) {
+	f := newFakeS3()
+	f.SetObject(testBucket, "darwin/Keybase-nightly.dmg", &s3test.Object{
+		Body: []byte("dmg"),
+		Metadata: map[string]string{
+			"Version": "1.0.16-20160314013917+ef01234",
+			"Commit":  "ef01234",
+			"Date":    "2016-03-14T01:39:17Z",
+		},
+	})
+	f.Put(testBucket, "darwin/Keybase-1.0.15-20160313013917+ab12cd3.dmg", "dmg", time.Now())
+	c := newTestClient(f)
+
+	// Without the option, the metadata-only release can't be dated
+	releases, err := c.ListReleases(testBucket, "darwin/", "")
+	require.NoError(t, err)
+	require.Len(t, releases, 2)
+	assert.Equal(t, "1.0.15-20160313013917+ab12cd3", releases[0].Version)
+	assert.Equal(t, "", releases[1].Version)
+
+	c.ObjectMetadata = true
+	releases, err = c.ListReleases(testBucket, "darwin/", "")
+	require.NoError(t, err)
+	require.Len(t, releases, 2)
+	assert.Equal(t, "Keybase-nightly.dmg", releases[0].Name)
+	assert.Equal(t, "1.0.16-20160314013917+ef01234", releases[0].Version)
+	assert.Equal(t, "ef01234", releases[0].Commit)
+	assert.True(t, releases[0].Date.Equal(time.Date(2016, 3, 14, 1, 39, 17, 0, time.UTC)))
+	// No metadata, keeps the name
+	assert.Equal(t, "1.0.15-20160313013917+ab12cd3", releases[1].Version)
+
+	release, err := c.findRelease(testBucket, platformDarwin, func(r Release) bool { return true })
+	require.NoError(t, err)
+	require.NotNil(t, release)
+	assert.Equal(t, "Keybase-nightly.dmg", release.Name)
+}
@@ -0,0 +1,25 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+// PlatformVersionMatrix returns, for each platform, whether there is a
+// release of version, and the keys of the releases found, so we can check all
+// platforms have a build before a coordinated promotion.
+func (c *Client) PlatformVersionMatrix(bucketName string, version string) (found map[string]bool, keys map[string]string, err error) {
+	found = map[string]bool{}
+	keys = map[string]string{}
+	for _, platform := range platformsAll {
+		release, err := c.findRelease(bucketName, platform, func(r Release) bool {
+			return r.Version == version
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		found[platform.Name] = release != nil
+		if release != nil {
+			keys[platform.Name] = release.Key
+		}
+	}
+	return found, keys, nil
+}
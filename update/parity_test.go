@@ -0,0 +1,29 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlatformVersionMatrix(t *testing.T) {
+	f := newFakeS3()
+	version := "1.0.15-20160313013917+ab12cd3"
+	f.Put(testBucket, "darwin/Keybase-"+version+".dmg", "dmg", time.Now())
+	f.Put(testBucket, "darwin/Keybase-1.0.16-20160314013917+ef01234.dmg", "dmg", time.Now())
+	f.Put(testBucket, "linux_binaries/deb/keybase_1.0.15-20160313013917.ab12cd3_amd64.deb", "deb", time.Now())
+	f.Put(testBucket, "linux_binaries/rpm/keybase-1.0.14-20160312013917.cd6f696.x86_64.rpm", "rpm", time.Now())
+
+	found, keys, err := newTestClient(f).PlatformVersionMatrix(testBucket, version)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"darwin": true, "deb": true, "rpm": false, "windows": false}, found)
+	assert.Equal(t, map[string]string{
+		"darwin": "darwin/Keybase-" + version + ".dmg",
+		"deb":    "linux_binaries/deb/keybase_1.0.15-20160313013917.ab12cd3_amd64.deb",
+	}, keys)
+}
@@ -0,0 +1,143 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// PlannedPromotion is a policy rule's promotion, evaluated but not written.
+// If Result has a Reason, it won't be promoted.
+type PlannedPromotion struct {
+	Rule   PromotionRule
+	Result *PromoteResult
+
+	promotion *promotion
+}
+
+// Promotes is whether executing the plan promotes Result.Release
+func (p PlannedPromotion) Promotes() bool {
+	return p.promotion != nil && p.Result.Reason == ""
+}
+
+// PromotionPlan is what a policy would promote, for review before it's
+// executed (see ExecutePromotionPlan)
+type PromotionPlan struct {
+	Bucket     string
+	Promotions []PlannedPromotion
+}
+
+// WriteTable writes the plan as a table, with what each promotion would
+// promote or why it wouldn't
+func (p PromotionPlan) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 5, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, "Platform\tEnv\tChannel\tFrom\tTo\tPlan")
+	for _, planned := range p.Promotions {
+		result := planned.Result
+		to := ""
+		if result.Release != nil {
+			to = result.Release.Version
+		}
+		plan := "promote"
+		if !planned.Promotes() {
+			plan = result.Reason
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%q\t%s\t%s\t%s\n", result.Platform, result.Env, result.Channel, result.FromVersion, to, plan)
+	}
+	return tw.Flush()
+}
+
+// EvaluatePromotions evaluates every enabled promotion in a policy without
+// promoting anything. Each platform's releases (and the held versions) are
+// listed once for all of its envs and channels. Like PromoteFromPolicy, a
+// promotion that fails to evaluate doesn't stop the others; it's left out of
+// the plan and the errors are combined.
+func (c *Client) EvaluatePromotions(bucketName string, policy PromotionPolicy) (*PromotionPlan, error) {
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	held, err := c.heldVersions(bucketName)
+	if err != nil {
+		return nil, err
+	}
+	plan := &PromotionPlan{Bucket: bucketName}
+	listings := map[string]*promotionListing{}
+	var errs []error
+	for _, rule := range policy.Promotions {
+		if !rule.Enabled {
+			c.logf(VerbosityVerbose, "Skipping disabled promotion of %s to %q (%s)", rule.Platform, rule.Channel, rule.Env)
+			continue
+		}
+		platform, err := platformForName(rule.Platform)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		opts, err := rule.options()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		listing, ok := listings[platform.Name]
+		if !ok {
+			releases, err := c.ListReleases(bucketName, platform.Prefix, platform.Suffix)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("Error listing %s: %s", platform.Name, err))
+				continue
+			}
+			listing = &promotionListing{releases: releases, held: held}
+			listings[platform.Name] = listing
+		}
+		p, err := c.evaluatePromotion(bucketName, rule.Channel, platform, rule.Env, opts, listing)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Error evaluating promotion of %s to %q (%s): %s", rule.Platform, rule.Channel, rule.Env, err))
+			continue
+		}
+		plan.Promotions = append(plan.Promotions, PlannedPromotion{Rule: rule, Result: p.result, promotion: p})
+	}
+	return plan, CombineErrors(errs...)
+}
+
+// ExecutePromotionPlan writes the promotions in a plan. A channel that has
+// changed since the plan was made isn't promoted, so a stale plan can't undo
+// a newer promotion, and nothing is promoted if promotions have been locked.
+// A failed promotion doesn't stop the others; their errors are combined.
+func (c *Client) ExecutePromotionPlan(plan *PromotionPlan) ([]*PromoteResult, error) {
+	lockReason, locked, err := c.promotionLock(plan.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	if locked {
+		return nil, fmt.Errorf("Promotions are locked: %s", lockReason)
+	}
+	var results []*PromoteResult
+	var errs []error
+	for _, planned := range plan.Promotions {
+		if !planned.Promotes() {
+			continue
+		}
+		result := planned.Result
+		current, _, err := c.CurrentUpdate(plan.Bucket, result.Channel, result.Platform, result.Env)
+		if err != nil && !isNotFound(err) {
+			errs = append(errs, err)
+			continue
+		}
+		currentVersion := ""
+		if current != nil {
+			currentVersion = current.Version
+		}
+		if currentVersion != result.FromVersion {
+			errs = append(errs, fmt.Errorf("Not promoting %s to %q (%s), it changed from %s to %s since the plan", result.Platform, result.Channel, result.Env, result.FromVersion, currentVersion))
+			continue
+		}
+		if err := c.writePromotion(plan.Bucket, planned.promotion); err != nil {
+			errs = append(errs, fmt.Errorf("Error promoting %s to %q (%s): %s", result.Platform, result.Channel, result.Env, err))
+			continue
+		}
+		results = append(results, result)
+	}
+	return results, CombineErrors(errs...)
+}
@@ -0,0 +1,76 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluatePromotions(t *testing.T) {
+	f := newFakeS3()
+	older := "1.0.14-20160312013917+cd6f696"
+	version := "1.0.15-20160313013917+ab12cd3"
+	seedDarwinRelease(f, older)
+	seedDarwinRelease(f, version)
+	putUpdateJSON(f, testBucket, "darwin-support/"+SupportUpdateName(PlatformTypeDarwin, "staging", version), version)
+	putUpdateJSON(f, testBucket, UpdateJSONName("v2", PlatformTypeDarwin, "prod"), version)
+	c := newTestClient(f)
+
+	policy := PromotionPolicy{Promotions: []PromotionRule{
+		{Platform: "darwin", Channel: "v2", Env: "prod", Enabled: true},
+		{Platform: "darwin", Channel: "test-v2", Env: "prod", Enabled: true},
+		{Platform: "darwin", Channel: "v2", Env: "staging", Enabled: true},
+		{Platform: "windows", Channel: "v2", Env: "prod", Enabled: false},
+	}}
+	plan, err := c.EvaluatePromotions(testBucket, policy)
+	require.NoError(t, err)
+	// One listing of the held versions, and one for every darwin promotion
+	assert.Equal(t, 2, f.ListCalls)
+	require.Len(t, plan.Promotions, 3)
+	assert.False(t, plan.Promotions[0].Promotes())
+	assert.Equal(t, "unchanged", plan.Promotions[0].Result.Reason)
+	assert.True(t, plan.Promotions[1].Promotes())
+	assert.Equal(t, version, plan.Promotions[1].Result.Release.Version)
+	assert.True(t, plan.Promotions[2].Promotes())
+	// Nothing is written until it's executed
+	assert.Nil(t, f.Get(testBucket, UpdateJSONName("test-v2", PlatformTypeDarwin, "prod")))
+	assert.Nil(t, f.Get(testBucket, UpdateJSONName("v2", PlatformTypeDarwin, "staging")))
+
+	var buf bytes.Buffer
+	require.NoError(t, plan.WriteTable(&buf))
+	assert.Contains(t, buf.String(), "unchanged")
+	assert.Contains(t, buf.String(), "promote")
+
+	// test-v2 was promoted since the plan was made, so it isn't changed
+	putUpdateJSON(f, testBucket, UpdateJSONName("test-v2", PlatformTypeDarwin, "prod"), older)
+	results, err := c.ExecutePromotionPlan(plan)
+	require.EqualError(t, err, `Not promoting darwin to "test-v2" (prod), it changed from  to `+older+` since the plan`)
+	require.Len(t, results, 1)
+	assert.True(t, results[0].Promoted)
+	assert.Equal(t, "staging", results[0].Env)
+	assert.Equal(t, older, currentTestUpdate(t, c, "test-v2").Version)
+	upd, _, err := c.CurrentUpdate(testBucket, "v2", PlatformTypeDarwin, "staging")
+	require.NoError(t, err)
+	assert.Equal(t, version, upd.Version)
+}
+
+func TestExecutePromotionPlanLocked(t *testing.T) {
+	f := newFakeS3()
+	version := "1.0.15-20160313013917+ab12cd3"
+	seedDarwinRelease(f, version)
+	c := newTestClient(f)
+
+	plan, err := c.EvaluatePromotions(testBucket, PromotionPolicy{Promotions: []PromotionRule{
+		{Platform: "darwin", Channel: "v2", Env: "prod", Enabled: true},
+	}})
+	require.NoError(t, err)
+	require.NoError(t, c.AcquirePromotionLock(testBucket, "incident"))
+	_, err = c.ExecutePromotionPlan(plan)
+	require.EqualError(t, err, "Promotions are locked: incident")
+	assert.Nil(t, f.Get(testBucket, UpdateJSONName("v2", PlatformTypeDarwin, "prod")))
+}
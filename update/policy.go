@@ -0,0 +1,187 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// PromotionPolicy is the promotions to run, from a JSON policy file, so the
+// rules for every platform and channel are in one place
+type PromotionPolicy struct {
+	Promotions []PromotionRule `json:"promotions"`
+}
+
+// PromotionRule is one promotion in a policy, for example darwin releases
+// older than 27h promoted to the v2 channel before 10am
+type PromotionRule struct {
+	Platform string `json:"platform"`
+	Channel  string `json:"channel"`
+	Env      string `json:"env"`
+	// Delay is how old a release must be, as a duration (27h)
+	Delay             string `json:"delay,omitempty"`
+	BeforeHourEastern int    `json:"beforeHourEastern,omitempty"`
+	AllowDowngrade    bool   `json:"allowDowngrade,omitempty"`
+	Enabled           bool   `json:"enabled"`
+}
+
+// options returns the PromoteOptions for a rule
+func (r PromotionRule) options() (PromoteOptions, error) {
+	var opts PromoteOptions
+	if r.Delay != "" {
+		delay, err := time.ParseDuration(r.Delay)
+		if err != nil {
+			return opts, fmt.Errorf("Invalid delay %q: %s", r.Delay, err)
+		}
+		if delay < 0 {
+			return opts, fmt.Errorf("Invalid delay %q: negative", r.Delay)
+		}
+		opts.Delay = delay
+	}
+	if r.BeforeHourEastern < 0 || r.BeforeHourEastern > 23 {
+		return opts, fmt.Errorf("Invalid beforeHourEastern %d", r.BeforeHourEastern)
+	}
+	opts.BeforeHourEastern = r.BeforeHourEastern
+	opts.AllowDowngrade = r.AllowDowngrade
+	return opts, nil
+}
+
+// Validate checks every rule is for a platform that can be promoted, has an
+// env, and has valid options
+func (p PromotionPolicy) Validate() error {
+	for i, rule := range p.Promotions {
+		platform, err := platformForName(rule.Platform)
+		if err != nil {
+			return fmt.Errorf("Promotion %d: %s", i, err)
+		}
+		if platform.PrefixSupport == "" {
+			return fmt.Errorf("Promotion %d: promoting releases is unsupported for %s", i, platform.Name)
+		}
+		if rule.Env == "" {
+			return fmt.Errorf("Promotion %d: no env", i)
+		}
+		if _, err := rule.options(); err != nil {
+			return fmt.Errorf("Promotion %d: %s", i, err)
+		}
+	}
+	return nil
+}
+
+// ReadPromotionPolicy decodes and validates a policy. Unknown fields are an
+// error, so a typo isn't silently ignored.
+func ReadPromotionPolicy(r io.Reader) (*PromotionPolicy, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	var policy PromotionPolicy
+	if err := dec.Decode(&policy); err != nil {
+		return nil, fmt.Errorf("Invalid policy: %s", err)
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// LoadPromotionPolicy reads a policy file
+func LoadPromotionPolicy(path string) (*PromotionPolicy, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	return ReadPromotionPolicy(f)
+}
+
+// PromoteFromPolicy runs every enabled promotion in a policy file, or if
+// policyPath is empty, in the bucket config. A failed promotion doesn't stop
+// the others; their errors are combined.
+func (c *Client) PromoteFromPolicy(bucketName string, policyPath string) ([]*PromoteResult, error) {
+	if policyPath == "" {
+		config, err := c.LoadBucketConfig(bucketName)
+		if err != nil {
+			return nil, err
+		}
+		return c.promotePolicy(bucketName, config.PromotionPolicy)
+	}
+	policy, err := LoadPromotionPolicy(policyPath)
+	if err != nil {
+		return nil, err
+	}
+	return c.promotePolicy(bucketName, *policy)
+}
+
+func (c *Client) promotePolicy(bucketName string, policy PromotionPolicy) ([]*PromoteResult, error) {
+	return c.promoteRules(bucketName, policy.Promotions, nil)
+}
+
+// promoteRules runs the enabled promotion rules, only promoting versions in
+// allowlist if it's set
+func (c *Client) promoteRules(bucketName string, rules []PromotionRule, allowlist []string) ([]*PromoteResult, error) {
+	var results []*PromoteResult
+	var errs []error
+	for _, rule := range rules {
+		if !rule.Enabled {
+			c.logf(VerbosityVerbose, "Skipping disabled promotion of %s to %q (%s)", rule.Platform, rule.Channel, rule.Env)
+			continue
+		}
+		platform, err := platformForName(rule.Platform)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		opts, err := rule.options()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		opts.Allowlist = allowlist
+		result, err := c.PromoteReleaseWithOptions(bucketName, rule.Channel, platform, rule.Env, opts)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Error promoting %s to %q (%s): %s", rule.Platform, rule.Channel, rule.Env, err))
+			continue
+		}
+		results = append(results, result)
+	}
+	return results, CombineErrors(errs...)
+}
+
+// HandleNewObject promotes a newly uploaded object (from an S3 event
+// notification), if it's a release, by the policy's rules for its platform.
+// Only that release can be promoted, and it still has to pass the rules'
+// checks; the results say why it wasn't. It returns no results if the key
+// isn't a release for a platform in the policy.
+func (c *Client) HandleNewObject(bucketName string, key string, policy PromotionPolicy) ([]*PromoteResult, error) {
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	for _, platform := range platformsAll {
+		var rules []PromotionRule
+		for _, rule := range policy.Promotions {
+			if rule.Platform == platform.Name {
+				rules = append(rules, rule)
+			}
+		}
+		if len(rules) == 0 {
+			continue
+		}
+		release, err := c.ReleaseForKey(bucketName, platform.Prefix, platform.Suffix, key)
+		if err != nil {
+			return nil, err
+		}
+		if release == nil {
+			continue
+		}
+		if release.Version == "" {
+			return nil, fmt.Errorf("No version for %s", key)
+		}
+		c.logf(VerbosityNormal, "New %s release %s (%s)", platform.Name, release.Version, key)
+		return c.promoteRules(bucketName, rules, []string{release.Version})
+	}
+	c.logf(VerbosityVerbose, "Ignoring %s, it's not a release for a platform in the policy", key)
+	return nil, nil
+}
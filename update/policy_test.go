@@ -0,0 +1,108 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadPromotionPolicyValidation(t *testing.T) {
+	for _, policy := range []string{
+		`{"promotions": [{"platform": "linux", "channel": "v2", "env": "prod", "enabled": true}]}`,
+		`{"promotions": [{"platform": "deb", "channel": "v2", "env": "prod", "enabled": true}]}`,
+		`{"promotions": [{"platform": "darwin", "channel": "v2", "enabled": true}]}`,
+		`{"promotions": [{"platform": "darwin", "channel": "v2", "env": "prod", "delay": "a day"}]}`,
+		`{"promotions": [{"platform": "darwin", "channel": "v2", "env": "prod", "beforeHourEastern": 24}]}`,
+		`{"promotions": [{"platform": "darwin", "channel": "v2", "env": "prod", "dealy": "27h"}]}`,
+		`{"promotions": {}}`,
+	} {
+		_, err := ReadPromotionPolicy(strings.NewReader(policy))
+		assert.Error(t, err, policy)
+	}
+
+	policy, err := ReadPromotionPolicy(strings.NewReader(`{"promotions": [
+		{"platform": "darwin", "channel": "v2", "env": "prod", "delay": "27h", "beforeHourEastern": 10, "enabled": true}
+	]}`))
+	require.NoError(t, err)
+	require.Len(t, policy.Promotions, 1)
+	opts, err := policy.Promotions[0].options()
+	require.NoError(t, err)
+	assert.Equal(t, "27h0m0s", opts.Delay.String())
+	assert.Equal(t, 10, opts.BeforeHourEastern)
+}
+
+func TestPromoteFromPolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestPromoteFromPolicy")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	policyPath := filepath.Join(dir, "policy.json")
+	require.NoError(t, ioutil.WriteFile(policyPath, []byte(`{"promotions": [
+		{"platform": "darwin", "channel": "v2", "env": "prod", "enabled": true},
+		{"platform": "darwin", "channel": "test-v2", "env": "prod", "enabled": false},
+		{"platform": "windows", "channel": "v2", "env": "prod", "enabled": true}
+	]}`), 0644))
+
+	f := newFakeS3()
+	version := "1.0.15-20160313013917+ab12cd3"
+	seedDarwinRelease(f, version)
+	c := newTestClient(f)
+
+	results, err := c.PromoteFromPolicy(testBucket, policyPath)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.True(t, results[0].Promoted)
+	assert.Equal(t, version, currentTestUpdate(t, c, "v2").Version)
+	assert.Nil(t, f.Get(testBucket, UpdateJSONName("test-v2", PlatformTypeDarwin, "prod")))
+	assert.Equal(t, PlatformTypeWindows, results[1].Platform)
+	assert.Equal(t, "no matching release", results[1].Reason)
+
+	_, err = c.PromoteFromPolicy(testBucket, filepath.Join(dir, "missing.json"))
+	require.Error(t, err)
+}
+
+func TestHandleNewObject(t *testing.T) {
+	policy, err := ReadPromotionPolicy(strings.NewReader(`{"promotions": [
+		{"platform": "darwin", "channel": "v2", "env": "prod", "enabled": true},
+		{"platform": "darwin", "channel": "test-v2", "env": "prod", "enabled": true},
+		{"platform": "windows", "channel": "v2", "env": "prod", "enabled": true}
+	]}`))
+	require.NoError(t, err)
+
+	f := newFakeS3()
+	older := "1.0.14-20160312013917+cd6f696"
+	newer := "1.0.15-20160313013917+ab12cd3"
+	seedDarwinRelease(f, older)
+	seedDarwinRelease(f, newer)
+	putUpdateJSON(f, testBucket, UpdateJSONName("test-v2", PlatformTypeDarwin, "prod"), newer)
+	c := newTestClient(f)
+
+	// Only the new object's release is promoted, not the newest
+	results, err := c.HandleNewObject(testBucket, "darwin/Keybase-"+older+".dmg", *policy)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.True(t, results[0].Promoted)
+	assert.Equal(t, older, results[0].Release.Version)
+	assert.False(t, results[1].Promoted)
+	// The rules' checks still apply
+	assert.Equal(t, "older than current update", results[1].Reason)
+	assert.Equal(t, older, currentTestUpdate(t, c, "v2").Version)
+
+	results, err = c.HandleNewObject(testBucket, "darwin/Keybase-"+newer+".dmg", *policy)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.True(t, results[0].Promoted)
+	assert.Equal(t, newer, currentTestUpdate(t, c, "v2").Version)
+
+	// Not a release
+	results, err = c.HandleNewObject(testBucket, "darwin-support/"+SupportUpdateName(PlatformTypeDarwin, "prod", newer), *policy)
+	require.NoError(t, err)
+	assert.Empty(t, results)
+}
@@ -0,0 +1,669 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/blang/semver"
+)
+
+// PromoteOptions are options for promoting a release
+type PromoteOptions struct {
+	// Delay is how long ago a release must have been built to be promoted
+	Delay time.Duration
+	// BeforeHourEastern, if not 0, only promotes releases built before this
+	// hour of the day. Same as a Cutoff of {Hour: BeforeHourEastern}.
+	BeforeHourEastern int
+	// Cutoff, if set, only promotes releases built before a time of day, and
+	// takes precedence over BeforeHourEastern
+	Cutoff *PromoteCutoff
+	// AllowDowngrade promotes releases older than the current update
+	AllowDowngrade bool
+	// PromoteRebuilds promotes a release with the same version as the current
+	// update but different build metadata (commit), which semver considers
+	// equal. Otherwise it isn't promoted, with the reason "rebuild of current
+	// update".
+	PromoteRebuilds bool
+	// ReleaseName is a specific version to promote, instead of the newest
+	ReleaseName string
+	// MinSignoffs is how many QA sign-off objects (signoff-<version>-<tester>)
+	// a release needs before it's promoted. If 0, none are needed.
+	MinSignoffs int
+	// MinimumFromVersion, if set, is written to the promoted update JSON, so
+	// clients older than it don't update directly to the release
+	MinimumFromVersion string
+	// Required marks the promoted update as mandatory, so clients can't defer
+	// it (for security fixes). It still has to pass the other checks.
+	Required bool
+	// IncludeDelta adds the delta (see deltaKey) from the channel's current
+	// version to the promoted update JSON, if there is one
+	IncludeDelta bool
+	// RequireVariants doesn't promote a release unless every one of the
+	// platform's variants (Client.PlatformVariants) has it
+	RequireVariants bool
+	// RequireSmokeTest doesn't promote a release unless the smoke tests
+	// left a passing marker for it (see smokeTestKey)
+	RequireSmokeTest bool
+	// Cooldown, if not 0, is how long after the channel was last promoted
+	// before it can be promoted again
+	Cooldown time.Duration
+	// Allowlist, if not empty, is the only versions that can be promoted
+	Allowlist []string
+	// MaxSizeGrowthPercent, if not 0, is how much bigger than the current
+	// release a release can be to be promoted, as a percentage
+	MaxSizeGrowthPercent float64
+	// Probe, if set, is called with the release after it's found and before
+	// it's promoted. If it fails, the release isn't promoted.
+	Probe ProbeFunc
+	// SourceETag, if set, is the ETag of the release's support update JSON
+	// when it was reviewed. The promotion fails if it has changed since.
+	SourceETag string
+	// VerifyAsset fails the promotion if the asset URL in the release's
+	// update JSON can't be downloaded (see checkAsset)
+	VerifyAsset bool
+	// ManifestSwap stages the update JSON, the release (as LatestName) and
+	// version.txt for the version, then points the channel's manifest at
+	// them, so clients that read the manifest see the promotion all at once
+	// (see PromotionManifest)
+	ManifestSwap bool
+	// PromotedBy identifies who (or what) promoted the release, stamped with
+	// the rest of the promotion's provenance into the channel's update JSON
+	// (see PromotionProvenance). If empty, it's Client.PromotedBy.
+	PromotedBy string
+}
+
+// ProbeFunc is a canary check of a release before it's promoted
+type ProbeFunc func(release Release) error
+
+// probeTimeout is how long HTTPProbe waits for the health endpoint
+const probeTimeout = 30 * time.Second
+
+// HTTPProbe returns a probe that GETs a health endpoint, with the release's
+// version and URL as the version and url query parameters. Any status other
+// than 2xx fails the probe.
+func HTTPProbe(probeURL string) ProbeFunc {
+	return func(release Release) error {
+		u, err := url.Parse(probeURL)
+		if err != nil {
+			return err
+		}
+		query := u.Query()
+		query.Set("version", release.Version)
+		query.Set("url", release.URL)
+		u.RawQuery = query.Encode()
+
+		client := &http.Client{Timeout: probeTimeout}
+		resp, err := client.Get(u.String())
+		if err != nil {
+			return err
+		}
+		defer func() { _ = resp.Body.Close() }()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return fmt.Errorf("Probe %s failed: %s", probeURL, resp.Status)
+		}
+		return nil
+	}
+}
+
+// allows returns true if the allowlist doesn't exclude version
+func (o PromoteOptions) allows(version string) bool {
+	if len(o.Allowlist) == 0 {
+		return true
+	}
+	for _, allowed := range o.Allowlist {
+		if allowed == version {
+			return true
+		}
+	}
+	return false
+}
+
+// PromoteCutoff is a time of day (Eastern) that releases have to be built
+// before to be promoted. It has minute granularity: the seconds of the build
+// time are ignored. For example, with a cutoff of 10:15, a release built at
+// 10:14:59 is promoted and one built at 10:15:00 isn't, unless Inclusive is set,
+// in which case releases built until 10:15:59 are promoted.
+type PromoteCutoff struct {
+	Hour      int
+	Minute    int
+	Inclusive bool
+}
+
+// Allows returns true if a release built at t (in Eastern) is before the
+// cutoff
+func (c PromoteCutoff) Allows(t time.Time) bool {
+	hour, minute, _ := t.Clock()
+	built := hour*60 + minute
+	cutoff := c.Hour*60 + c.Minute
+	if c.Inclusive {
+		return built <= cutoff
+	}
+	return built < cutoff
+}
+
+func (o PromoteOptions) cutoff() *PromoteCutoff {
+	if o.Cutoff != nil {
+		return o.Cutoff
+	}
+	if o.BeforeHourEastern != 0 {
+		return &PromoteCutoff{Hour: o.BeforeHourEastern}
+	}
+	return nil
+}
+
+// validateMinimumFromVersion checks that a minimum-from-version is a valid
+// version and, if version is set, older than it
+func validateMinimumFromVersion(minimum string, version string) error {
+	minimumVer, err := semver.Make(minimum)
+	if err != nil {
+		return fmt.Errorf("Invalid minimum from version %q: %s", minimum, err)
+	}
+	if version == "" {
+		return nil
+	}
+	ver, err := semver.Make(version)
+	if err != nil {
+		return err
+	}
+	if !minimumVer.LT(ver) {
+		return fmt.Errorf("Minimum from version %s isn't older than %s", minimum, version)
+	}
+	return nil
+}
+
+// lastPromoted returns when a channel's update JSON was last written
+func (c *Client) lastPromoted(bucketName string, jsonName string) (time.Time, error) {
+	resp, err := c.svc.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(jsonName),
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	return aws.TimeValue(resp.LastModified), nil
+}
+
+// releaseSize returns the size of the listed release for a version (from the
+// listing if there is one), or -1 if there is no release for it
+func (c *Client) releaseSize(bucketName string, platform Platform, listing *promotionListing, version string) (int64, error) {
+	release, err := c.findPromotable(bucketName, platform, listing, func(r Release) bool {
+		return r.Version == version
+	})
+	if err != nil {
+		return 0, err
+	}
+	if release == nil {
+		return -1, nil
+	}
+	return release.Size, nil
+}
+
+// sizeGrowthPercent is how much bigger size is than previous, as a percentage
+func sizeGrowthPercent(previous int64, size int64) float64 {
+	if previous <= 0 {
+		return 0
+	}
+	return float64(size-previous) * 100 / float64(previous)
+}
+
+// PromoteResult is the result of promoting a release
+type PromoteResult struct {
+	// Release is the release that was found to promote, if any
+	Release *Release
+	// Promoted is true if the release was promoted
+	Promoted bool
+	// Reason is why the release wasn't promoted
+	Reason string
+	// Platform, Channel and Env are what the promotion was for
+	Platform string
+	Channel  string
+	Env      string
+	// FromVersion is the version of the channel's update before promoting,
+	// if there was one
+	FromVersion string
+}
+
+// promoteResultJSON is the JSON form of a PromoteResult, for scripts
+type promoteResultJSON struct {
+	Promoted    bool   `json:"promoted"`
+	Platform    string `json:"platform"`
+	Channel     string `json:"channel"`
+	Env         string `json:"env"`
+	FromVersion string `json:"fromVersion"`
+	ToVersion   string `json:"toVersion"`
+	Arch        string `json:"arch,omitempty"`
+	Commit      string `json:"commit,omitempty"`
+	CommitURL   string `json:"commitURL,omitempty"`
+	Reason      string `json:"reason"`
+}
+
+// WriteJSON writes the result as a JSON object, so the outcome of a promotion
+// can be parsed by scripts. The toVersion is the release that was found, even
+// if it wasn't promoted.
+func (r PromoteResult) WriteJSON(writer io.Writer) error {
+	return r.WriteJSONWithCommitLength(writer, 0)
+}
+
+// WriteJSONWithCommitLength is WriteJSON with the commit truncated to
+// commitLength characters (defaultCommitLength if 0). The commitURL has the
+// full commit.
+func (r PromoteResult) WriteJSONWithCommitLength(writer io.Writer, commitLength int) error {
+	out := promoteResultJSON{
+		Promoted:    r.Promoted,
+		Platform:    r.Platform,
+		Channel:     r.Channel,
+		Env:         r.Env,
+		FromVersion: r.FromVersion,
+		Reason:      r.Reason,
+	}
+	if r.Release != nil {
+		out.ToVersion = r.Release.Version
+		out.Arch = r.Release.Arch
+		if r.Release.Commit != "" {
+			out.Commit = shortCommit(r.Release.Commit, commitLength)
+			out.CommitURL = commitURL(r.Release.Commit)
+		}
+	}
+	return json.NewEncoder(writer).Encode(out)
+}
+
+// smokeTestKey is the marker the smoke tests put in the bucket when a
+// platform's build of a version passes
+func smokeTestKey(platformName string, version string) string {
+	return fmt.Sprintf("smoketest-%s-%s.pass", platformName, version)
+}
+
+func signoffPrefix(version string) string {
+	return fmt.Sprintf("signoff-%s-", version)
+}
+
+const holdPrefix = "hold-"
+
+// HoldVersion puts a hold on a version, so it isn't promoted until the hold
+// is removed. The reason is logged when promoting skips it.
+func (c *Client) HoldVersion(bucketName string, version string, reason string) error {
+	_, err := c.svc.PutObject(&s3.PutObjectInput{
+		Bucket:        aws.String(bucketName),
+		Key:           aws.String(holdPrefix + version),
+		Body:          bytes.NewReader([]byte(reason)),
+		ContentLength: aws.Int64(int64(len(reason))),
+		ContentType:   aws.String("text/plain"),
+	})
+	return err
+}
+
+// UnholdVersion removes the hold on a version
+func (c *Client) UnholdVersion(bucketName string, version string) error {
+	_, err := c.svc.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(holdPrefix + version),
+	})
+	return err
+}
+
+// heldVersions returns the versions with a hold, with the hold's reason
+func (c *Client) heldVersions(bucketName string) (map[string]string, error) {
+	objs, err := c.listAllObjects(bucketName, holdPrefix)
+	if err != nil {
+		return nil, err
+	}
+	held := map[string]string{}
+	for _, obj := range objs {
+		resp, err := c.svc.GetObject(&s3.GetObjectInput{
+			Bucket: aws.String(bucketName),
+			Key:    obj.Key,
+		})
+		if err != nil {
+			return nil, err
+		}
+		reason, err := ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		held[strings.TrimPrefix(*obj.Key, holdPrefix)] = string(reason)
+	}
+	return held, nil
+}
+
+// countSignoffs returns the number of QA sign-off objects for a version
+func (c *Client) countSignoffs(bucketName string, version string) (int, error) {
+	objs, err := c.listAllObjects(bucketName, signoffPrefix(version))
+	if err != nil {
+		return 0, err
+	}
+	return len(objs), nil
+}
+
+// objectExists returns true if there is an object at key
+func (c *Client) objectExists(bucketName string, key string) (bool, error) {
+	_, err := c.svc.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(key),
+	})
+	if isNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// releaseFileName is the name of the release file for a version
+func (p Platform) releaseFileName(version string) (string, error) {
+	switch p.Name {
+	case PlatformTypeDarwin:
+		return fmt.Sprintf("Keybase-%s.dmg", version), nil
+	case PlatformTypeWindows:
+		return fmt.Sprintf("Keybase_%s.amd64.msi", version), nil
+	default:
+		return "", fmt.Errorf("Unsupported for this platform: %s", p.Name)
+	}
+}
+
+// PromoteSpecificVersion promotes a version to a channel, without looking for
+// the newest release. The release and its update JSON must exist. Promoting an
+// older version than the current update fails, unless force is set. An empty
+// env, or a channel of ConfigChannel, is the bucket config's.
+func (c *Client) PromoteSpecificVersion(bucketName string, version string, channel string, platformName string, env string, force bool) error {
+	channel, env, err := c.channelEnvDefaults(bucketName, channel, env)
+	if err != nil {
+		return err
+	}
+	return c.promoteSpecificVersion(bucketName, version, channel, platformName, env, force)
+}
+
+// checkVersionUploaded checks a version is valid and its release and update
+// JSON exist, returning the update JSON's key
+func (c *Client) checkVersionUploaded(bucketName string, platform Platform, env string, version string) (string, error) {
+	if _, err := semver.Make(version); err != nil {
+		return "", fmt.Errorf("Invalid version %q: %s", version, err)
+	}
+	fileName, err := platform.releaseFileName(version)
+	if err != nil {
+		return "", err
+	}
+	exists, err := c.objectExists(bucketName, platform.Prefix+fileName)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return "", fmt.Errorf("No release found for %s at %s%s", version, platform.Prefix, fileName)
+	}
+	jsonSource := platform.PrefixSupport + SupportUpdateName(platform.Name, env, version)
+	exists, err = c.objectExists(bucketName, jsonSource)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return "", fmt.Errorf("No update JSON found for %s at %s", version, jsonSource)
+	}
+	return jsonSource, nil
+}
+
+// promoteSpecificVersion is PromoteSpecificVersion without the bucket config
+// defaults, where an empty channel is the base channel
+func (c *Client) promoteSpecificVersion(bucketName string, version string, channel string, platformName string, env string, force bool) error {
+	platform, err := platformForName(platformName)
+	if err != nil {
+		return err
+	}
+	if _, err = c.checkVersionUploaded(bucketName, platform, env, version); err != nil {
+		return err
+	}
+
+	currentUpdate, _, err := c.CurrentUpdate(bucketName, channel, platform.Name, env)
+	if err != nil && !isNotFound(err) {
+		return fmt.Errorf("Error getting current update: %s", err)
+	}
+	if currentUpdate != nil {
+		currentVer, err := semver.Make(currentUpdate.Version)
+		if err != nil {
+			return err
+		}
+		releaseVer, _ := semver.Make(version)
+		if releaseVer.LT(currentVer) {
+			if !force {
+				return fmt.Errorf("Version %s is older than current update %s", version, currentUpdate.Version)
+			}
+			c.logf(VerbosityNormal, "Forcing downgrade from %s to %s", currentUpdate.Version, version)
+		}
+	}
+
+	jsonName := UpdateJSONName(channel, platform.Name, env)
+	return c.copyUpdateJSONVerified(bucketName, platform.PrefixSupport, SupportUpdateName(platform.Name, env, version), jsonName, version, "", promotionMetadata(c.PromotedBy, version))
+}
+
+// promoteCopyAttempts is how many times a promotion copy is tried before
+// giving up, if it can't be verified
+const promoteCopyAttempts = 3
+
+var promoteCopyRetryDelay = 2 * time.Second
+
+// copyUpdateJSONVerified copies an update JSON (name at prefix) to a channel
+// and reads it back, checking it's for version. If it isn't, the copy is
+// retried. If sourceETag is set, the copy fails if the source doesn't have it.
+// If metadata is set, it's merged into the source's.
+func (c *Client) copyUpdateJSONVerified(bucketName string, prefix string, name string, jsonName string, version string, sourceETag string, metadata map[string]*string) error {
+	jsonURL := urlString(bucketName, prefix, name)
+	sourceKey := normalizePrefix(prefix) + name
+	for attempt := 1; ; attempt++ {
+		c.logf(VerbosityNormal, "PutCopying %s to %s", jsonURL, jsonName)
+		input := &s3.CopyObjectInput{
+			Bucket:       aws.String(bucketName),
+			CopySource:   aws.String(jsonURL),
+			Key:          aws.String(jsonName),
+			CacheControl: aws.String(defaultCacheControl),
+			ACL:          aws.String("public-read"),
+		}
+		if sourceETag != "" {
+			input.CopySourceIfMatch = aws.String(quoteETag(sourceETag))
+		}
+		if metadata != nil {
+			if err := c.replaceCopyMetadata(input, bucketName, sourceKey, metadata); err != nil {
+				return err
+			}
+		}
+		_, err := c.svc.CopyObject(input)
+		if isPreconditionFailed(err) {
+			return fmt.Errorf("%s changed since it was reviewed (ETag isn't %s)", jsonURL, quoteETag(sourceETag))
+		}
+		if err != nil {
+			return err
+		}
+
+		upd, err := c.getUpdate(bucketName, jsonName)
+		if err == nil && upd.Version == version {
+			return nil
+		}
+		if err == nil {
+			err = fmt.Errorf("expected version %s, got %s", version, upd.Version)
+		}
+		if attempt >= promoteCopyAttempts {
+			return fmt.Errorf("Couldn't verify %s after %d attempts: %s", jsonName, attempt, err)
+		}
+		c.logf(VerbosityQuiet, "Couldn't verify %s (attempt %d): %s, retrying", jsonName, attempt, err)
+		time.Sleep(promoteCopyRetryDelay)
+	}
+}
+
+// replaceCopyMetadata sets a copy to replace its source's user metadata with
+// it merged with metadata. Replacing the metadata replaces the headers too,
+// so the source's are kept.
+func (c *Client) replaceCopyMetadata(input *s3.CopyObjectInput, bucketName string, sourceKey string, metadata map[string]*string) error {
+	head, err := c.svc.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(sourceKey),
+	})
+	if err != nil {
+		return fmt.Errorf("Error reading %s: %s", sourceKey, err)
+	}
+	merged := map[string]*string{}
+	for k, v := range head.Metadata {
+		merged[strings.ToLower(k)] = v
+	}
+	for k, v := range metadata {
+		merged[k] = v
+	}
+	input.Metadata = merged
+	input.MetadataDirective = aws.String(s3.MetadataDirectiveReplace)
+	input.ContentType = aws.String("application/json")
+	if aws.StringValue(head.ContentType) != "" {
+		input.ContentType = head.ContentType
+	}
+	if aws.StringValue(head.CacheControl) != "" {
+		input.CacheControl = head.CacheControl
+	}
+	if aws.StringValue(head.ContentDisposition) != "" {
+		input.ContentDisposition = head.ContentDisposition
+	}
+	if aws.StringValue(head.ContentEncoding) != "" {
+		input.ContentEncoding = head.ContentEncoding
+	}
+	if aws.StringValue(head.ContentLanguage) != "" {
+		input.ContentLanguage = head.ContentLanguage
+	}
+	return nil
+}
+
+// quoteETag returns an ETag with the quotes S3 has around it, whether or not
+// it was given with them
+func quoteETag(etag string) string {
+	return `"` + strings.Trim(etag, `"`) + `"`
+}
+
+// checkSourceETag checks an object still has the ETag it was reviewed with
+func (c *Client) checkSourceETag(bucketName string, key string, etag string) error {
+	head, err := c.svc.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return err
+	}
+	if actual := aws.StringValue(head.ETag); actual != quoteETag(etag) {
+		return fmt.Errorf("%s changed since it was reviewed: ETag is %s, expected %s", key, actual, quoteETag(etag))
+	}
+	return nil
+}
+
+// deltaPrefix is where deltas are uploaded. They're kept out of the release
+// prefixes, since a platform without a Suffix (windows) would list them as
+// releases.
+const deltaPrefix = "deltas/"
+
+// deltaKey is the key of the delta from one version of a platform to another
+func deltaKey(platform Platform, fromVersion string, toVersion string) string {
+	return fmt.Sprintf("%s%s-%s-%s.delta", deltaPrefix, platform.Name, fromVersion, toVersion)
+}
+
+// findDelta returns the delta from one version to another, or nil if there
+// isn't one
+func (c *Client) findDelta(bucketName string, platform Platform, fromVersion string, toVersion string) (*Delta, error) {
+	key := deltaKey(platform, fromVersion, toVersion)
+	exists, err := c.objectExists(bucketName, key)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		c.logf(VerbosityVerbose, "No delta at %s", key)
+		return nil, nil
+	}
+	return &Delta{FromVersion: fromVersion, URL: c.publicURLForKey(bucketName, key)}, nil
+}
+
+func sameDelta(a *Delta, b *Delta) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// putUpdateJSONVerified writes an update JSON to a channel and reads it back,
+// checking the version, minimum from version, required flag and delta were
+// written
+func (c *Client) putUpdateJSONVerified(bucketName string, jsonName string, upd Update, metadata map[string]*string) error {
+	data, err := json.MarshalIndent(upd, "", "  ")
+	if err != nil {
+		return err
+	}
+	c.logf(VerbosityNormal, "Putting %s (%s, minimum from %s, required %t)", jsonName, upd.Version, upd.MinimumFromVersion, upd.Required)
+	if upd.Delta != nil {
+		c.logf(VerbosityNormal, "With delta from %s: %s", upd.Delta.FromVersion, upd.Delta.URL)
+	}
+	_, err = c.svc.PutObject(&s3.PutObjectInput{
+		Bucket:        aws.String(bucketName),
+		Key:           aws.String(jsonName),
+		CacheControl:  aws.String(defaultCacheControl),
+		ACL:           aws.String("public-read"),
+		Body:          bytes.NewReader(data),
+		ContentLength: aws.Int64(int64(len(data))),
+		ContentType:   aws.String("application/json"),
+		Metadata:      metadata,
+	})
+	if err != nil {
+		return err
+	}
+
+	written, err := c.getUpdate(bucketName, jsonName)
+	if err != nil {
+		return fmt.Errorf("Couldn't verify %s: %s", jsonName, err)
+	}
+	if !sameDelta(written.Delta, upd.Delta) {
+		return fmt.Errorf("Couldn't verify %s: delta wasn't written", jsonName)
+	}
+	if written.RolloutPercent != upd.RolloutPercent {
+		return fmt.Errorf("Couldn't verify %s: expected rollout %d%%, got %d%%", jsonName, upd.RolloutPercent, written.RolloutPercent)
+	}
+	if written.Version != upd.Version || written.MinimumFromVersion != upd.MinimumFromVersion || written.Required != upd.Required {
+		return fmt.Errorf("Couldn't verify %s: expected %s (minimum from %s, required %t), got %s (minimum from %s, required %t)",
+			jsonName, upd.Version, upd.MinimumFromVersion, upd.Required, written.Version, written.MinimumFromVersion, written.Required)
+	}
+	return nil
+}
+
+// promoteVerifyAttempts is how many times PromoteAndVerify reads the channel
+// before failing, since reads after a write can be stale
+const promoteVerifyAttempts = 5
+
+var promoteVerifyRetryDelay = time.Second
+
+// PromoteAndVerify promotes a release, like PromoteReleaseWithOptions, then
+// reads the channel's update JSON back to check it's for the promoted
+// release, retrying for a bit in case the read is stale. If nothing was
+// promoted, there is nothing to verify.
+func (c *Client) PromoteAndVerify(bucketName string, toChannel string, platform Platform, env string, opts PromoteOptions) (*PromoteResult, error) {
+	result, err := c.PromoteReleaseWithOptions(bucketName, toChannel, platform, env, opts)
+	if err != nil || !result.Promoted {
+		return result, err
+	}
+
+	for attempt := 1; ; attempt++ {
+		currentUpdate, path, err := c.CurrentUpdate(bucketName, toChannel, platform.Name, env)
+		if err == nil && currentUpdate.Version == result.Release.Version {
+			c.logf(VerbosityNormal, "Verified %s is %s", path, currentUpdate.Version)
+			return result, nil
+		}
+		if err == nil {
+			err = fmt.Errorf("expected version %s, got %s", result.Release.Version, currentUpdate.Version)
+		}
+		if attempt >= promoteVerifyAttempts {
+			return result, fmt.Errorf("Promoted %s but couldn't verify %s: %s", result.Release.Version, path, err)
+		}
+		c.logf(VerbosityQuiet, "Couldn't verify %s (attempt %d): %s, retrying", path, attempt, err)
+		time.Sleep(promoteVerifyRetryDelay)
+	}
+}
@@ -0,0 +1,607 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/keybase/release/update/s3test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testBucket = "test-bucket"
+
+// seedDarwinRelease adds a darwin release and its support JSON
+func seedDarwinRelease(f *s3test.Bucket, version string) {
+	f.Put(testBucket, "darwin/Keybase-"+version+".dmg", "dmg "+version, time.Now())
+	putUpdateJSON(f, testBucket, "darwin-support/"+SupportUpdateName(PlatformTypeDarwin, "prod", version), version)
+}
+
+func currentTestUpdate(t *testing.T, c *Client, channel string) *Update {
+	upd, _, err := c.CurrentUpdate(testBucket, channel, PlatformTypeDarwin, "prod")
+	require.NoError(t, err)
+	return upd
+}
+
+func TestPromoteReleaseSignoffs(t *testing.T) {
+	f := newFakeS3()
+	version := "1.0.15-20160313013917+ab12cd3"
+	seedDarwinRelease(f, version)
+	f.Put(testBucket, "signoff-"+version+"-alice", "", time.Now())
+	f.Put(testBucket, "signoff-1.0.14-20160312013917+cd6f696-bob", "", time.Now())
+	c := newTestClient(f)
+
+	result, err := c.PromoteReleaseWithOptions(testBucket, "v2", platformDarwin, "prod", PromoteOptions{MinSignoffs: 2})
+	require.NoError(t, err)
+	assert.False(t, result.Promoted)
+	assert.Equal(t, "awaiting signoffs (1/2)", result.Reason)
+	assert.Nil(t, f.Get(testBucket, "update-darwin-prod-v2.json"))
+
+	f.Put(testBucket, "signoff-"+version+"-carol", "", time.Now())
+	result, err = c.PromoteReleaseWithOptions(testBucket, "v2", platformDarwin, "prod", PromoteOptions{MinSignoffs: 2})
+	require.NoError(t, err)
+	assert.True(t, result.Promoted)
+	assert.Equal(t, version, result.Release.Version)
+	assert.Equal(t, version, currentTestUpdate(t, c, "v2").Version)
+}
+
+func TestPromoteSpecificVersion(t *testing.T) {
+	f := newFakeS3()
+	older := "1.0.14-20160312013917+cd6f696"
+	newer := "1.0.15-20160313013917+ab12cd3"
+	seedDarwinRelease(f, older)
+	seedDarwinRelease(f, newer)
+	c := newTestClient(f)
+
+	err := c.PromoteSpecificVersion(testBucket, newer, "v2", PlatformTypeDarwin, "prod", false)
+	require.NoError(t, err)
+	assert.Equal(t, newer, currentTestUpdate(t, c, "v2").Version)
+
+	err = c.PromoteSpecificVersion(testBucket, older, "v2", PlatformTypeDarwin, "prod", false)
+	require.Error(t, err)
+	assert.Equal(t, newer, currentTestUpdate(t, c, "v2").Version)
+
+	err = c.PromoteSpecificVersion(testBucket, older, "v2", PlatformTypeDarwin, "prod", true)
+	require.NoError(t, err)
+	assert.Equal(t, older, currentTestUpdate(t, c, "v2").Version)
+}
+
+func TestPromoteSpecificVersionMissing(t *testing.T) {
+	f := newFakeS3()
+	version := "1.0.15-20160313013917+ab12cd3"
+	c := newTestClient(f)
+
+	err := c.PromoteSpecificVersion(testBucket, version, "v2", PlatformTypeDarwin, "prod", false)
+	require.Error(t, err)
+
+	// Release without update JSON
+	f.Put(testBucket, "darwin/Keybase-"+version+".dmg", "", time.Now())
+	err = c.PromoteSpecificVersion(testBucket, version, "v2", PlatformTypeDarwin, "prod", false)
+	require.Error(t, err)
+	assert.Nil(t, f.Get(testBucket, "update-darwin-prod-v2.json"))
+
+	err = c.PromoteSpecificVersion(testBucket, "bad", "v2", PlatformTypeDarwin, "prod", false)
+	require.Error(t, err)
+}
+
+func TestPromoteCutoff(t *testing.T) {
+	at := func(hour, minute, sec int) time.Time {
+		return time.Date(2016, 3, 12, hour, minute, sec, 0, time.UTC)
+	}
+	exclusive := PromoteCutoff{Hour: 10, Minute: 15}
+	inclusive := PromoteCutoff{Hour: 10, Minute: 15, Inclusive: true}
+	hourOnly := PromoteCutoff{Hour: 10}
+	cases := []struct {
+		built     time.Time
+		exclusive bool
+		inclusive bool
+		hourOnly  bool
+	}{
+		{at(0, 0, 0), true, true, true},
+		{at(9, 59, 59), true, true, true},
+		{at(10, 0, 0), true, true, false},
+		{at(10, 14, 59), true, true, false},
+		{at(10, 15, 0), false, true, false},
+		{at(10, 15, 59), false, true, false},
+		{at(10, 16, 0), false, false, false},
+		{at(23, 59, 59), false, false, false},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.exclusive, exclusive.Allows(c.built), "exclusive %s", c.built)
+		assert.Equal(t, c.inclusive, inclusive.Allows(c.built), "inclusive %s", c.built)
+		assert.Equal(t, c.hourOnly, hourOnly.Allows(c.built), "hour only %s", c.built)
+	}
+}
+
+func TestPromoteOptionsCutoff(t *testing.T) {
+	assert.Nil(t, PromoteOptions{}.cutoff())
+	assert.Equal(t, &PromoteCutoff{Hour: 10}, PromoteOptions{BeforeHourEastern: 10}.cutoff())
+	cutoff := &PromoteCutoff{Hour: 9, Minute: 30}
+	assert.Equal(t, cutoff, PromoteOptions{BeforeHourEastern: 10, Cutoff: cutoff}.cutoff())
+}
+
+func TestPromoteReleaseVerifiesCopy(t *testing.T) {
+	defer func(d time.Duration) { promoteCopyRetryDelay = d }(promoteCopyRetryDelay)
+	promoteCopyRetryDelay = 0
+	f := newFakeS3()
+	version := "1.0.15-20160313013917+ab12cd3"
+	seedDarwinRelease(f, version)
+	f.CorruptCopies = map[string]int{"update-darwin-prod-v2.json": 1}
+	c := newTestClient(f)
+
+	result, err := c.PromoteReleaseWithOptions(testBucket, "v2", platformDarwin, "prod", PromoteOptions{})
+	require.NoError(t, err)
+	assert.True(t, result.Promoted)
+	assert.Equal(t, version, currentTestUpdate(t, c, "v2").Version)
+
+	f.CorruptCopies = map[string]int{"update-darwin-prod-test-v2.json": promoteCopyAttempts}
+	_, err = c.PromoteReleaseWithOptions(testBucket, "test-v2", platformDarwin, "prod", PromoteOptions{})
+	require.Error(t, err)
+}
+
+func TestPromoteReleaseMinimumFromVersion(t *testing.T) {
+	f := newFakeS3()
+	version := "1.0.15-20160313013917+ab12cd3"
+	seedDarwinRelease(f, version)
+	c := newTestClient(f)
+
+	_, err := c.PromoteReleaseWithOptions(testBucket, "v2", platformDarwin, "prod", PromoteOptions{MinimumFromVersion: "not-a-version"})
+	require.Error(t, err)
+	_, err = c.PromoteReleaseWithOptions(testBucket, "v2", platformDarwin, "prod", PromoteOptions{MinimumFromVersion: "1.0.16"})
+	require.Error(t, err)
+	assert.Nil(t, f.Get(testBucket, "update-darwin-prod-v2.json"))
+
+	result, err := c.PromoteReleaseWithOptions(testBucket, "v2", platformDarwin, "prod", PromoteOptions{MinimumFromVersion: "1.0.12"})
+	require.NoError(t, err)
+	assert.True(t, result.Promoted)
+	upd := currentTestUpdate(t, c, "v2")
+	assert.Equal(t, version, upd.Version)
+	assert.Equal(t, "v"+version, upd.Name)
+	assert.Equal(t, "1.0.12", upd.MinimumFromVersion)
+}
+
+func TestPromoteReleaseWithoutMinimumFromVersion(t *testing.T) {
+	f := newFakeS3()
+	version := "1.0.15-20160313013917+ab12cd3"
+	seedDarwinRelease(f, version)
+	c := newTestClient(f)
+
+	result, err := c.PromoteReleaseWithOptions(testBucket, "v2", platformDarwin, "prod", PromoteOptions{})
+	require.NoError(t, err)
+	assert.True(t, result.Promoted)
+	assert.Equal(t, "", currentTestUpdate(t, c, "v2").MinimumFromVersion)
+	assert.NotContains(t, string(f.Get(testBucket, "update-darwin-prod-v2.json").Body), "minimumFromVersion")
+}
+
+func TestPromoteReleaseCooldown(t *testing.T) {
+	now := time.Date(2016, 3, 14, 12, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	f := newFakeS3()
+	older := "1.0.14-20160312013917+cd6f696"
+	newer := "1.0.15-20160313013917+ab12cd3"
+	seedDarwinRelease(f, newer)
+	f.Put(testBucket, UpdateJSONName("v2", PlatformTypeDarwin, "prod"), `{"version": "`+older+`"}`, now.Add(-30*time.Minute))
+	c := newTestClient(f)
+
+	opts := PromoteOptions{Cooldown: time.Hour}
+	result, err := c.PromoteReleaseWithOptions(testBucket, "v2", platformDarwin, "prod", opts)
+	require.NoError(t, err)
+	assert.False(t, result.Promoted)
+	assert.Equal(t, "within cooldown", result.Reason)
+	assert.Equal(t, older, currentTestUpdate(t, c, "v2").Version)
+
+	now = now.Add(31 * time.Minute)
+	result, err = c.PromoteReleaseWithOptions(testBucket, "v2", platformDarwin, "prod", opts)
+	require.NoError(t, err)
+	assert.True(t, result.Promoted)
+	assert.Equal(t, newer, currentTestUpdate(t, c, "v2").Version)
+}
+
+func TestPromoteResultWriteJSON(t *testing.T) {
+	f := newFakeS3()
+	older := "1.0.14-20160312013917+cd6f696"
+	newer := "1.0.15-20160313013917+ab12cd3"
+	seedDarwinRelease(f, newer)
+	putUpdateJSON(f, testBucket, UpdateJSONName("v2", PlatformTypeDarwin, "prod"), older)
+	c := newTestClient(f)
+
+	result, err := c.PromoteReleaseWithOptions(testBucket, "v2", platformDarwin, "prod", PromoteOptions{})
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, result.WriteJSON(&buf))
+	assert.JSONEq(t, `{"promoted": true, "platform": "darwin", "channel": "v2", "env": "prod",
+		"fromVersion": "`+older+`", "toVersion": "`+newer+`", "reason": "",
+		"commit": "ab12cd3", "commitURL": "https://github.com/keybase/client/commit/ab12cd3", "arch": "amd64"}`, buf.String())
+
+	result, err = c.PromoteReleaseWithOptions(testBucket, "v2", platformDarwin, "prod", PromoteOptions{})
+	require.NoError(t, err)
+	buf.Reset()
+	require.NoError(t, result.WriteJSON(&buf))
+	assert.JSONEq(t, `{"promoted": false, "platform": "darwin", "channel": "v2", "env": "prod",
+		"fromVersion": "`+newer+`", "toVersion": "`+newer+`", "reason": "unchanged",
+		"commit": "ab12cd3", "commitURL": "https://github.com/keybase/client/commit/ab12cd3", "arch": "amd64"}`, buf.String())
+}
+
+func TestPromoteReleaseAllowlist(t *testing.T) {
+	f := newFakeS3()
+	older := "1.0.14-20160312013917+cd6f696"
+	newer := "1.0.15-20160313013917+ab12cd3"
+	seedDarwinRelease(f, older)
+	seedDarwinRelease(f, newer)
+	c := newTestClient(f)
+
+	result, err := c.PromoteReleaseWithOptions(testBucket, "v2", platformDarwin, "prod", PromoteOptions{Allowlist: []string{"1.0.16-20160314013917+aaaaaaa"}})
+	require.NoError(t, err)
+	assert.False(t, result.Promoted)
+	assert.Equal(t, "not in allowlist", result.Reason)
+	assert.Nil(t, f.Get(testBucket, "update-darwin-prod-v2.json"))
+
+	// The newest is skipped for the allowed one
+	result, err = c.PromoteReleaseWithOptions(testBucket, "v2", platformDarwin, "prod", PromoteOptions{Allowlist: []string{older}})
+	require.NoError(t, err)
+	assert.True(t, result.Promoted)
+	assert.Equal(t, older, currentTestUpdate(t, c, "v2").Version)
+
+	// No allowlist, no restriction
+	result, err = c.PromoteReleaseWithOptions(testBucket, "v2", platformDarwin, "prod", PromoteOptions{})
+	require.NoError(t, err)
+	assert.True(t, result.Promoted)
+	assert.Equal(t, newer, currentTestUpdate(t, c, "v2").Version)
+}
+
+func TestPromoteReleaseSizeRegression(t *testing.T) {
+	older := "1.0.14-20160312013917+cd6f696"
+	newer := "1.0.15-20160313013917+ab12cd3"
+	seed := func(newSize int) *s3test.Bucket {
+		f := newFakeS3()
+		f.Put(testBucket, "darwin/Keybase-"+older+".dmg", strings.Repeat("x", 100), time.Now())
+		f.Put(testBucket, "darwin/Keybase-"+newer+".dmg", strings.Repeat("x", newSize), time.Now())
+		putUpdateJSON(f, testBucket, "darwin-support/"+SupportUpdateName(PlatformTypeDarwin, "prod", newer), newer)
+		putUpdateJSON(f, testBucket, UpdateJSONName("v2", PlatformTypeDarwin, "prod"), older)
+		return f
+	}
+	opts := PromoteOptions{MaxSizeGrowthPercent: 20}
+
+	// Within threshold
+	c := newTestClient(seed(120))
+	result, err := c.PromoteReleaseWithOptions(testBucket, "v2", platformDarwin, "prod", opts)
+	require.NoError(t, err)
+	assert.True(t, result.Promoted)
+	assert.Equal(t, newer, currentTestUpdate(t, c, "v2").Version)
+
+	// Over threshold
+	c = newTestClient(seed(150))
+	result, err = c.PromoteReleaseWithOptions(testBucket, "v2", platformDarwin, "prod", opts)
+	require.NoError(t, err)
+	assert.False(t, result.Promoted)
+	assert.Equal(t, "size regression (+50.0%)", result.Reason)
+	assert.Equal(t, older, currentTestUpdate(t, c, "v2").Version)
+}
+
+func TestPromoteReleaseSizeRegressionLinux(t *testing.T) {
+	older := "1.0.14-20160312013917+cd6f696"
+	newer := "1.0.15-20160313013917+ab12cd3"
+	// Linux has no release file name (see releaseFileName), so the sizes are
+	// from the listing
+	platform := platformLinuxDeb
+	platform.PrefixSupport = "linux_binaries/deb-support/"
+	f := newFakeS3()
+	f.Put(testBucket, platform.Prefix+"keybase_"+older+"_amd64.deb", strings.Repeat("x", 100), time.Now())
+	f.Put(testBucket, platform.Prefix+"keybase_"+newer+"_amd64.deb", strings.Repeat("x", 150), time.Now())
+	putUpdateJSON(f, testBucket, platform.PrefixSupport+SupportUpdateName(platform.Name, "prod", newer), newer)
+	putUpdateJSON(f, testBucket, UpdateJSONName("v2", platform.Name, "prod"), older)
+	c := newTestClient(f)
+
+	result, err := c.PromoteReleaseWithOptions(testBucket, "v2", platform, "prod", PromoteOptions{MaxSizeGrowthPercent: 20})
+	require.NoError(t, err)
+	assert.False(t, result.Promoted)
+	assert.Equal(t, "size regression (+50.0%)", result.Reason)
+
+	result, err = c.PromoteReleaseWithOptions(testBucket, "v2", platform, "prod", PromoteOptions{MaxSizeGrowthPercent: 60})
+	require.NoError(t, err)
+	assert.True(t, result.Promoted)
+}
+
+func TestPromoteReleaseHold(t *testing.T) {
+	f := newFakeS3()
+	older := "1.0.14-20160312013917+cd6f696"
+	newer := "1.0.15-20160313013917+ab12cd3"
+	seedDarwinRelease(f, newer)
+	c := newTestClient(f)
+
+	require.NoError(t, c.HoldVersion(testBucket, newer, "crash on launch"))
+	result, err := c.PromoteReleaseWithOptions(testBucket, "v2", platformDarwin, "prod", PromoteOptions{})
+	require.NoError(t, err)
+	assert.False(t, result.Promoted)
+	assert.Equal(t, "held", result.Reason)
+
+	// Older releases can still be promoted
+	seedDarwinRelease(f, older)
+	result, err = c.PromoteReleaseWithOptions(testBucket, "v2", platformDarwin, "prod", PromoteOptions{})
+	require.NoError(t, err)
+	assert.True(t, result.Promoted)
+	assert.Equal(t, older, currentTestUpdate(t, c, "v2").Version)
+
+	require.NoError(t, c.UnholdVersion(testBucket, newer))
+	result, err = c.PromoteReleaseWithOptions(testBucket, "v2", platformDarwin, "prod", PromoteOptions{})
+	require.NoError(t, err)
+	assert.True(t, result.Promoted)
+	assert.Equal(t, newer, currentTestUpdate(t, c, "v2").Version)
+}
+
+func TestPromoteReleaseProbe(t *testing.T) {
+	f := newFakeS3()
+	version := "1.0.15-20160313013917+ab12cd3"
+	seedDarwinRelease(f, version)
+	c := newTestClient(f)
+
+	var probed []string
+	failing := func(r Release) error {
+		probed = append(probed, r.Version)
+		return fmt.Errorf("unreachable")
+	}
+	result, err := c.PromoteReleaseWithOptions(testBucket, "v2", platformDarwin, "prod", PromoteOptions{Probe: failing})
+	require.NoError(t, err)
+	assert.False(t, result.Promoted)
+	assert.Equal(t, "canary failed", result.Reason)
+	assert.Equal(t, []string{version}, probed)
+	assert.Nil(t, f.Get(testBucket, "update-darwin-prod-v2.json"))
+
+	passing := func(r Release) error { return nil }
+	result, err = c.PromoteReleaseWithOptions(testBucket, "v2", platformDarwin, "prod", PromoteOptions{Probe: passing})
+	require.NoError(t, err)
+	assert.True(t, result.Promoted)
+}
+
+func TestHTTPProbe(t *testing.T) {
+	healthy := true
+	var query url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		if !healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	release := Release{Version: "1.0.15-20160313013917+ab12cd3", URL: "https://s3.amazonaws.com/bucket/darwin/Keybase.dmg"}
+	probe := HTTPProbe(server.URL + "/health?check=binary")
+	require.NoError(t, probe(release))
+	assert.Equal(t, release.Version, query.Get("version"))
+	assert.Equal(t, release.URL, query.Get("url"))
+	assert.Equal(t, "binary", query.Get("check"))
+
+	healthy = false
+	require.Error(t, probe(release))
+}
+
+func TestPromoteAndVerify(t *testing.T) {
+	defer func(d time.Duration) { promoteVerifyRetryDelay = d }(promoteVerifyRetryDelay)
+	promoteVerifyRetryDelay = 0
+	f := newFakeS3()
+	older := "1.0.14-20160312013917+cd6f696"
+	newer := "1.0.15-20160313013917+ab12cd3"
+	seedDarwinRelease(f, newer)
+	c := newTestClient(f)
+
+	jsonName := UpdateJSONName("v2", PlatformTypeDarwin, "prod")
+	stale := `{"version": "` + older + `"}`
+	fresh := `{"version": "` + newer + `"}`
+	// Promoting reads the current update, then the copy's own check reads
+	// fresh, then the channel is stale for a bit
+	f.GetBodies = map[string][]string{jsonName: {stale, fresh, stale, stale}}
+	result, err := c.PromoteAndVerify(testBucket, "v2", platformDarwin, "prod", PromoteOptions{})
+	require.NoError(t, err)
+	assert.True(t, result.Promoted)
+
+	bodies := []string{stale, fresh}
+	for i := 0; i < promoteVerifyAttempts; i++ {
+		bodies = append(bodies, stale)
+	}
+	f.GetBodies = map[string][]string{UpdateJSONName("test-v2", PlatformTypeDarwin, "prod"): bodies}
+	result, err = c.PromoteAndVerify(testBucket, "test-v2", platformDarwin, "prod", PromoteOptions{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "couldn't verify")
+	assert.True(t, result.Promoted)
+
+	// Nothing promoted, nothing to verify
+	result, err = c.PromoteAndVerify(testBucket, "v2", platformDarwin, "prod", PromoteOptions{})
+	require.NoError(t, err)
+	assert.False(t, result.Promoted)
+}
+
+func TestPromoteReleaseRequired(t *testing.T) {
+	f := newFakeS3()
+	older := "1.0.14-20160312013917+cd6f696"
+	newer := "1.0.15-20160313013917+ab12cd3"
+	seedDarwinRelease(f, older)
+	putUpdateJSON(f, testBucket, UpdateJSONName("v2", PlatformTypeDarwin, "prod"), newer)
+	c := newTestClient(f)
+
+	// Still has to pass the version checks
+	result, err := c.PromoteReleaseWithOptions(testBucket, "v2", platformDarwin, "prod", PromoteOptions{Required: true})
+	require.NoError(t, err)
+	assert.False(t, result.Promoted)
+	assert.Equal(t, "older than current update", result.Reason)
+	assert.False(t, currentTestUpdate(t, c, "v2").Required)
+
+	seedDarwinRelease(f, "1.0.16-20160314013917+ef01234")
+	result, err = c.PromoteReleaseWithOptions(testBucket, "v2", platformDarwin, "prod", PromoteOptions{Required: true})
+	require.NoError(t, err)
+	assert.True(t, result.Promoted)
+	upd := currentTestUpdate(t, c, "v2")
+	assert.Equal(t, "1.0.16-20160314013917+ef01234", upd.Version)
+	assert.True(t, upd.Required)
+}
+
+func TestPromoteResultWriteJSONCommitLength(t *testing.T) {
+	commit := "ab12cd34ef56ab12cd34ef56ab12cd34ef56ab12"
+	result := PromoteResult{Promoted: true, Release: &Release{Version: "1.0.15", Commit: commit}}
+	var buf bytes.Buffer
+	require.NoError(t, result.WriteJSONWithCommitLength(&buf, 10))
+	assert.Contains(t, buf.String(), `"commit":"ab12cd34ef"`)
+	assert.Contains(t, buf.String(), `"commitURL":"https://github.com/keybase/client/commit/`+commit+`"`)
+}
+
+func TestPromoteReleaseRequireSmokeTest(t *testing.T) {
+	f := newFakeS3()
+	version := "1.0.15-20160313013917+ab12cd3"
+	seedDarwinRelease(f, version)
+	f.Put(testBucket, "smoketest-windows-"+version+".pass", "", time.Now())
+	c := newTestClient(f)
+
+	result, err := c.PromoteReleaseWithOptions(testBucket, "v2", platformDarwin, "prod", PromoteOptions{RequireSmokeTest: true})
+	require.NoError(t, err)
+	assert.False(t, result.Promoted)
+	assert.Equal(t, "smoke test not passed", result.Reason)
+	assert.Nil(t, f.Get(testBucket, UpdateJSONName("v2", PlatformTypeDarwin, "prod")))
+
+	// All conditions must hold, so it's still too new for the delay
+	f.Put(testBucket, "smoketest-darwin-"+version+".pass", "", time.Now())
+	result, err = c.PromoteReleaseWithOptions(testBucket, "v2", platformDarwin, "prod", PromoteOptions{RequireSmokeTest: true, Delay: 24 * 365 * 100 * time.Hour})
+	require.NoError(t, err)
+	assert.False(t, result.Promoted)
+	assert.Equal(t, "no matching release", result.Reason)
+
+	result, err = c.PromoteReleaseWithOptions(testBucket, "v2", platformDarwin, "prod", PromoteOptions{RequireSmokeTest: true})
+	require.NoError(t, err)
+	assert.True(t, result.Promoted)
+}
+
+func TestPromoteReleaseDelta(t *testing.T) {
+	f := newFakeS3()
+	older := "1.0.14-20160312013917+cd6f696"
+	newer := "1.0.15-20160313013917+ab12cd3"
+	seedDarwinRelease(f, newer)
+	putUpdateJSON(f, testBucket, UpdateJSONName("v2", PlatformTypeDarwin, "prod"), older)
+	putUpdateJSON(f, testBucket, UpdateJSONName("test-v2", PlatformTypeDarwin, "prod"), older)
+	c := newTestClient(f)
+
+	// No delta, promoted without one
+	result, err := c.PromoteReleaseWithOptions(testBucket, "test-v2", platformDarwin, "prod", PromoteOptions{IncludeDelta: true})
+	require.NoError(t, err)
+	assert.True(t, result.Promoted)
+	assert.Nil(t, currentTestUpdate(t, c, "test-v2").Delta)
+
+	key := deltaKey(platformDarwin, older, newer)
+	assert.Equal(t, "deltas/darwin-"+older+"-"+newer+".delta", key)
+	f.Put(testBucket, key, "delta", time.Now())
+	result, err = c.PromoteReleaseWithOptions(testBucket, "v2", platformDarwin, "prod", PromoteOptions{IncludeDelta: true})
+	require.NoError(t, err)
+	assert.True(t, result.Promoted)
+	upd := currentTestUpdate(t, c, "v2")
+	assert.Equal(t, newer, upd.Version)
+	require.NotNil(t, upd.Delta)
+	assert.Equal(t, older, upd.Delta.FromVersion)
+	assert.Equal(t, c.publicURLForKey(testBucket, key), upd.Delta.URL)
+}
+
+func TestDeltasNotListedAsReleases(t *testing.T) {
+	f := newFakeS3()
+	older := "1.0.14-20160312013917+cd6f696"
+	newer := "1.0.15-20160313013917+ab12cd3"
+	f.Put(testBucket, "windows/Keybase_"+newer+".amd64.msi", "msi", time.Now())
+	f.Put(testBucket, deltaKey(platformWindows, older, newer), "delta", time.Now())
+	c := newTestClient(f)
+
+	releases, err := c.listReleases(testBucket, platformWindows.Prefix, platformWindows.Suffix, 0)
+	require.NoError(t, err)
+	require.Len(t, releases, 1)
+	assert.Equal(t, "Keybase_"+newer+".amd64.msi", releases[0].Name)
+}
+
+func TestPromoteReleaseRebuild(t *testing.T) {
+	f := newFakeS3()
+	current := "1.0.15-20160313013917+ab12cd3"
+	rebuild := "1.0.15-20160313013917+ef56ab7"
+	seedDarwinRelease(f, rebuild)
+	putUpdateJSON(f, testBucket, UpdateJSONName("v2", PlatformTypeDarwin, "prod"), current)
+	c := newTestClient(f)
+
+	result, err := c.PromoteReleaseWithOptions(testBucket, "v2", platformDarwin, "prod", PromoteOptions{})
+	require.NoError(t, err)
+	assert.False(t, result.Promoted)
+	assert.Equal(t, "rebuild of current update", result.Reason)
+	assert.Equal(t, current, currentTestUpdate(t, c, "v2").Version)
+
+	result, err = c.PromoteReleaseWithOptions(testBucket, "v2", platformDarwin, "prod", PromoteOptions{PromoteRebuilds: true})
+	require.NoError(t, err)
+	assert.True(t, result.Promoted)
+	assert.Equal(t, rebuild, currentTestUpdate(t, c, "v2").Version)
+
+	// Now it's the same build
+	result, err = c.PromoteReleaseWithOptions(testBucket, "v2", platformDarwin, "prod", PromoteOptions{PromoteRebuilds: true})
+	require.NoError(t, err)
+	assert.False(t, result.Promoted)
+	assert.Equal(t, "unchanged", result.Reason)
+}
+
+func TestPromoteReleaseSourceETag(t *testing.T) {
+	f := newFakeS3()
+	version := "1.0.15-20160313013917+ab12cd3"
+	seedDarwinRelease(f, version)
+	supportKey := "darwin-support/" + SupportUpdateName(PlatformTypeDarwin, "prod", version)
+	reviewed := strings.Trim(f.Get(testBucket, supportKey).ETag(), `"`)
+	c := newTestClient(f)
+
+	// Changed after it was reviewed
+	f.Put(testBucket, supportKey, `{"version": "`+version+`", "name": "changed"}`, time.Now())
+	_, err := c.PromoteReleaseWithOptions(testBucket, "v2", platformDarwin, "prod", PromoteOptions{SourceETag: reviewed})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "changed since it was reviewed")
+	assert.Nil(t, f.Get(testBucket, UpdateJSONName("v2", PlatformTypeDarwin, "prod")))
+
+	current := f.Get(testBucket, supportKey).ETag()
+	result, err := c.PromoteReleaseWithOptions(testBucket, "v2", platformDarwin, "prod", PromoteOptions{SourceETag: current})
+	require.NoError(t, err)
+	assert.True(t, result.Promoted)
+
+	// The copy itself is conditional too
+	err = c.copyUpdateJSONVerified(testBucket, "darwin-support/", SupportUpdateName(PlatformTypeDarwin, "prod", version), UpdateJSONName("test-v2", PlatformTypeDarwin, "prod"), version, reviewed, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "changed since it was reviewed")
+}
+
+// changeAfterHead is a bucket where an object changes right after it's HEADed,
+// as if it was overwritten between two requests
+type changeAfterHead struct {
+	*s3test.Bucket
+	key  string
+	body string
+}
+
+func (b *changeAfterHead) HeadObject(input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+	head, err := b.Bucket.HeadObject(input)
+	if *input.Key == b.key {
+		b.Put(*input.Bucket, b.key, b.body, time.Now())
+	}
+	return head, err
+}
+
+func TestPromoteReleaseSourceETagPut(t *testing.T) {
+	f := newFakeS3()
+	version := "1.0.15-20160313013917+ab12cd3"
+	seedDarwinRelease(f, version)
+	supportKey := "darwin-support/" + SupportUpdateName(PlatformTypeDarwin, "prod", version)
+	reviewed := f.Get(testBucket, supportKey).ETag()
+	c := NewClientWithS3(&changeAfterHead{Bucket: f, key: supportKey, body: `{"version": "` + version + `", "name": "changed"}`})
+
+	// Writing the update JSON (for Required) reads the support JSON after
+	// its ETag is checked, so it's read conditionally too
+	_, err := c.PromoteReleaseWithOptions(testBucket, "v2", platformDarwin, "prod", PromoteOptions{SourceETag: reviewed, Required: true})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "changed since it was reviewed")
+	assert.Nil(t, f.Get(testBucket, UpdateJSONName("v2", PlatformTypeDarwin, "prod")))
+}
@@ -0,0 +1,171 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// PromotionManifest points at the objects for a channel's promoted version,
+// written by promotions with ManifestSwap. The objects are staged under a
+// prefix for the promotion (see promotionStagePrefix) before the manifest is
+// replaced, so the manifest never points at a partial promotion.
+//
+// Clients read a channel consistently by:
+//
+//  1. Getting the manifest, update-<platform>-<env>[-<channel>].manifest.json
+//  2. Getting UpdateJSON, Latest and VersionTxt from the manifest. Each
+//     promotion stages to a new prefix, even of the same version, so they
+//     aren't changed once they're staged and they're all for Version, even
+//     if the manifest has been replaced since.
+//
+// Staged objects are never deleted, so a bucket lifecycle rule on promotions/
+// should only expire them once no client could still be reading them.
+//
+// The channel JSON is still written after the manifest (and LatestName by
+// CopyLatest), for clients that read them directly, but without the
+// guarantee.
+type PromotionManifest struct {
+	Version    string    `json:"version"`
+	UpdateJSON string    `json:"updateJSON"`
+	Latest     string    `json:"latest"`
+	VersionTxt string    `json:"versionTxt"`
+	PromotedAt time.Time `json:"promotedAt"`
+}
+
+// promotionManifestName is the key of the manifest for a channel, next to its
+// update JSON
+func promotionManifestName(channel string, platformName string, env string) string {
+	return strings.TrimSuffix(UpdateJSONName(channel, platformName, env), ".json") + ".manifest.json"
+}
+
+// promotionStageTimeFormat is the format of the promotion time in a staging
+// prefix
+const promotionStageTimeFormat = "20060102T150405.000000000Z"
+
+// promotionStagePrefix is where the objects for a promotion of a channel's
+// version are staged, by version and promotion time, for example
+// promotions/update-darwin-prod-v2/1.0.15-20160313013917+ab12cd3/20160314T120000.000000000Z/
+func promotionStagePrefix(channel string, platformName string, env string, version string, promotedAt time.Time) string {
+	return fmt.Sprintf("promotions/%s/%s/%s/", strings.TrimSuffix(UpdateJSONName(channel, platformName, env), ".json"), version, promotedAt.UTC().Format(promotionStageTimeFormat))
+}
+
+// stagePromotion writes the objects for promoting a release under its staging
+// prefix: the update JSON (upd, or if it's nil, a copy of the release's
+// support JSON, which must have sourceETag if it's set), the release as
+// LatestName and version.txt
+func (c *Client) stagePromotion(bucketName string, platform Platform, channel string, env string, release Release, upd *Update, sourceETag string) (*PromotionManifest, error) {
+	promotedAt := timeNow().UTC()
+	stage := promotionStagePrefix(channel, platform.Name, env, release.Version, promotedAt)
+	manifest := &PromotionManifest{
+		Version:    release.Version,
+		UpdateJSON: stage + "update.json",
+		Latest:     stage + platform.LatestName,
+		VersionTxt: stage + "version.txt",
+		PromotedAt: promotedAt,
+	}
+
+	c.logf(VerbosityNormal, "Staging %s at %s", release.Version, stage)
+	if upd != nil {
+		data, err := json.MarshalIndent(upd, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		if err := c.putPromotionObject(bucketName, manifest.UpdateJSON, data, "application/json"); err != nil {
+			return nil, err
+		}
+	} else {
+		jsonURL := urlString(bucketName, platform.PrefixSupport, SupportUpdateName(platform.Name, env, release.Version))
+		input := &s3.CopyObjectInput{
+			Bucket:       aws.String(bucketName),
+			CopySource:   aws.String(jsonURL),
+			Key:          aws.String(manifest.UpdateJSON),
+			CacheControl: aws.String(defaultCacheControl),
+			ACL:          aws.String("public-read"),
+		}
+		if sourceETag != "" {
+			input.CopySourceIfMatch = aws.String(quoteETag(sourceETag))
+		}
+		_, err := c.svc.CopyObject(input)
+		if isPreconditionFailed(err) {
+			return nil, fmt.Errorf("%s changed since it was reviewed (ETag isn't %s)", jsonURL, quoteETag(sourceETag))
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	input, err := c.latestCopyInput(bucketName, platform, release.Key)
+	if err != nil {
+		return nil, err
+	}
+	input.Key = aws.String(manifest.Latest)
+	if _, err := c.svc.CopyObject(input); err != nil {
+		return nil, err
+	}
+
+	if err := c.putPromotionObject(bucketName, manifest.VersionTxt, []byte(release.Version+"\n"), "text/plain"); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+func (c *Client) putPromotionObject(bucketName string, key string, data []byte, contentType string) error {
+	_, err := c.svc.PutObject(&s3.PutObjectInput{
+		Bucket:        aws.String(bucketName),
+		Key:           aws.String(key),
+		CacheControl:  aws.String(defaultCacheControl),
+		ACL:           aws.String("public-read"),
+		Body:          bytes.NewReader(data),
+		ContentLength: aws.Int64(int64(len(data))),
+		ContentType:   aws.String(contentType),
+	})
+	return err
+}
+
+// swapPromotionManifest stages the objects for promoting a release (see
+// stagePromotion) and then points the channel's manifest at them, in a
+// single put
+func (c *Client) swapPromotionManifest(bucketName string, platform Platform, channel string, env string, release Release, upd *Update, sourceETag string) error {
+	manifest, err := c.stagePromotion(bucketName, platform, channel, env, release, upd, sourceETag)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	manifestName := promotionManifestName(channel, platform.Name, env)
+	c.logf(VerbosityNormal, "Swapping %s to %s", manifestName, release.Version)
+	return c.putPromotionObject(bucketName, manifestName, data, "application/json")
+}
+
+// ReadPromotionManifest returns a channel's manifest, or nil if it has none
+// (it hasn't been promoted with ManifestSwap)
+func (c *Client) ReadPromotionManifest(bucketName string, channel string, platformName string, env string) (*PromotionManifest, error) {
+	manifestName := promotionManifestName(channel, platformName, env)
+	resp, err := c.svc.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(manifestName),
+	})
+	if isNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var manifest PromotionManifest
+	if err := json.NewDecoder(resp.Body).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("Invalid manifest %s: %s", manifestName, err)
+	}
+	return &manifest, nil
+}
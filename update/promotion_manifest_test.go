@@ -0,0 +1,94 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPromoteReleaseManifestSwap(t *testing.T) {
+	f := newFakeS3()
+	version := "1.0.15-20160313013917+ab12cd3"
+	seedDarwinRelease(f, version)
+	c := newTestClient(f)
+	now := time.Date(2016, 3, 14, 12, 0, 0, 0, time.UTC)
+	defer func(orig func() time.Time) { timeNow = orig }(timeNow)
+	timeNow = func() time.Time { return now }
+
+	manifest, err := c.ReadPromotionManifest(testBucket, "v2", PlatformTypeDarwin, "prod")
+	require.NoError(t, err)
+	assert.Nil(t, manifest)
+
+	result, err := c.PromoteReleaseWithOptions(testBucket, "v2", platformDarwin, "prod", PromoteOptions{ManifestSwap: true})
+	require.NoError(t, err)
+	require.True(t, result.Promoted)
+
+	manifest, err = c.ReadPromotionManifest(testBucket, "v2", PlatformTypeDarwin, "prod")
+	require.NoError(t, err)
+	require.NotNil(t, manifest)
+	stage := "promotions/update-darwin-prod-v2/" + version + "/20160314T120000.000000000Z/"
+	assert.Equal(t, PromotionManifest{
+		Version:    version,
+		UpdateJSON: stage + "update.json",
+		Latest:     stage + "Keybase.dmg",
+		VersionTxt: stage + "version.txt",
+		PromotedAt: now,
+	}, *manifest)
+
+	upd, err := c.getUpdate(testBucket, manifest.UpdateJSON)
+	require.NoError(t, err)
+	assert.Equal(t, version, upd.Version)
+	latest := f.Get(testBucket, manifest.Latest)
+	require.NotNil(t, latest)
+	assert.Equal(t, "dmg "+version, string(latest.Body))
+	assert.Equal(t, `attachment; filename="Keybase-`+version+`.dmg"`, latest.ContentDisposition)
+	assert.Equal(t, version+"\n", string(f.Get(testBucket, manifest.VersionTxt).Body))
+	// The channel JSON is still written for clients that read it directly
+	assert.Equal(t, version, currentTestUpdate(t, c, "v2").Version)
+
+	// A written (not copied) update JSON is staged as written
+	newer := "1.0.16-20160314013917+ef01234"
+	seedDarwinRelease(f, newer)
+	_, err = c.PromoteReleaseWithOptions(testBucket, "v2", platformDarwin, "prod", PromoteOptions{ManifestSwap: true, Required: true})
+	require.NoError(t, err)
+	manifest, err = c.ReadPromotionManifest(testBucket, "v2", PlatformTypeDarwin, "prod")
+	require.NoError(t, err)
+	assert.Equal(t, newer, manifest.Version)
+	upd, err = c.getUpdate(testBucket, manifest.UpdateJSON)
+	require.NoError(t, err)
+	assert.True(t, upd.Required)
+	// The previous version's staged objects are left for readers of the old
+	// manifest
+	assert.NotNil(t, f.Get(testBucket, stage+"update.json"))
+
+	// Staging the same version again stages it afresh, so readers of the old
+	// manifest still see the objects it points at
+	staged := string(f.Get(testBucket, manifest.UpdateJSON).Body)
+	previous := *manifest
+	now = now.Add(time.Minute)
+	release := Release{Version: newer, Key: "darwin/Keybase-" + newer + ".dmg"}
+	require.NoError(t, c.swapPromotionManifest(testBucket, platformDarwin, "v2", "prod", release, &Update{Version: newer}, ""))
+	manifest, err = c.ReadPromotionManifest(testBucket, "v2", PlatformTypeDarwin, "prod")
+	require.NoError(t, err)
+	assert.Equal(t, newer, manifest.Version)
+	assert.NotEqual(t, previous.UpdateJSON, manifest.UpdateJSON)
+	assert.Equal(t, staged, string(f.Get(testBucket, previous.UpdateJSON).Body))
+}
+
+func TestPromoteReleaseManifestSwapFailure(t *testing.T) {
+	f := newFakeS3()
+	version := "1.0.15-20160313013917+ab12cd3"
+	seedDarwinRelease(f, version)
+	c := newTestClient(f)
+
+	// Staging fails, so the manifest isn't swapped
+	err := c.swapPromotionManifest(testBucket, platformDarwin, "v2", "prod", Release{Version: version, Key: "darwin/Keybase-" + version + ".dmg"}, nil, "0123456789abcdef")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "changed since it was reviewed")
+	assert.Nil(t, f.Get(testBucket, promotionManifestName("v2", PlatformTypeDarwin, "prod")))
+}
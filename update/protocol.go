@@ -42,6 +42,23 @@ type Update struct {
 	PublishedAt  *Time      `codec:"publishedAt,omitempty" json:"publishedAt,omitempty"`
 	Props        []Property `codec:"props" json:"props,omitempty"`
 	Asset        *Asset     `codec:"asset,omitempty" json:"asset,omitempty"`
+	// MinimumFromVersion, if set, is the oldest installed version that can
+	// update directly to this one
+	MinimumFromVersion string `codec:"minimumFromVersion,omitempty" json:"minimumFromVersion,omitempty"`
+	// Required updates can't be deferred by clients
+	Required bool `codec:"required,omitempty" json:"required,omitempty"`
+	// Delta, if set, is a binary patch to this version from a previous one,
+	// which clients at that version can download instead of the asset
+	Delta *Delta `codec:"delta,omitempty" json:"delta,omitempty"`
+	// RolloutPercent, if set, is the percentage of clients that should take
+	// the update (see Ring). If 0, it's all of them.
+	RolloutPercent int `codec:"rolloutPercent,omitempty" json:"rolloutPercent,omitempty"`
+}
+
+// Delta is a binary patch from one version to another
+type Delta struct {
+	FromVersion string `codec:"fromVersion" json:"fromVersion"`
+	URL         string `codec:"url" json:"url"`
 }
 
 // Time as millis
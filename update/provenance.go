@@ -0,0 +1,70 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// PromotionProvenance is who promoted a channel's update JSON, when, and the
+// version of the release it was promoted from, as stamped into its user
+// metadata (x-amz-meta-promoted-by, promoted-at and source-version)
+type PromotionProvenance struct {
+	PromotedBy    string
+	PromotedAt    time.Time
+	SourceVersion string
+}
+
+// promotionMetadata is the user metadata stamped on a promoted update JSON.
+// If promotedBy is empty, it's left out.
+func promotionMetadata(promotedBy string, sourceVersion string) map[string]*string {
+	metadata := map[string]*string{
+		"promoted-at":    aws.String(timeNow().UTC().Format(time.RFC3339)),
+		"source-version": aws.String(sourceVersion),
+	}
+	if promotedBy != "" {
+		metadata["promoted-by"] = aws.String(promotedBy)
+	}
+	return metadata
+}
+
+// promotedBy is who a promotion is stamped as by, the option if it's set or
+// else Client.PromotedBy
+func (c *Client) promotedBy(opts PromoteOptions) string {
+	if opts.PromotedBy != "" {
+		return opts.PromotedBy
+	}
+	return c.PromotedBy
+}
+
+// ReadPromotionProvenance returns the provenance of a channel's update JSON
+// from a HEAD of it, or nil if it wasn't stamped (it was written by something
+// other than a promotion)
+func (c *Client) ReadPromotionProvenance(bucketName string, channel string, platformName string, env string) (*PromotionProvenance, error) {
+	jsonName := UpdateJSONName(channel, platformName, env)
+	resp, err := c.svc.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(jsonName),
+	})
+	if err != nil {
+		return nil, err
+	}
+	promotedAt := metadataValue(resp.Metadata, "promoted-at")
+	if promotedAt == "" {
+		return nil, nil
+	}
+	provenance := &PromotionProvenance{
+		PromotedBy:    metadataValue(resp.Metadata, "promoted-by"),
+		SourceVersion: metadataValue(resp.Metadata, "source-version"),
+	}
+	provenance.PromotedAt, err = time.Parse(time.RFC3339, promotedAt)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid promoted-at %q in metadata for %s: %s", promotedAt, jsonName, err)
+	}
+	return provenance, nil
+}
@@ -0,0 +1,79 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPromoteReleaseProvenance(t *testing.T) {
+	f := newFakeS3()
+	version := "1.0.15-20160313013917+ab12cd3"
+	seedDarwinRelease(f, version)
+	c := newTestClient(f)
+	c.PromotedBy = "release-bot"
+	now := time.Date(2016, 3, 14, 12, 0, 0, 0, time.UTC)
+	defer func(orig func() time.Time) { timeNow = orig }(timeNow)
+	timeNow = func() time.Time { return now }
+
+	// A copied support JSON
+	result, err := c.PromoteReleaseWithOptions(testBucket, "v2", platformDarwin, "prod", PromoteOptions{PromotedBy: "alice"})
+	require.NoError(t, err)
+	require.True(t, result.Promoted)
+	provenance, err := c.ReadPromotionProvenance(testBucket, "v2", PlatformTypeDarwin, "prod")
+	require.NoError(t, err)
+	require.NotNil(t, provenance)
+	assert.Equal(t, PromotionProvenance{PromotedBy: "alice", PromotedAt: now, SourceVersion: version}, *provenance)
+	// Replacing the metadata keeps it JSON
+	assert.Equal(t, "application/json", f.Get(testBucket, UpdateJSONName("v2", PlatformTypeDarwin, "prod")).ContentType)
+	assert.Equal(t, version, currentTestUpdate(t, c, "v2").Version)
+
+	// A written update JSON, by the client's PromotedBy
+	newer := "1.0.16-20160314013917+ef01234"
+	seedDarwinRelease(f, newer)
+	_, err = c.PromoteReleaseWithOptions(testBucket, "v2", platformDarwin, "prod", PromoteOptions{Required: true})
+	require.NoError(t, err)
+	provenance, err = c.ReadPromotionProvenance(testBucket, "v2", PlatformTypeDarwin, "prod")
+	require.NoError(t, err)
+	assert.Equal(t, PromotionProvenance{PromotedBy: "release-bot", PromotedAt: now, SourceVersion: newer}, *provenance)
+}
+
+func TestReadPromotionProvenanceUnstamped(t *testing.T) {
+	f := newFakeS3()
+	version := "1.0.15-20160313013917+ab12cd3"
+	putUpdateJSON(f, testBucket, UpdateJSONName("v2", PlatformTypeDarwin, "prod"), version)
+	c := newTestClient(f)
+
+	provenance, err := c.ReadPromotionProvenance(testBucket, "v2", PlatformTypeDarwin, "prod")
+	require.NoError(t, err)
+	assert.Nil(t, provenance)
+
+	_, err = c.ReadPromotionProvenance(testBucket, "test-v2", PlatformTypeDarwin, "prod")
+	require.Error(t, err)
+}
+
+func TestPromoteReleaseProvenanceKeepsSourceMetadata(t *testing.T) {
+	f := newFakeS3()
+	version := "1.0.15-20160313013917+ab12cd3"
+	seedDarwinRelease(f, version)
+	supportKey := "darwin-support/" + SupportUpdateName(PlatformTypeDarwin, "prod", version)
+	source := f.Get(testBucket, supportKey)
+	source.ContentType = "application/json; charset=utf-8"
+	source.CacheControl = "max-age=300"
+	source.Metadata = map[string]string{"Commit": "ab12cd3"}
+	c := newTestClient(f)
+
+	_, err := c.PromoteReleaseWithOptions(testBucket, "v2", platformDarwin, "prod", PromoteOptions{PromotedBy: "alice"})
+	require.NoError(t, err)
+	copied := f.Get(testBucket, UpdateJSONName("v2", PlatformTypeDarwin, "prod"))
+	assert.Equal(t, "application/json; charset=utf-8", copied.ContentType)
+	assert.Equal(t, "max-age=300", copied.CacheControl)
+	assert.Equal(t, "ab12cd3", copied.Metadata["commit"])
+	assert.Equal(t, "alice", copied.Metadata["promoted-by"])
+	assert.Equal(t, version, copied.Metadata["source-version"])
+}
@@ -0,0 +1,57 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// qrCodeSize is the width (and height) in pixels of the QR code PNGs
+const qrCodeSize = 128
+
+// LatestDownload is a platform's latest download URL, for the summary at the
+// top of the index (with HTMLQRCodes)
+type LatestDownload struct {
+	Platform string
+	URL      string
+	// QRCode is the URL as a QR code, a PNG data URI for an img src
+	QRCode string
+}
+
+// qrCodeDataURI encodes s as a QR code PNG data URI
+func qrCodeDataURI(s string) (string, error) {
+	png, err := qrcode.Encode(s, qrcode.Medium, qrCodeSize)
+	if err != nil {
+		return "", fmt.Errorf("Error encoding QR code for %s: %s", s, err)
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(png), nil
+}
+
+// latestDownloads are the latest download URLs, with QR codes, for the
+// platforms whose prefix is one of the (ungrouped) sections, if HTMLQRCodes is
+// set
+func (c *Client) latestDownloads(bucketName string, sections []Section) ([]LatestDownload, error) {
+	if !c.HTMLQRCodes {
+		return nil, nil
+	}
+	var latest []LatestDownload
+	for _, platform := range platformsAll {
+		for _, section := range sections {
+			if section.Header != platform.Prefix || len(section.Releases) == 0 {
+				continue
+			}
+			url := c.LatestURL(bucketName, platform)
+			qr, err := qrCodeDataURI(url)
+			if err != nil {
+				return nil, err
+			}
+			latest = append(latest, LatestDownload{Platform: platform.Name, URL: url, QRCode: qr})
+			break
+		}
+	}
+	return latest, nil
+}
@@ -0,0 +1,67 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteHTMLQRCodes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestWriteHTMLQRCodes")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	f := newFakeS3()
+	f.Put(testBucket, "darwin/Keybase-1.0.15-20160313013917+ab12cd3.dmg", "dmg", time.Now())
+	f.Put(testBucket, "windows/Keybase_2.0.0-20160402013917+ef56ab7.amd64.msi", "msi", time.Now())
+	c := newTestClient(f)
+	outPath := filepath.Join(dir, "index.html")
+
+	// Off by default
+	require.NoError(t, c.WriteHTML(testBucket, "darwin/,windows/", "", outPath, ""))
+	data, err := ioutil.ReadFile(outPath)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "<table>")
+	assert.NotContains(t, string(data), "data:image/png")
+
+	// Sections are grouped after the platforms are matched to prefixes
+	c.HTMLQRCodes = true
+	c.HTMLGrouping = GroupByMajorVersion
+	require.NoError(t, c.WriteHTML(testBucket, "darwin/,windows/", "", outPath, ""))
+	data, err = ioutil.ReadFile(outPath)
+	require.NoError(t, err)
+	html := string(data)
+	darwinURL := c.LatestURL(testBucket, platformDarwin)
+	windowsURL := c.LatestURL(testBucket, platformWindows)
+	assert.Contains(t, html, `<a href="`+darwinURL+`">darwin</a>`)
+	assert.Contains(t, html, `<a href="`+windowsURL+`">windows</a>`)
+	assert.Equal(t, 2, strings.Count(html, `<img src="data:image/png;base64,`))
+
+	// Prefixes without a trailing slash match too
+	require.NoError(t, c.WriteHTML(testBucket, "darwin,windows,darwin/", "", outPath, ""))
+	data, err = ioutil.ReadFile(outPath)
+	require.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(string(data), `<img src="data:image/png;base64,`))
+
+	latest, err := c.latestDownloads(testBucket, []Section{{Header: "darwin/", Releases: []Release{{Name: "Keybase.dmg"}}}, {Header: "linux_binaries/deb/"}})
+	require.NoError(t, err)
+	require.Len(t, latest, 1)
+	assert.Equal(t, darwinURL, latest[0].URL)
+	b, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(latest[0].QRCode, "data:image/png;base64,"))
+	require.NoError(t, err)
+	img, err := png.Decode(bytes.NewReader(b))
+	require.NoError(t, err)
+	assert.Equal(t, qrCodeSize, img.Bounds().Dx())
+}
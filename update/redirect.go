@@ -0,0 +1,92 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// redirectKey returns the key a website redirect location points to in the
+// bucket, for a location like /darwin/Keybase-1.0.15.dmg or
+// https://s3.amazonaws.com/bucket/darwin/Keybase-1.0.15.dmg
+func redirectKey(bucketName string, location string) (string, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return "", err
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+	if u.Host == "s3.amazonaws.com" {
+		key = strings.TrimPrefix(key, bucketName+"/")
+	}
+	if key == "" {
+		return "", fmt.Errorf("No key in redirect location %q", location)
+	}
+	return key, nil
+}
+
+// MigrateLatestRedirects replaces any platform LatestName that is a website
+// redirect (from before we copied releases to it) with a copy of the release
+// it redirects to. It returns the LatestNames that were (or, for a dry run,
+// would be) migrated.
+func (c *Client) MigrateLatestRedirects(bucketName string, dryRun bool) ([]string, error) {
+	var migrated []string
+	for _, platform := range platformsAll {
+		head, err := c.svc.HeadObject(&s3.HeadObjectInput{
+			Bucket: aws.String(bucketName),
+			Key:    aws.String(platform.LatestName),
+		})
+		if isNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return migrated, err
+		}
+		location := aws.StringValue(head.WebsiteRedirectLocation)
+		if location == "" {
+			continue
+		}
+		key, err := redirectKey(bucketName, location)
+		if err != nil {
+			return migrated, err
+		}
+
+		url, name := urlStringForKey(key, bucketName, platform.Prefix)
+		if dryRun {
+			c.logf(VerbosityNormal, "DRYRUN: Would replace redirect %s -> %s with a copy", platform.LatestName, location)
+			migrated = append(migrated, platform.LatestName)
+			continue
+		}
+		source, err := c.svc.HeadObject(&s3.HeadObjectInput{
+			Bucket: aws.String(bucketName),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			return migrated, fmt.Errorf("Error reading redirect target %s for %s: %s", key, platform.LatestName, err)
+		}
+		c.logf(VerbosityNormal, "Replacing redirect %s -> %s with a copy", platform.LatestName, location)
+		// Replacing the metadata drops the redirect
+		input := &s3.CopyObjectInput{
+			Bucket:            aws.String(bucketName),
+			CopySource:        aws.String(url),
+			Key:               aws.String(platform.LatestName),
+			CacheControl:      aws.String(defaultCacheControl),
+			ACL:               aws.String("public-read"),
+			ContentType:       source.ContentType,
+			MetadataDirective: aws.String(s3.MetadataDirectiveReplace),
+		}
+		if platform.ContentDisposition != "" {
+			input.ContentDisposition = aws.String(fmt.Sprintf(platform.ContentDisposition, name))
+		}
+		if _, err := c.svc.CopyObject(input); err != nil {
+			return migrated, err
+		}
+		migrated = append(migrated, platform.LatestName)
+	}
+	return migrated, nil
+}
@@ -0,0 +1,53 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"testing"
+	"time"
+
+	"github.com/keybase/release/update/s3test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedirectKey(t *testing.T) {
+	key, err := redirectKey("bucket", "/darwin/Keybase-1.0.15-20160313013917%2Bab12cd3.dmg")
+	require.NoError(t, err)
+	assert.Equal(t, "darwin/Keybase-1.0.15-20160313013917+ab12cd3.dmg", key)
+	key, err = redirectKey("bucket", "https://s3.amazonaws.com/bucket/windows/Keybase_1.0.15.amd64.msi")
+	require.NoError(t, err)
+	assert.Equal(t, "windows/Keybase_1.0.15.amd64.msi", key)
+	_, err = redirectKey("bucket", "/")
+	require.Error(t, err)
+}
+
+func TestMigrateLatestRedirects(t *testing.T) {
+	f := newFakeS3()
+	release := "darwin/Keybase-1.0.15-20160313013917+ab12cd3.dmg"
+	f.SetObject(testBucket, release, &s3test.Object{Body: []byte("dmg"), ContentType: "application/x-apple-diskimage"})
+	f.SetObject(testBucket, "Keybase.dmg", &s3test.Object{WebsiteRedirect: "/darwin/Keybase-1.0.15-20160313013917%2Bab12cd3.dmg"})
+	f.Put(testBucket, "keybase_amd64.deb", "deb", time.Now())
+	c := newTestClient(f)
+
+	migrated, err := c.MigrateLatestRedirects(testBucket, true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Keybase.dmg"}, migrated)
+	assert.Equal(t, "", string(f.Get(testBucket, "Keybase.dmg").Body))
+
+	migrated, err = c.MigrateLatestRedirects(testBucket, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Keybase.dmg"}, migrated)
+	latest := f.Get(testBucket, "Keybase.dmg")
+	assert.Equal(t, "dmg", string(latest.Body))
+	assert.Equal(t, "", latest.WebsiteRedirect)
+	assert.Equal(t, "application/x-apple-diskimage", latest.ContentType)
+	assert.Equal(t, `attachment; filename="Keybase-1.0.15-20160313013917+ab12cd3.dmg"`, latest.ContentDisposition)
+	assert.Equal(t, "deb", string(f.Get(testBucket, "keybase_amd64.deb").Body))
+
+	// Nothing left to migrate
+	migrated, err = c.MigrateLatestRedirects(testBucket, false)
+	require.NoError(t, err)
+	assert.Empty(t, migrated)
+}
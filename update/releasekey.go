@@ -0,0 +1,52 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// ReleaseForKey returns the release for a single key, like ListReleases
+// would, but with a HEAD instead of listing the prefix (for reacting to S3
+// event notifications). It returns nil if the key isn't a release at prefix
+// with suffix. Since there's no listing, it has no previous release.
+func (c *Client) ReleaseForKey(bucketName string, prefix string, suffix string, key string) (*Release, error) {
+	prefix = normalizePrefix(prefix)
+	if !strings.HasPrefix(key, prefix) || !strings.HasSuffix(key, suffix) {
+		return nil, nil
+	}
+	head, err := c.svc.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	obj := &s3.Object{
+		Key:          aws.String(key),
+		LastModified: head.LastModified,
+		Size:         head.ContentLength,
+	}
+	releases := c.parseReleases([]*s3.Object{obj}, bucketName, prefix, suffix)
+	if len(releases) == 0 {
+		return nil, nil
+	}
+	release := releases[0]
+	if c.ObjectMetadata {
+		release.applyMeta(*c.objectMeta(key, head.Metadata))
+	}
+	if c.MetaSidecars {
+		sidecarKey := key + metaSidecarSuffix
+		meta, err := c.getReleaseMeta(bucketName, sidecarKey)
+		if err == nil {
+			release.applyMeta(*meta)
+		} else if !isNotFound(err) {
+			c.logf(VerbosityQuiet, "Couldn't read %s, using name for version: %s", sidecarKey, err)
+		}
+	}
+	return &release, nil
+}
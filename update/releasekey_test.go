@@ -0,0 +1,59 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"testing"
+	"time"
+
+	"github.com/keybase/release/update/s3test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReleaseForKey(t *testing.T) {
+	f := newFakeS3()
+	now := time.Now()
+	f.Put(testBucket, "darwin/Keybase-1.0.15-20160313013917+ab12cd3.dmg", "dmg", now)
+	f.Put(testBucket, "darwin/Keybase-1.0.14-20160312013917+ef56ab7.dmg", "dmg", now.Add(-time.Hour))
+	c := newTestClient(f)
+
+	release, err := c.ReleaseForKey(testBucket, "darwin/", ".dmg", "darwin/Keybase-1.0.15-20160313013917+ab12cd3.dmg")
+	require.NoError(t, err)
+	require.NotNil(t, release)
+	assert.Equal(t, 0, f.ListCalls)
+
+	releases, err := c.ListReleases(testBucket, "darwin/", ".dmg")
+	require.NoError(t, err)
+	expected := releases[0]
+	expected.PreviousVersion, expected.PreviousCommit = "", ""
+	assert.Equal(t, expected, *release)
+
+	// Not a release at the prefix with the suffix
+	release, err = c.ReleaseForKey(testBucket, "darwin/", ".dmg", "windows/Keybase_1.0.15-20160313013917+ab12cd3.amd64.msi")
+	require.NoError(t, err)
+	assert.Nil(t, release)
+	release, err = c.ReleaseForKey(testBucket, "darwin/", ".dmg", "darwin/Keybase-1.0.15-20160313013917+ab12cd3.dmg.meta.json")
+	require.NoError(t, err)
+	assert.Nil(t, release)
+
+	_, err = c.ReleaseForKey(testBucket, "darwin/", ".dmg", "darwin/Keybase-1.0.16-20160314013917+ab12cd3.dmg")
+	assert.True(t, isNotFound(err))
+}
+
+func TestReleaseForKeyMetadata(t *testing.T) {
+	f := newFakeS3()
+	now := time.Now()
+	f.SetObject(testBucket, "darwin/Keybase-renamed.dmg", &s3test.Object{LastModified: now, Metadata: map[string]string{"Version": "1.0.15-20160313000000+ab12cd3"}})
+	f.Put(testBucket, "darwin/Keybase-renamed.dmg.meta.json", `{"commit": "ef56ab7"}`, now)
+	c := newTestClient(f)
+	c.ObjectMetadata = true
+	c.MetaSidecars = true
+
+	release, err := c.ReleaseForKey(testBucket, "darwin/", "", "darwin/Keybase-renamed.dmg")
+	require.NoError(t, err)
+	require.NotNil(t, release)
+	assert.Equal(t, "1.0.15-20160313000000+ab12cd3", release.Version)
+	assert.Equal(t, "ef56ab7", release.Commit)
+}
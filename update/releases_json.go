@@ -0,0 +1,187 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// releasesSchemaVersion is the version of the releases JSON format, bumped
+// for changes consumers have to handle
+const releasesSchemaVersion = 1
+
+// ReleasesJSON is the releases for every platform, newest first
+type ReleasesJSON struct {
+	SchemaVersion int                  `json:"schemaVersion"`
+	GeneratedAt   time.Time            `json:"generatedAt"`
+	Platforms     map[string][]Release `json:"platforms"`
+}
+
+// PlatformReleasesJSON is the releases for one platform, newest first
+type PlatformReleasesJSON struct {
+	SchemaVersion int       `json:"schemaVersion"`
+	GeneratedAt   time.Time `json:"generatedAt"`
+	Platform      string    `json:"platform"`
+	Releases      []Release `json:"releases"`
+}
+
+func writeJSONFile(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := makeParentDirs(path); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0644)
+}
+
+// WriteReleasesJSON lists every platform's releases once and writes them all
+// to outPath and, if platformDir is set, each platform's to
+// <platformDir>/<platform>.json, for clients that only want one.
+func (c *Client) WriteReleasesJSON(bucketName string, outPath string, platformDir string) error {
+	generatedAt := timeNow()
+	combined := ReleasesJSON{
+		SchemaVersion: releasesSchemaVersion,
+		GeneratedAt:   generatedAt,
+		Platforms:     map[string][]Release{},
+	}
+	for _, platform := range platformsAll {
+		releases, err := c.ListReleases(bucketName, platform.Prefix, platform.Suffix)
+		if err != nil {
+			return err
+		}
+		if releases == nil {
+			releases = []Release{}
+		}
+		combined.Platforms[platform.Name] = releases
+	}
+
+	if outPath != "" {
+		if err := writeJSONFile(outPath, combined); err != nil {
+			return err
+		}
+		c.logf(VerbosityNormal, "Wrote %s", outPath)
+	}
+	if platformDir != "" {
+		for _, platform := range platformsAll {
+			path := filepath.Join(platformDir, platform.Name+".json")
+			err := writeJSONFile(path, PlatformReleasesJSON{
+				SchemaVersion: releasesSchemaVersion,
+				GeneratedAt:   generatedAt,
+				Platform:      platform.Name,
+				Releases:      combined.Platforms[platform.Name],
+			})
+			if err != nil {
+				return err
+			}
+			c.logf(VerbosityNormal, "Wrote %s", path)
+		}
+	}
+	return nil
+}
+
+// getReleasesJSON reads a releases JSON from the bucket, returning an empty
+// one if there isn't one
+func (c *Client) getReleasesJSON(bucketName string, key string) (*ReleasesJSON, error) {
+	index := ReleasesJSON{SchemaVersion: releasesSchemaVersion, Platforms: map[string][]Release{}}
+	resp, err := c.svc.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(key),
+	})
+	if isNotFound(err) {
+		return &index, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if err := json.NewDecoder(resp.Body).Decode(&index); err != nil {
+		return nil, fmt.Errorf("Invalid releases JSON at %s: %s", key, err)
+	}
+	if index.SchemaVersion != releasesSchemaVersion {
+		return nil, fmt.Errorf("Unsupported releases JSON schema version %d at %s", index.SchemaVersion, key)
+	}
+	if index.Platforms == nil {
+		index.Platforms = map[string][]Release{}
+	}
+	// The zone name isn't in the JSON
+	for _, releases := range index.Platforms {
+		for i := range releases {
+			releases[i].Date = convertEastern(releases[i].Date)
+		}
+	}
+	return &index, nil
+}
+
+// UpdateIndexForKey adds (or updates) the release for a newly uploaded key in
+// the releases JSON (see WriteReleasesJSON) at indexKey in the bucket,
+// without listing, for updating the index from S3 event notifications. Keys
+// that aren't a release for any platform are ignored.
+func (c *Client) UpdateIndexForKey(bucketName string, indexKey string, newKey string) error {
+	var platform Platform
+	var release *Release
+	for _, p := range platformsAll {
+		r, err := c.ReleaseForKey(bucketName, p.Prefix, p.Suffix, newKey)
+		if err != nil {
+			return err
+		}
+		if r != nil {
+			platform, release = p, r
+			break
+		}
+	}
+	if release == nil {
+		c.logf(VerbosityVerbose, "Ignoring %s, it's not a release", newKey)
+		return nil
+	}
+
+	index, err := c.getReleasesJSON(bucketName, indexKey)
+	if err != nil {
+		return err
+	}
+	releases := index.Platforms[platform.Name]
+	updated := false
+	for i := range releases {
+		if releases[i].Key == release.Key {
+			releases[i] = *release
+			updated = true
+		}
+	}
+	if !updated {
+		releases = append(releases, *release)
+	}
+	index.Platforms[platform.Name] = sortReleases(releases, 0)
+	index.GeneratedAt = timeNow()
+
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = c.svc.PutObject(&s3.PutObjectInput{
+		Bucket:        aws.String(bucketName),
+		Key:           aws.String(indexKey),
+		CacheControl:  aws.String(defaultCacheControl),
+		ACL:           aws.String("public-read"),
+		Body:          bytes.NewReader(data),
+		ContentLength: aws.Int64(int64(len(data))),
+		ContentType:   aws.String("application/json"),
+	})
+	if err != nil {
+		return err
+	}
+	if updated {
+		c.logf(VerbosityNormal, "Updated %s in %s", release.Key, indexKey)
+	} else {
+		c.logf(VerbosityNormal, "Added %s to %s", release.Key, indexKey)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/keybase/release/update/s3test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteReleasesJSON(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestWriteReleasesJSON")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	now := time.Date(2016, 3, 14, 0, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	f := newFakeS3()
+	f.Put(testBucket, "darwin/Keybase-1.0.15-20160313013917+ab12cd3.dmg", "dmg", time.Now())
+	f.Put(testBucket, "linux_binaries/deb/keybase_1.0.15-20160313013917.ab12cd3_amd64.deb", "deb", time.Now())
+	c := newTestClient(f)
+
+	combinedPath := filepath.Join(dir, "releases.json")
+	require.NoError(t, c.WriteReleasesJSON(testBucket, combinedPath, filepath.Join(dir, "platforms")))
+	assert.Equal(t, 4, f.ListCalls)
+
+	data, err := ioutil.ReadFile(combinedPath)
+	require.NoError(t, err)
+	var combined ReleasesJSON
+	require.NoError(t, json.Unmarshal(data, &combined))
+	assert.Equal(t, 1, combined.SchemaVersion)
+	assert.True(t, combined.GeneratedAt.Equal(now))
+	assert.Len(t, combined.Platforms, 4)
+	require.Len(t, combined.Platforms[PlatformTypeDarwin], 1)
+	assert.Empty(t, combined.Platforms["rpm"])
+
+	data, err = ioutil.ReadFile(filepath.Join(dir, "platforms", "deb.json"))
+	require.NoError(t, err)
+	var deb PlatformReleasesJSON
+	require.NoError(t, json.Unmarshal(data, &deb))
+	assert.Equal(t, 1, deb.SchemaVersion)
+	assert.True(t, deb.GeneratedAt.Equal(now))
+	assert.Equal(t, "deb", deb.Platform)
+	require.Len(t, deb.Releases, 1)
+	assert.Equal(t, "1.0.15-20160313013917+ab12cd3", deb.Releases[0].Version)
+	assert.Equal(t, combined.Platforms["deb"][0].Key, deb.Releases[0].Key)
+
+	for _, name := range []string{"darwin.json", "rpm.json", "windows.json"} {
+		_, err = os.Stat(filepath.Join(dir, "platforms", name))
+		assert.NoError(t, err, name)
+	}
+}
+
+func readIndex(t *testing.T, f *s3test.Bucket, key string) ReleasesJSON {
+	obj := f.Get(testBucket, key)
+	require.NotNil(t, obj)
+	var index ReleasesJSON
+	require.NoError(t, json.Unmarshal(obj.Body, &index))
+	return index
+}
+
+func TestUpdateIndexForKey(t *testing.T) {
+	f := newFakeS3()
+	now := time.Now()
+	f.Put(testBucket, "darwin/Keybase-1.0.14-20160312013917+ef56ab7.dmg", "dmg", now.Add(-time.Hour))
+	c := newTestClient(f)
+
+	// Insert, creating the index
+	require.NoError(t, c.UpdateIndexForKey(testBucket, "releases.json", "darwin/Keybase-1.0.14-20160312013917+ef56ab7.dmg"))
+	index := readIndex(t, f, "releases.json")
+	require.Len(t, index.Platforms["darwin"], 1)
+
+	f.Put(testBucket, "darwin/Keybase-1.0.15-20160313013917+ab12cd3.dmg", "dmg", now)
+	require.NoError(t, c.UpdateIndexForKey(testBucket, "releases.json", "darwin/Keybase-1.0.15-20160313013917+ab12cd3.dmg"))
+	assert.Equal(t, 0, f.ListCalls)
+	index = readIndex(t, f, "releases.json")
+	releases := index.Platforms["darwin"]
+	require.Len(t, releases, 2)
+	assert.Equal(t, "1.0.15-20160313013917+ab12cd3", releases[0].Version)
+	assert.Equal(t, "1.0.14-20160312013917+ef56ab7", releases[0].PreviousVersion)
+	assert.Equal(t, "1.0.14-20160312013917+ef56ab7", releases[1].Version)
+
+	// Update, for a re-upload of the same key
+	f.Put(testBucket, "darwin/Keybase-1.0.15-20160313013917+ab12cd3.dmg", "bigger dmg", now)
+	require.NoError(t, c.UpdateIndexForKey(testBucket, "releases.json", "darwin/Keybase-1.0.15-20160313013917+ab12cd3.dmg"))
+	index = readIndex(t, f, "releases.json")
+	releases = index.Platforms["darwin"]
+	require.Len(t, releases, 2)
+	assert.Equal(t, int64(len("bigger dmg")), releases[0].Size)
+
+	// Not a release
+	f.Put(testBucket, "other/notes.txt", "notes", now)
+	require.NoError(t, c.UpdateIndexForKey(testBucket, "releases.json", "other/notes.txt"))
+	assert.Len(t, readIndex(t, f, "releases.json").Platforms, 1)
+}
@@ -0,0 +1,91 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// allUsersGroup is the grantee for anonymous access
+const allUsersGroup = "http://acs.amazonaws.com/groups/global/AllUsers"
+
+// cannedACL returns the canned ACL matching an object's grants, public-read
+// if anyone can read it, private otherwise. Copies don't keep the source's
+// ACL, so this is what to copy with.
+func (c *Client) cannedACL(bucketName string, key string) (string, error) {
+	acl, err := c.svc.GetObjectAcl(&s3.GetObjectAclInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return "", err
+	}
+	for _, grant := range acl.Grants {
+		if grant.Grantee != nil && aws.StringValue(grant.Grantee.URI) == allUsersGroup && aws.StringValue(grant.Permission) == s3.PermissionRead {
+			return s3.ObjectCannedACLPublicRead, nil
+		}
+	}
+	return s3.ObjectCannedACLPrivate, nil
+}
+
+// RenameRelease moves an object to a new key, for an artifact uploaded with
+// the wrong name, without uploading it again. Content type, metadata and
+// (public or private) ACL are kept. The old key is only deleted once the copy
+// is verified (by size and ETag).
+func (c *Client) RenameRelease(bucketName string, oldKey string, newKey string) error {
+	if oldKey == newKey {
+		return fmt.Errorf("Can't rename %s to itself", oldKey)
+	}
+	source, err := c.svc.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(oldKey),
+	})
+	if err != nil {
+		return fmt.Errorf("Error reading %s: %s", oldKey, err)
+	}
+	acl, err := c.cannedACL(bucketName, oldKey)
+	if err != nil {
+		return fmt.Errorf("Error reading ACL for %s: %s", oldKey, err)
+	}
+
+	c.logf(VerbosityNormal, "Renaming %s to %s", oldKey, newKey)
+	_, err = c.svc.CopyObject(&s3.CopyObjectInput{
+		Bucket:     aws.String(bucketName),
+		CopySource: aws.String(urlString(bucketName, "", oldKey)),
+		Key:        aws.String(newKey),
+		ACL:        aws.String(acl),
+	})
+	if err != nil {
+		return err
+	}
+
+	copied, err := c.svc.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(newKey),
+	})
+	if err != nil {
+		return fmt.Errorf("Couldn't verify copy to %s, not deleting %s: %s", newKey, oldKey, err)
+	}
+	if aws.Int64Value(copied.ContentLength) != aws.Int64Value(source.ContentLength) {
+		return fmt.Errorf("Couldn't verify copy to %s, not deleting %s: expected %d bytes, got %d",
+			newKey, oldKey, aws.Int64Value(source.ContentLength), aws.Int64Value(copied.ContentLength))
+	}
+	// A multipart upload's ETag isn't its MD5, so a (single part) copy has a
+	// different one
+	sourceETag := aws.StringValue(source.ETag)
+	if !strings.Contains(sourceETag, "-") && aws.StringValue(copied.ETag) != sourceETag {
+		return fmt.Errorf("Couldn't verify copy to %s, not deleting %s: expected ETag %s, got %s",
+			newKey, oldKey, sourceETag, aws.StringValue(copied.ETag))
+	}
+
+	_, err = c.svc.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(oldKey),
+	})
+	return err
+}
@@ -0,0 +1,74 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"testing"
+	"time"
+
+	"github.com/keybase/release/update/s3test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenameRelease(t *testing.T) {
+	f := newFakeS3()
+	oldKey := "darwin/Keybase-1.0.15-2016031301391+ab12cd3.dmg"
+	newKey := "darwin/Keybase-1.0.15-20160313013917+ab12cd3.dmg"
+	f.SetObject(testBucket, oldKey, &s3test.Object{
+		Body:        []byte("dmg"),
+		ACL:         "public-read",
+		ContentType: "application/x-apple-diskimage",
+		Metadata:    map[string]string{"Commit": "ab12cd3"},
+	})
+	c := newTestClient(f)
+
+	require.NoError(t, c.RenameRelease(testBucket, oldKey, newKey))
+	assert.Nil(t, f.Get(testBucket, oldKey))
+	renamed := f.Get(testBucket, newKey)
+	require.NotNil(t, renamed)
+	assert.Equal(t, "dmg", string(renamed.Body))
+	assert.Equal(t, "public-read", renamed.ACL)
+	assert.Equal(t, "application/x-apple-diskimage", renamed.ContentType)
+	assert.Equal(t, map[string]string{"Commit": "ab12cd3"}, renamed.Metadata)
+
+	release, err := c.findRelease(testBucket, platformDarwin, func(r Release) bool { return true })
+	require.NoError(t, err)
+	require.NotNil(t, release)
+	assert.Equal(t, "1.0.15-20160313013917+ab12cd3", release.Version)
+}
+
+func TestRenameReleaseKeepsOldOnBadCopy(t *testing.T) {
+	f := newFakeS3()
+	oldKey := "darwin/Keybase-misnamed.dmg"
+	newKey := "darwin/Keybase-1.0.15-20160313013917+ab12cd3.dmg"
+	f.SetObject(testBucket, oldKey, &s3test.Object{Body: []byte("dmg"), ACL: "private"})
+	f.CorruptCopies = map[string]int{newKey: 1}
+	c := newTestClient(f)
+
+	require.Error(t, c.RenameRelease(testBucket, oldKey, newKey))
+	assert.NotNil(t, f.Get(testBucket, oldKey))
+
+	require.NoError(t, c.RenameRelease(testBucket, oldKey, newKey))
+	assert.Equal(t, "private", f.Get(testBucket, newKey).ACL)
+	require.Error(t, c.RenameRelease(testBucket, "darwin/missing.dmg", newKey))
+
+	// A bad copy of the same size is caught by its ETag
+	f.Put(testBucket, oldKey, "dmgdmgd", time.Now())
+	f.CorruptCopies[newKey] = 1
+	err := c.RenameRelease(testBucket, oldKey, newKey)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "ETag")
+	assert.NotNil(t, f.Get(testBucket, oldKey))
+}
+
+func TestRenameReleaseTopLevel(t *testing.T) {
+	f := newFakeS3()
+	f.Put(testBucket, "Keybase misnamed.dmg", "dmg", time.Now())
+	c := newTestClient(f)
+
+	require.NoError(t, c.RenameRelease(testBucket, "Keybase misnamed.dmg", "darwin/Keybase-1.0.15-20160313013917+ab12cd3.dmg"))
+	assert.Nil(t, f.Get(testBucket, "Keybase misnamed.dmg"))
+	assert.Equal(t, "dmg", string(f.Get(testBucket, "darwin/Keybase-1.0.15-20160313013917+ab12cd3.dmg").Body))
+}
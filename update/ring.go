@@ -0,0 +1,94 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"fmt"
+)
+
+// Ring is a named step of a staged rollout, promoted to a channel for a
+// percentage of its clients
+type Ring struct {
+	Name string
+	// Channel is the channel the ring is promoted to. If it's empty, it's
+	// the ring's name.
+	Channel string
+	// Percent is the RolloutPercent of the ring's update, from 1 to 100
+	Percent int
+}
+
+// DefaultRings are the rings used if Client.Rings isn't set, promoted over
+// days from 1% to everyone
+var DefaultRings = []Ring{
+	{Name: "ring0", Percent: 1},
+	{Name: "ring1", Percent: 10},
+	{Name: "ring2", Percent: 50},
+	{Name: "ring3", Percent: 100},
+}
+
+// channel is the channel the ring is promoted to
+func (r Ring) channel() string {
+	if r.Channel == "" {
+		return r.Name
+	}
+	return r.Channel
+}
+
+// rings are the client's Rings, or DefaultRings
+func (c *Client) rings() []Ring {
+	if c.Rings == nil {
+		return DefaultRings
+	}
+	return c.Rings
+}
+
+// ring returns the client's ring (from Rings, or DefaultRings) with a name
+func (c *Client) ring(name string) (Ring, error) {
+	for _, ring := range c.rings() {
+		if ring.Name != name {
+			continue
+		}
+		if ring.Percent < 1 || ring.Percent > 100 {
+			return Ring{}, fmt.Errorf("Ring %s has invalid percent %d", ring.Name, ring.Percent)
+		}
+		return ring, nil
+	}
+	return Ring{}, fmt.Errorf("Unknown ring %s", name)
+}
+
+// PromoteRing promotes a version to a ring's channel, with the ring's rollout
+// percentage in the update JSON. The release and its update JSON must exist.
+// An empty env is the bucket config's.
+func (c *Client) PromoteRing(bucketName string, ring string, version string, platform string, env string) error {
+	r, err := c.ring(ring)
+	if err != nil {
+		return err
+	}
+	p, err := platformForName(platform)
+	if err != nil {
+		return err
+	}
+	env, err = c.envDefault(bucketName, env)
+	if err != nil {
+		return err
+	}
+	lockReason, locked, err := c.promotionLock(bucketName)
+	if err != nil {
+		return err
+	}
+	if locked {
+		return fmt.Errorf("Promotions are locked: %s", lockReason)
+	}
+	jsonSource, err := c.checkVersionUploaded(bucketName, p, env, version)
+	if err != nil {
+		return err
+	}
+	upd, err := c.getUpdate(bucketName, jsonSource)
+	if err != nil {
+		return err
+	}
+	upd.RolloutPercent = r.Percent
+	c.logf(VerbosityNormal, "Promoting %s to %s (%d%%)", version, r.Name, r.Percent)
+	return c.putUpdateJSONVerified(bucketName, UpdateJSONName(r.channel(), p.Name, env), *upd, promotionMetadata(c.PromotedBy, version))
+}
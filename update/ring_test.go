@@ -0,0 +1,52 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPromoteRing(t *testing.T) {
+	f := newFakeS3()
+	version := "1.0.15-20160313013917+ab12cd3"
+	seedDarwinRelease(f, version)
+	c := newTestClient(f)
+
+	for _, ring := range DefaultRings {
+		require.NoError(t, c.PromoteRing(testBucket, ring.Name, version, PlatformTypeDarwin, "prod"))
+		upd := currentTestUpdate(t, c, ring.Name)
+		assert.Equal(t, version, upd.Version)
+		assert.Equal(t, ring.Percent, upd.RolloutPercent)
+	}
+
+	require.EqualError(t, c.PromoteRing(testBucket, "ring9", version, PlatformTypeDarwin, "prod"), "Unknown ring ring9")
+	err := c.PromoteRing(testBucket, "ring0", "1.0.16-20160314013917+ef01234", PlatformTypeDarwin, "prod")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "No release found")
+
+	require.NoError(t, c.AcquirePromotionLock(testBucket, "incident"))
+	require.EqualError(t, c.PromoteRing(testBucket, "ring0", version, PlatformTypeDarwin, "prod"), "Promotions are locked: incident")
+}
+
+func TestPromoteRingSameChannel(t *testing.T) {
+	f := newFakeS3()
+	version := "1.0.15-20160313013917+ab12cd3"
+	seedDarwinRelease(f, version)
+	c := newTestClient(f)
+	c.Rings = []Ring{
+		{Name: "canary", Channel: "v2", Percent: 5},
+		{Name: "all", Channel: "v2", Percent: 100},
+		{Name: "broken", Channel: "v2", Percent: 0},
+	}
+
+	require.NoError(t, c.PromoteRing(testBucket, "canary", version, PlatformTypeDarwin, "prod"))
+	assert.Equal(t, 5, currentTestUpdate(t, c, "v2").RolloutPercent)
+	require.NoError(t, c.PromoteRing(testBucket, "all", version, PlatformTypeDarwin, "prod"))
+	assert.Equal(t, 100, currentTestUpdate(t, c, "v2").RolloutPercent)
+	require.EqualError(t, c.PromoteRing(testBucket, "broken", version, PlatformTypeDarwin, "prod"), "Ring broken has invalid percent 0")
+	require.EqualError(t, c.PromoteRing(testBucket, "ring0", version, PlatformTypeDarwin, "prod"), "Unknown ring ring0")
+}
@@ -5,12 +5,16 @@ package update
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
 	"text/tabwriter"
@@ -18,9 +22,10 @@ import (
 
 	"github.com/alecthomas/template"
 	"github.com/blang/semver"
-	"github.com/keybase/release/version"
+	releaseVersion "github.com/keybase/release/version"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 )
@@ -29,6 +34,8 @@ const defaultCacheControl = "max-age=60"
 
 const defaultChannel = "v2"
 
+const defaultListPageSize = 1000
+
 // Section defines a set of releases
 type Section struct {
 	Header   string
@@ -44,6 +51,30 @@ type Release struct {
 	DateString string
 	Date       time.Time
 	Commit     string
+	Size       int64
+	// Arch is the architecture of the build (amd64, arm64), from the name,
+	// or the platform of the prefix it was listed at
+	Arch string
+	// PreviousVersion and PreviousCommit are those of the next older release
+	// in the listing, empty for the oldest
+	PreviousVersion string
+	PreviousCommit  string
+}
+
+// IsPrerelease returns true if the version has a non-numeric pre-release
+// identifier (1.2.3-beta.1, 1.2.3-rc1). The numeric build date in our
+// versions (1.2.3-20160312013917+cd6f696) isn't a pre-release.
+func (r Release) IsPrerelease() bool {
+	ver, err := semver.Make(r.Version)
+	if err != nil {
+		return false
+	}
+	for _, pre := range ver.Pre {
+		if !pre.IsNum {
+			return true
+		}
+	}
+	return false
 }
 
 // ByRelease defines how to sort releases
@@ -62,19 +93,168 @@ func (s ByRelease) Less(i, j int) bool {
 	return s[j].Date.Before(s[i].Date)
 }
 
+// S3API is the part of the S3 service used by Client, so NewClientWithS3 can
+// be given a fake bucket
+type S3API interface {
+	ListObjects(*s3.ListObjectsInput) (*s3.ListObjectsOutput, error)
+	GetObject(*s3.GetObjectInput) (*s3.GetObjectOutput, error)
+	PutObject(*s3.PutObjectInput) (*s3.PutObjectOutput, error)
+	PutObjectWithContext(aws.Context, *s3.PutObjectInput, ...request.Option) (*s3.PutObjectOutput, error)
+	CopyObject(*s3.CopyObjectInput) (*s3.CopyObjectOutput, error)
+	DeleteObject(*s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error)
+	HeadObject(*s3.HeadObjectInput) (*s3.HeadObjectOutput, error)
+	GetObjectAcl(*s3.GetObjectAclInput) (*s3.GetObjectAclOutput, error)
+	PutObjectAcl(*s3.PutObjectAclInput) (*s3.PutObjectAclOutput, error)
+	ListObjectVersions(*s3.ListObjectVersionsInput) (*s3.ListObjectVersionsOutput, error)
+}
+
 // Client is an S3 client
 type Client struct {
-	svc *s3.S3
+	svc S3API
+
+	// Region is the region of the buckets, for release URLs. If it's empty
+	// or us-east-1, URLs are https://s3.amazonaws.com/<bucket>/<key>.
+	Region string
+
+	// NameDateLocation is the time zone of the timestamps embedded in release
+	// names. If nil, they are UTC. Dates are converted to Eastern once, after
+	// parsing in this location.
+	NameDateLocation *time.Location
+
+	// NameDateLayout is the time layout of the timestamps embedded in release
+	// names, if they aren't like 20160312013917 (see version.Parser)
+	NameDateLayout string
+
+	// ListPageSize is the number of keys to request per list call. If 0, it's
+	// defaultListPageSize, the most S3 returns.
+	ListPageSize int
+
+	// MetaSidecars prefers the <name>.meta.json sidecar, if one was uploaded
+	// next to an artifact, over parsing the version from its name.
+	MetaSidecars bool
+
+	// ObjectMetadata prefers the version, commit and date in an artifact's
+	// user metadata (x-amz-meta-version, -commit, -date) over parsing its
+	// name. This is a HEAD per release.
+	ObjectMetadata bool
+
+	// KeyVersionPattern, if set, is matched against the full key to get the
+	// version, instead of parsing the name, for mirrors with the version in
+	// the path (1.2.3/Keybase.dmg). The version is the first group (or the
+	// whole match), and the object's LastModified is the date if the version
+	// doesn't have one. Listings include subdirectories.
+	KeyVersionPattern *regexp.Regexp
+
+	// PublicBaseURL, if set, is the host releases are downloaded from (for
+	// example a CDN, https://downloads.example.com), used for release URLs
+	// instead of https://s3.amazonaws.com/<bucket>. Copies still use S3.
+	PublicBaseURL string
+
+	// TagVersions maps git tags to the versions built from them, for
+	// PromoteByTag
+	TagVersions map[string]string
+
+	// StrictCopyLatest makes CopyLatest fail if any platform has no release,
+	// after copying the ones that do, instead of skipping it
+	StrictCopyLatest bool
+
+	// CopyLatestPrereleases lets CopyLatest copy a pre-release (see
+	// Release.IsPrerelease) from a listing. By default they're skipped, so a
+	// beta isn't published as the latest.
+	CopyLatestPrereleases bool
+
+	// LatestStrategy is how CopyLatest picks the newest release from a
+	// listing (linux), ByDate by default
+	LatestStrategy LatestStrategy
+
+	// FetchConcurrency is how many per-object auxiliary fetches (sidecars,
+	// object metadata) can be in flight at once, across all of them. If 0,
+	// it's defaultFetchConcurrency. It's read on the first fetch.
+	FetchConcurrency int
+
+	// FetchRPS caps the rate (requests per second) of the fetches and bulk
+	// HEADs (CheckLatestAges) in FetchConcurrency, so audits don't get the
+	// bucket throttled for promotions. If 0, there's no cap. It's read on
+	// the first fetch.
+	FetchRPS float64
+
+	// PlatformVariants are, by platform name, the builds uploaded alongside
+	// a platform's (for example darwin-arm64 for darwin), each at its own
+	// prefix, that must all have the release for RequireVariants
+	PlatformVariants map[string][]Platform
+
+	// SafeOverwrite only lets WriteHTML replace a file that it generated (with
+	// htmlMarker), in case the output path is pointed at something else
+	SafeOverwrite bool
+
+	// CommitLength is how many characters of a commit to show in the index
+	// (links still use the full commit). If 0, it's defaultCommitLength.
+	CommitLength int
+
+	// Context, if set, is the parent of every S3 request's context, so the
+	// caller can cancel them
+	Context context.Context
+
+	// Timeouts are how long each type of S3 request can take, under Context.
+	// Unset timeouts use the defaults (30s for lists and gets, 10s for
+	// HEADs, 5m for copies and other writes).
+	Timeouts OperationTimeouts
+
+	// HTMLGrouping, if set, groups the releases in the index into sections by
+	// what it returns (GroupByMajorVersion, GroupByMonth), instead of a section
+	// per prefix
+	HTMLGrouping GroupFunc
+
+	// Verbosity is how much is logged, VerbosityNormal by default
+	Verbosity Verbosity
+
+	// TemplateData are extra fields for index templates (a logo URL, support
+	// links), alongside Title and Sections
+	TemplateData map[string]interface{}
+
+	// Rings are the named steps of staged rollouts for PromoteRing. If nil,
+	// they're DefaultRings.
+	Rings []Ring
+
+	// HTMLQRCodes adds a summary of each platform's latest download URL, with
+	// a QR code (an inline PNG) for phones, to the top of the index
+	HTMLQRCodes bool
+
+	// PromotedBy identifies who (or what) promotes with this client, for the
+	// provenance stamped into promoted update JSONs, if PromoteOptions doesn't
+	// have PromotedBy
+	PromotedBy string
+
+	// sess is the session svc was made from, if it's for S3 (not a fake)
+	sess *session.Session
+
+	// fetch is the limiter for auxiliary fetches, set up on first use
+	fetch *fetchLimits
 }
 
+// defaultRegion is the region of our buckets
+const defaultRegion = "us-east-1"
+
 // NewClient constructs a Client
 func NewClient() (*Client, error) {
-	sess, err := session.NewSession(&aws.Config{Region: aws.String("us-east-1")})
+	return NewClientInRegion(defaultRegion)
+}
+
+// NewClientInRegion constructs a Client for buckets in region
+func NewClientInRegion(region string) (*Client, error) {
+	sess, err := session.NewSession(&aws.Config{Region: aws.String(region)})
 	if err != nil {
 		return nil, err
 	}
-	svc := s3.New(sess)
-	return &Client{svc: svc}, nil
+	c := &Client{Region: region, sess: sess, fetch: &fetchLimits{}}
+	c.svc = timeoutS3{svc: s3.New(sess), client: c}
+	return c, nil
+}
+
+// NewClientWithS3 constructs a Client that makes its S3 calls with svc, for
+// example the in-memory bucket in updatetest
+func NewClientWithS3(svc S3API) *Client {
+	return &Client{svc: svc, fetch: &fetchLimits{}}
 }
 
 func convertEastern(t time.Time) time.Time {
@@ -85,19 +265,59 @@ func convertEastern(t time.Time) time.Time {
 	return t.In(locationNewYork)
 }
 
+const releaseDateFormat = "Mon Jan _2 15:04:05 MST 2006"
+
+// loadReleases parses and sorts releases using the default Client settings
 func loadReleases(objects []*s3.Object, bucketName string, prefix string, suffix string, truncate int) []Release {
+	var c Client
+	return sortReleases(c.parseReleases(objects, bucketName, prefix, suffix), truncate)
+}
+
+func (c *Client) nameDateLocation() *time.Location {
+	if c.NameDateLocation == nil {
+		return time.UTC
+	}
+	return c.NameDateLocation
+}
+
+// isNonReleaseName is whether a name in a release prefix is one of the files
+// written next to the releases: an index, a sidecar or an electron-updater
+// feed. A platform without a Suffix (windows) would otherwise list them.
+func isNonReleaseName(name string) bool {
+	return path.Base(name) == "index.html" || strings.HasSuffix(name, metaSidecarSuffix) || isElectronFeedName(path.Base(name))
+}
+
+func (c *Client) parseReleases(objects []*s3.Object, bucketName string, prefix string, suffix string) []Release {
+	prefix = normalizePrefix(prefix)
+	prefixArch := archForPrefix(prefix)
 	var releases []Release
-	for _, obj := range objects {
+	for _, obj := range c.dedupObjects(objects) {
 		if strings.HasSuffix(*obj.Key, suffix) {
-			urlString, name := urlStringForKey(*obj.Key, bucketName, prefix)
-			if name == "index.html" {
+			_, name := urlStringForKey(*obj.Key, bucketName, prefix)
+			urlString := c.publicURLForKey(bucketName, *obj.Key)
+			name = canonicalKey(name)
+			if isNonReleaseName(name) {
 				continue
 			}
-			version, _, date, commit, err := version.Parse(name)
+			var version, commit string
+			var date time.Time
+			var err error
+			if c.KeyVersionPattern != nil {
+				version, date, commit, err = c.parseKeyVersion(*obj.Key, aws.TimeValue(obj.LastModified))
+			} else {
+				version, _, date, commit, err = releaseVersion.Parser{DateLayout: c.NameDateLayout}.ParseInLocation(name, c.nameDateLocation())
+				if err == nil && commit == "" {
+					c.logf(VerbosityQuiet, "Invalid commit in %s, ignoring it\n", name)
+				}
+			}
 			if err != nil {
-				log.Printf("Couldn't get version from name: %s\n", name)
+				c.logf(VerbosityQuiet, "Couldn't get version from name: %s\n", name)
 			}
 			date = convertEastern(date)
+			arch := archForName(name)
+			if arch == "" {
+				arch = prefixArch
+			}
 			releases = append(releases,
 				Release{
 					Name:       name,
@@ -105,67 +325,265 @@ func loadReleases(objects []*s3.Object, bucketName string, prefix string, suffix
 					URL:        urlString,
 					Version:    version,
 					Date:       date,
-					DateString: date.Format("Mon Jan _2 15:04:05 MST 2006"),
+					DateString: date.Format(releaseDateFormat),
 					Commit:     commit,
+					Size:       aws.Int64Value(obj.Size),
+					Arch:       arch,
 				})
 		}
 	}
+	return releases
+}
+
+// parseKeyVersion gets the version from a key with KeyVersionPattern
+func (c *Client) parseKeyVersion(key string, lastModified time.Time) (version string, date time.Time, commit string, err error) {
+	match := c.KeyVersionPattern.FindStringSubmatch(key)
+	if match == nil {
+		return "", lastModified, "", fmt.Errorf("No version in key: %s", key)
+	}
+	segment := match[0]
+	if len(match) > 1 {
+		segment = match[1]
+	}
+	version, _, date, commit, err = releaseVersion.Parser{DateLayout: c.NameDateLayout}.ParseInLocation(segment, c.nameDateLocation())
+	if err != nil {
+		// Just a version, like 1.2.3
+		return segment, lastModified, "", nil
+	}
+	return version, date, commit, nil
+}
+
+// canonicalKey is a key with any URL escaping decoded, so keys for the same
+// artifact with different encodings (after a bucket migration) compare equal
+func canonicalKey(key string) string {
+	unescaped, err := url.PathUnescape(key)
+	if err != nil {
+		return key
+	}
+	return unescaped
+}
+
+// dedupObjects collapses objects whose keys only differ by URL escaping,
+// keeping the most recently modified one
+func (c *Client) dedupObjects(objects []*s3.Object) []*s3.Object {
+	index := map[string]int{}
+	deduped := make([]*s3.Object, 0, len(objects))
+	for _, obj := range objects {
+		key := canonicalKey(aws.StringValue(obj.Key))
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(deduped)
+			deduped = append(deduped, obj)
+			continue
+		}
+		kept := deduped[i]
+		if aws.TimeValue(obj.LastModified).After(aws.TimeValue(kept.LastModified)) {
+			deduped[i] = obj
+			kept, obj = obj, kept
+		}
+		c.logf(VerbosityVerbose, "Collapsed duplicate %s into %s", aws.StringValue(obj.Key), aws.StringValue(kept.Key))
+	}
+	return deduped
+}
+
+func sortReleases(releases []Release, truncate int) []Release {
 	// TODO: Should also sanity check that version sort is same as time sort
 	// otherwise something got messed up
 	sort.Sort(ByRelease(releases))
+	linkPreviousReleases(releases)
 	if truncate > 0 && len(releases) > truncate {
 		releases = releases[0:truncate]
 	}
 	return releases
 }
 
+// linkPreviousReleases sets each release's previous version and commit to
+// those of the next one, in sorted (newest first) releases
+func linkPreviousReleases(releases []Release) {
+	for i := range releases {
+		if i+1 < len(releases) {
+			releases[i].PreviousVersion = releases[i+1].Version
+			releases[i].PreviousCommit = releases[i+1].Commit
+		} else {
+			releases[i].PreviousVersion = ""
+			releases[i].PreviousCommit = ""
+		}
+	}
+}
+
+// listReleases lists and loads the releases at prefix, newest first
+func (c *Client) listReleases(bucketName string, prefix string, suffix string, truncate int) ([]Release, error) {
+	releases, _, err := c.listReleasesThrough(bucketName, prefix, suffix, truncate)
+	return releases, err
+}
+
+// listReleasesThrough is listReleases, also returning the newest LastModified
+// in the listing
+func (c *Client) listReleasesThrough(bucketName string, prefix string, suffix string, truncate int) ([]Release, time.Time, error) {
+	prefix = normalizePrefix(prefix)
+	objs, err := c.listAllObjects(bucketName, prefix)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	releases := c.parseReleases(objs, bucketName, prefix, suffix)
+	c.applyReleaseMetadata(bucketName, objs, releases)
+	return sortReleases(releases, truncate), newestModified(objs), nil
+}
+
+// newestModified is the latest LastModified of objects, or zero if there are
+// none
+func newestModified(objs []*s3.Object) time.Time {
+	var newest time.Time
+	for _, obj := range objs {
+		if modified := aws.TimeValue(obj.LastModified); modified.After(newest) {
+			newest = modified
+		}
+	}
+	return newest
+}
+
+// ListReleases returns the releases at prefix, newest first
+func (c *Client) ListReleases(bucketName string, prefix string, suffix string) ([]Release, error) {
+	return c.listReleases(bucketName, prefix, suffix, 0)
+}
+
 // WriteHTML creates an html file for releases
 func WriteHTML(bucketName string, prefixes string, suffix string, outPath string, uploadDest string) error {
-	var sections []Section
-	for _, prefix := range strings.Split(prefixes, ",") {
+	client, err := NewClient()
+	if err != nil {
+		return err
+	}
+	return client.WriteHTML(bucketName, prefixes, suffix, outPath, uploadDest)
+}
 
-		objs, listErr := listAllObjects(bucketName, prefix)
+// WriteHTML creates an html file for releases for the Client. If listing
+// some prefixes fails, the index is still written with the others, and the
+// errors are returned.
+func (c *Client) WriteHTML(bucketName string, prefixes string, suffix string, outPath string, uploadDest string) error {
+	sections, listErr := c.htmlSections(bucketName, prefixes, suffix)
+	if len(sections) == 0 && listErr != nil {
+		return listErr
+	}
+	return CombineErrors(listErr, c.writeHTMLForSections(bucketName, sections, outPath, uploadDest))
+}
+
+// htmlSections lists the releases for the index, a section per prefix.
+// Prefixes that fail to list are left out, and their errors combined.
+func (c *Client) htmlSections(bucketName string, prefixes string, suffix string) ([]Section, error) {
+	var sections []Section
+	var errs []error
+	for _, prefix := range splitPrefixes(prefixes) {
+		releases, listErr := c.listReleases(bucketName, prefix, suffix, 50)
 		if listErr != nil {
-			return listErr
+			c.logf(VerbosityQuiet, "Error listing %s: %s", prefix, listErr)
+			errs = append(errs, fmt.Errorf("Error listing %s: %s", prefix, listErr))
+			continue
 		}
 
-		releases := loadReleases(objs, bucketName, prefix, suffix, 50)
 		if len(releases) > 0 {
-			log.Printf("Found %d release(s) at %s\n", len(releases), prefix)
-			// for _, release := range releases {
-			// 	log.Printf(" %s %s %s\n", release.Name, release.Version, release.DateString)
-			// }
+			c.logf(VerbosityNormal, "Found %d release(s) at %s\n", len(releases), prefix)
+			for _, release := range releases {
+				c.logf(VerbosityVerbose, " %s %s %s\n", release.Name, release.Version, release.DateString)
+			}
 		}
 		sections = append(sections, Section{
 			Header:   prefix,
 			Releases: releases,
 		})
 	}
+	return sections, CombineErrors(errs...)
+}
+
+// HTMLOutput is a file to render the index to, with its own template, for
+// example for a locale
+type HTMLOutput struct {
+	Path         string
+	TemplatePath string
+}
+
+// WriteHTMLOutputs lists the releases once and renders them to each output,
+// with the output's template. Every template gets the same PageData. Like
+// WriteHTML, prefixes that fail to list are left out and their errors
+// returned. With SafeOverwrite, an existing output is only replaced if it has
+// htmlMarker, so its template should include it.
+func (c *Client) WriteHTMLOutputs(bucketName string, prefixes string, suffix string, outputs []HTMLOutput) error {
+	sections, listErr := c.htmlSections(bucketName, prefixes, suffix)
+	if len(sections) == 0 && listErr != nil {
+		return listErr
+	}
+	return CombineErrors(listErr, c.writeHTMLOutputs(bucketName, sections, outputs))
+}
+
+func (c *Client) writeHTMLOutputs(bucketName string, sections []Section, outputs []HTMLOutput) error {
+	latest, err := c.latestDownloads(bucketName, sections)
+	if err != nil {
+		return err
+	}
+	sections = groupSections(sections, c.HTMLGrouping)
+	data, err := PageData{Title: bucketName, Sections: sections, Latest: latest}.withData(c.TemplateData)
+	if err != nil {
+		return err
+	}
+	if c.SafeOverwrite {
+		// Check them all first so a bad path doesn't leave outputs half written
+		for _, output := range outputs {
+			if err := checkGeneratedHTML(output.Path); err != nil {
+				return err
+			}
+		}
+	}
+	for _, output := range outputs {
+		t, err := template.New(filepath.Base(output.TemplatePath)).Funcs(htmlFuncs(c.CommitLength)).ParseFiles(output.TemplatePath)
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, data); err != nil {
+			return fmt.Errorf("Error rendering %s: %s", output.TemplatePath, err)
+		}
+		if err := makeParentDirs(output.Path); err != nil {
+			return err
+		}
+		if err := writeFileAtomic(output.Path, buf.Bytes(), 0644); err != nil {
+			return err
+		}
+		c.logf(VerbosityNormal, "Wrote %s (%s)", output.Path, output.TemplatePath)
+	}
+	return nil
+}
 
+// writeHTMLForSections renders sections to outPath and/or uploads them to
+// uploadDest
+func (c *Client) writeHTMLForSections(bucketName string, sections []Section, outPath string, uploadDest string) error {
 	var buf bytes.Buffer
-	err := WriteHTMLForLinks(bucketName, sections, &buf)
+	latest, err := c.latestDownloads(bucketName, sections)
+	if err != nil {
+		return err
+	}
+	sections = groupSections(sections, c.HTMLGrouping)
+	err = writeHTMLForLinks(PageData{Title: bucketName, Sections: sections, Latest: latest}, c.TemplateData, c.CommitLength, &buf)
 	if err != nil {
 		return err
 	}
 	if outPath != "" {
+		if c.SafeOverwrite {
+			if err = checkGeneratedHTML(outPath); err != nil {
+				return err
+			}
+		}
 		err = makeParentDirs(outPath)
 		if err != nil {
 			return err
 		}
-		err = ioutil.WriteFile(outPath, buf.Bytes(), 0644)
+		err = writeFileAtomic(outPath, buf.Bytes(), 0644)
 		if err != nil {
 			return err
 		}
 	}
 
 	if uploadDest != "" {
-		client, err := NewClient()
-		if err != nil {
-			return err
-		}
-
-		log.Printf("Uploading to %s", uploadDest)
-		_, err = client.svc.PutObject(&s3.PutObjectInput{
+		c.logf(VerbosityNormal, "Uploading to %s", uploadDest)
+		_, err = c.svc.PutObject(&s3.PutObjectInput{
 			Bucket:        aws.String(bucketName),
 			Key:           aws.String(uploadDest),
 			CacheControl:  aws.String(defaultCacheControl),
@@ -182,8 +600,29 @@ func WriteHTML(bucketName string, prefixes string, suffix string, outPath string
 	return nil
 }
 
+// htmlMarker is in every index WriteHTML generates, so SafeOverwrite can tell
+// it's replacing one
+const htmlMarker = "<!-- Generated by keybase/release index-html -->"
+
+// checkGeneratedHTML returns an error if there is a file at path that isn't
+// an index we generated
+func checkGeneratedHTML(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !bytes.Contains(data, []byte(htmlMarker)) {
+		return fmt.Errorf("Not overwriting %s, it isn't a generated index", path)
+	}
+	return nil
+}
+
 var htmlTemplate = `
 <!doctype html>
+` + htmlMarker + `
 <html lang="en">
 <head>
   <title>{{ .Title }}</title>
@@ -191,12 +630,17 @@ var htmlTemplate = `
   body { font-family: monospace; }
   </style>
 </head>
-<body>
+<body>{{ if .Latest }}
+	<table>
+	{{ range $index, $dl := .Latest }}
+		<tr><td><a href="{{ $dl.URL }}">{{ $dl.Platform }}</a></td><td><img src="{{ $dl.QRCode }}" alt="{{ $dl.URL }}"></td></tr>
+	{{ end }}
+	</table>{{ end }}
 	{{ range $index, $sec := .Sections }}
 		<h3>{{ $sec.Header }}</h3>
 		<ul>
 		{{ range $index2, $rel := $sec.Releases }}
-		<li><a href="{{ $rel.URL }}">{{ $rel.Name }}</a> <strong>{{ $rel.Version }}</strong> <em>{{ $rel.Date }}</em> <a href="https://github.com/keybase/client/commit/{{ $rel.Commit }}"">{{ $rel.Commit }}</a></li>
+		<li><a href="{{ $rel.URL }}">{{ $rel.Name }}</a> <strong>{{ $rel.Version }}</strong> {{ $rel.Arch }} <em>{{ $rel.Date }}</em>{{ if $rel.Commit }} <a href="{{ commitURL $rel.Commit }}">{{ shortCommit $rel.Commit }}</a>{{ if $rel.PreviousCommit }} <a href="{{ compareURL $rel.PreviousCommit $rel.Commit }}">diff</a>{{ end }}{{ end }}</li>
 		{{ end }}
 		</ul>
 	{{ end }}
@@ -204,14 +648,86 @@ var htmlTemplate = `
 </html>
 `
 
+// PageData is what index templates are rendered with
+type PageData struct {
+	Title    string
+	Sections []Section
+	// Latest are the platforms' latest downloads, if HTMLQRCodes is set
+	Latest []LatestDownload
+}
+
+// withData merges extra fields into the page data, for custom templates to
+// reference (as {{ .Logo }}, say). Title, Sections and Latest are reserved.
+func (d PageData) withData(extra map[string]interface{}) (interface{}, error) {
+	if len(extra) == 0 {
+		return d, nil
+	}
+	vars := map[string]interface{}{
+		"Title":    d.Title,
+		"Sections": d.Sections,
+		"Latest":   d.Latest,
+	}
+	for k, v := range extra {
+		if _, ok := vars[k]; ok {
+			return nil, fmt.Errorf("Template data %q is reserved", k)
+		}
+		vars[k] = v
+	}
+	return vars, nil
+}
+
+// defaultCommitLength is how much of a commit is shown, like git's short hash
+const defaultCommitLength = 7
+
+// shortCommit truncates a commit for display to length characters, or
+// defaultCommitLength if length is 0
+func shortCommit(commit string, length int) string {
+	if length <= 0 {
+		length = defaultCommitLength
+	}
+	if len(commit) <= length {
+		return commit
+	}
+	return commit[:length]
+}
+
+// commitURL is the GitHub page for a (full) commit
+func commitURL(commit string) string {
+	return "https://github.com/keybase/client/commit/" + commit
+}
+
+// compareURL is the GitHub diff between two commits
+func compareURL(from string, to string) string {
+	return fmt.Sprintf("https://github.com/keybase/client/compare/%s...%s", from, to)
+}
+
+// htmlFuncs are the functions available to index templates
+func htmlFuncs(commitLength int) template.FuncMap {
+	return template.FuncMap{
+		"shortCommit": func(commit string) string { return shortCommit(commit, commitLength) },
+		"commitURL":   commitURL,
+		"compareURL":  compareURL,
+	}
+}
+
 // WriteHTMLForLinks writes a summary document for a set of releases
 func WriteHTMLForLinks(title string, sections []Section, writer io.Writer) error {
-	vars := map[string]interface{}{
-		"Title":    title,
-		"Sections": sections,
+	return writeHTMLForLinks(PageData{Title: title, Sections: sections}, nil, 0, writer)
+}
+
+// WriteHTMLForLinksWithData is WriteHTMLForLinks with extra fields for the
+// template, alongside Title and Sections (see PageData.withData)
+func WriteHTMLForLinksWithData(title string, sections []Section, extra map[string]interface{}, writer io.Writer) error {
+	return writeHTMLForLinks(PageData{Title: title, Sections: sections}, extra, 0, writer)
+}
+
+func writeHTMLForLinks(data PageData, extra map[string]interface{}, commitLength int, writer io.Writer) error {
+	vars, err := data.withData(extra)
+	if err != nil {
+		return err
 	}
 
-	t, err := template.New("t").Parse(htmlTemplate)
+	t, err := template.New("t").Funcs(htmlFuncs(commitLength)).Parse(htmlTemplate)
 	if err != nil {
 		return err
 	}
@@ -226,8 +742,40 @@ type Platform struct {
 	PrefixSupport string
 	Suffix        string
 	LatestName    string
+	// Arch is the architecture of the platform's builds
+	Arch string
+	// ContentDisposition, if set, is the Content-Disposition format for the
+	// LatestName copy, where %s is the name of the release that was copied
+	ContentDisposition string
+	// VersionedLatestName, if set, is a template for an additional copy of
+	// the latest release, for example Keybase-{{.Version}}-{{.Arch}}.dmg
+	VersionedLatestName string
 }
 
+// latestNameVars are the fields available to a VersionedLatestName template
+type latestNameVars struct {
+	Version string
+	Arch    string
+	Name    string
+}
+
+// versionedLatestName renders the VersionedLatestName template for a release
+func (p Platform) versionedLatestName(version string, name string) (string, error) {
+	t, err := template.New("VersionedLatestName").Parse(p.VersionedLatestName)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, latestNameVars{Version: version, Arch: p.Arch, Name: name}); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// attachmentDisposition has browsers save the latest copy with the name of
+// the release it was copied from
+const attachmentDisposition = `attachment; filename="%s"`
+
 // CopyLatest copies latest release to a fixed path
 func CopyLatest(bucketName string, platform string, dryRun bool) error {
 	client, err := NewClient()
@@ -246,10 +794,10 @@ const (
 	PlatformTypeWindows = "windows"
 )
 
-var platformDarwin = Platform{Name: PlatformTypeDarwin, Prefix: "darwin/", PrefixSupport: "darwin-support/", LatestName: "Keybase.dmg"}
-var platformLinuxDeb = Platform{Name: "deb", Prefix: "linux_binaries/deb/", Suffix: "_amd64.deb", LatestName: "keybase_amd64.deb"}
-var platformLinuxRPM = Platform{Name: "rpm", Prefix: "linux_binaries/rpm/", Suffix: ".x86_64.rpm", LatestName: "keybase_amd64.rpm"}
-var platformWindows = Platform{Name: PlatformTypeWindows, Prefix: "windows/", PrefixSupport: "windows-support/", LatestName: "keybase_setup_amd64.msi"}
+var platformDarwin = Platform{Name: PlatformTypeDarwin, Prefix: "darwin/", PrefixSupport: "darwin-support/", Suffix: ".dmg", LatestName: "Keybase.dmg", Arch: ArchAMD64, ContentDisposition: attachmentDisposition}
+var platformLinuxDeb = Platform{Name: "deb", Prefix: "linux_binaries/deb/", Suffix: "_amd64.deb", LatestName: "keybase_amd64.deb", Arch: ArchAMD64}
+var platformLinuxRPM = Platform{Name: "rpm", Prefix: "linux_binaries/rpm/", Suffix: ".x86_64.rpm", LatestName: "keybase_amd64.rpm", Arch: ArchAMD64}
+var platformWindows = Platform{Name: PlatformTypeWindows, Prefix: "windows/", PrefixSupport: "windows-support/", LatestName: "keybase_setup_amd64.msi", Arch: ArchAMD64, ContentDisposition: attachmentDisposition}
 
 var platformsAll = []Platform{
 	platformDarwin,
@@ -260,37 +808,141 @@ var platformsAll = []Platform{
 
 // Platforms returns platforms for a name (linux may have multiple platforms) or all platforms is "" is specified
 func Platforms(name string) ([]Platform, error) {
+	var platforms []Platform
 	switch name {
 	case PlatformTypeDarwin:
-		return []Platform{platformDarwin}, nil
+		platforms = []Platform{platformDarwin}
 	case PlatformTypeLinux:
-		return []Platform{platformLinuxDeb, platformLinuxRPM}, nil
+		platforms = []Platform{platformLinuxDeb, platformLinuxRPM}
+	case platformLinuxDeb.Name:
+		platforms = []Platform{platformLinuxDeb}
+	case platformLinuxRPM.Name:
+		platforms = []Platform{platformLinuxRPM}
 	case PlatformTypeWindows:
-		return []Platform{platformWindows}, nil
+		platforms = []Platform{platformWindows}
 	case "":
-		return platformsAll, nil
+		platforms = platformsAll
 	default:
 		return nil, fmt.Errorf("Invalid platform %s", name)
 	}
+	for _, platform := range platforms {
+		if err := platform.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return platforms, nil
 }
 
-func listAllObjects(bucketName string, prefix string) ([]*s3.Object, error) {
-	client, err := NewClient()
+// windowsInstallerExts are the extensions a windows LatestName can have, since
+// the windows platform has no Suffix to check it against
+var windowsInstallerExts = []string{".msi", ".exe"}
+
+// Validate checks the platform is consistent, so a release isn't copied to a
+// LatestName of a different type or arch. If there is no Suffix (windows) the
+// LatestName has to be a windows installer.
+func (p Platform) Validate() error {
+	if p.LatestName == "" {
+		return fmt.Errorf("Platform %s has no LatestName", p.Name)
+	}
+	if err := p.validateVersionedLatestName(); err != nil {
+		return err
+	}
+	for _, name := range []string{p.LatestName, p.Suffix} {
+		if arch := archForName(name); p.Arch != "" && arch != "" && arch != p.Arch {
+			return fmt.Errorf("Platform %s is %s but has %s for %s", p.Name, p.Arch, name, arch)
+		}
+	}
+	if p.Suffix == "" {
+		if !p.isWindowsInstaller(p.LatestName) {
+			return fmt.Errorf("Platform %s has LatestName %s that isn't a windows installer (%s)", p.Name, p.LatestName, strings.Join(windowsInstallerExts, ", "))
+		}
+		return nil
+	}
+	latestExt := path.Ext(p.LatestName)
+	suffixExt := path.Ext(p.Suffix)
+	if latestExt != suffixExt {
+		return fmt.Errorf("Platform %s has LatestName %s that doesn't match suffix %s", p.Name, p.LatestName, p.Suffix)
+	}
+	return nil
+}
+
+// validateVersionedLatestName checks the VersionedLatestName template renders
+// and, like LatestName, matches the suffix
+func (p Platform) validateVersionedLatestName() error {
+	if p.VersionedLatestName == "" {
+		return nil
+	}
+	name, err := p.versionedLatestName("1.0.0", "release")
+	if err != nil {
+		return fmt.Errorf("Platform %s has an invalid VersionedLatestName: %s", p.Name, err)
+	}
+	if p.Suffix != "" && path.Ext(name) != path.Ext(p.Suffix) {
+		return fmt.Errorf("Platform %s has VersionedLatestName %s that doesn't match suffix %s", p.Name, p.VersionedLatestName, p.Suffix)
+	}
+	if p.Suffix == "" && !p.isWindowsInstaller(name) {
+		return fmt.Errorf("Platform %s has VersionedLatestName %s that isn't a windows installer (%s)", p.Name, p.VersionedLatestName, strings.Join(windowsInstallerExts, ", "))
+	}
+	return nil
+}
+
+// isWindowsInstaller is whether name has a windows installer extension, if
+// the platform is windows (or a windows variant). Other platforms without a
+// Suffix take whatever type their LatestName is.
+func (p Platform) isWindowsInstaller(name string) bool {
+	if !strings.HasPrefix(p.Name, PlatformTypeWindows) {
+		return true
+	}
+	for _, ext := range windowsInstallerExts {
+		if strings.EqualFold(path.Ext(name), ext) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Client) listAllObjects(bucketName string, prefix string) ([]*s3.Object, error) {
+	objs := make([]*s3.Object, 0, defaultListPageSize)
+	err := c.listObjectPages(bucketName, prefix, func(page []*s3.Object) error {
+		objs = append(objs, page...)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
+	return objs, nil
+}
+
+// listDelimiter is "/", so listings don't include subdirectories, unless
+// versions are in the path (KeyVersionPattern)
+func (c *Client) listDelimiter() string {
+	if c.KeyVersionPattern != nil {
+		return ""
+	}
+	return "/"
+}
 
+// listObjectPages calls f with each page of objects at prefix, so callers
+// that don't need the whole listing don't have to keep it in memory
+func (c *Client) listObjectPages(bucketName string, prefix string, f func(page []*s3.Object) error) error {
+	pageSize := c.ListPageSize
+	if pageSize <= 0 {
+		pageSize = defaultListPageSize
+	}
 	marker := ""
-	objs := make([]*s3.Object, 0, 1000)
 	for {
-		resp, err := client.svc.ListObjects(&s3.ListObjectsInput{
+		resp, err := c.svc.ListObjects(&s3.ListObjectsInput{
 			Bucket:    aws.String(bucketName),
-			Delimiter: aws.String("/"),
+			Delimiter: aws.String(c.listDelimiter()),
 			Prefix:    aws.String(prefix),
 			Marker:    aws.String(marker),
+			MaxKeys:   aws.Int64(int64(pageSize)),
 		})
+		if marker == "" && isEmptyListing(err) {
+			c.logf(VerbosityQuiet, "Treating %s as empty: %s", prefix, err)
+			break
+		}
 		if err != nil {
-			return nil, err
+			return err
 		}
 		if resp == nil {
 			break
@@ -302,30 +954,96 @@ func listAllObjects(bucketName string, prefix string) ([]*s3.Object, error) {
 		if out.NextMarker != nil {
 			nextMarker = *out.NextMarker
 		}
+		// NextMarker is optional (S3 only returns it with a delimiter), in which
+		// case the next page starts after the last key in this one
+		if nextMarker == "" && len(out.Contents) > 0 {
+			nextMarker = *out.Contents[len(out.Contents)-1].Key
+		}
 		if out.IsTruncated != nil {
 			truncated = *out.IsTruncated
 		}
 
-		objs = append(objs, out.Contents...)
+		if err := f(out.Contents); err != nil {
+			return err
+		}
 		if !truncated {
 			break
 		}
 
-		log.Printf("Response is truncated, next marker is %s\n", nextMarker)
+		c.logf(VerbosityDebug, "Response is truncated, next marker is %s\n", nextMarker)
 		marker = nextMarker
 	}
 
-	return objs, nil
+	return nil
 }
 
 // FindRelease searches for a release matching a predicate
 func (p *Platform) FindRelease(bucketName string, f func(r Release) bool) (*Release, error) {
-	contents, err := listAllObjects(bucketName, p.Prefix)
+	client, err := NewClient()
+	if err != nil {
+		return nil, err
+	}
+	return client.findRelease(bucketName, *p, f)
+}
+
+// findRelease returns the newest release matching a predicate
+func (c *Client) findRelease(bucketName string, p Platform, f func(r Release) bool) (*Release, error) {
+	// Sidecars may be on a different page than their release, so they need
+	// the full listing, and metadata has to be read before comparing.
+	if c.MetaSidecars || c.ObjectMetadata {
+		return c.findReleaseInListing(bucketName, p, f)
+	}
+	return c.findReleaseStreaming(bucketName, p, f)
+}
+
+// findPromotable is findRelease, or if there's a listing, the newest matching
+// release in it
+func (c *Client) findPromotable(bucketName string, p Platform, listing *promotionListing, f func(r Release) bool) (*Release, error) {
+	if listing == nil {
+		return c.findRelease(bucketName, p, f)
+	}
+	var newest *Release
+	for _, release := range listing.releases {
+		if newest != nil && !release.Date.After(newest.Date) {
+			continue
+		}
+		if f(release) {
+			r := release
+			newest = &r
+		}
+	}
+	return newest, nil
+}
+
+// findReleaseStreaming finds the newest matching release a page at a time,
+// only keeping the best candidate, so memory doesn't grow with the bucket.
+func (c *Client) findReleaseStreaming(bucketName string, p Platform, f func(r Release) bool) (*Release, error) {
+	prefix := normalizePrefix(p.Prefix)
+	var newest *Release
+	err := c.listObjectPages(bucketName, prefix, func(page []*s3.Object) error {
+		for _, release := range c.parseReleases(page, bucketName, prefix, p.Suffix) {
+			if newest != nil && !release.Date.After(newest.Date) {
+				continue
+			}
+			if f(release) {
+				r := release
+				newest = &r
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newest, nil
+}
+
+func (c *Client) findReleaseInListing(bucketName string, p Platform, f func(r Release) bool) (*Release, error) {
+	releases, err := c.listReleases(bucketName, p.Prefix, p.Suffix, 0)
 	if err != nil {
 		return nil, err
 	}
 
-	releases := loadReleases(contents, bucketName, p.Prefix, p.Suffix, 0)
 	for _, release := range releases {
 		if !strings.HasSuffix(release.Key, p.Suffix) {
 			continue
@@ -358,46 +1076,139 @@ func (p Platform) WriteHTML(bucketName string) error {
 
 // CopyLatest copies latest release to a fixed path for the Client
 func (c *Client) CopyLatest(bucketName string, platform string, dryRun bool) error {
-	platforms, err := Platforms(platform)
+	platforms, err := c.defaultPlatforms(bucketName, platform)
 	if err != nil {
 		return err
 	}
+	var empty []string
 	for _, platform := range platforms {
-		var url string
-		// Use update json to look for current DMG (for darwin)
-		// TODO: Fix for linux
-		if platform.Name == PlatformTypeDarwin || platform.Name == PlatformTypeWindows {
-			url, err = c.copyFromUpdate(platform, bucketName)
-		} else {
-			_, url, err = c.copyFromReleases(platform, bucketName)
-		}
+		copied, err := c.copyLatest(bucketName, platform, dryRun)
 		if err != nil {
 			return err
 		}
-		if url == "" {
+		if !copied {
+			empty = append(empty, platform.Name)
 			continue
 		}
-
 		if dryRun {
-			log.Printf("DRYRUN: Would copy latest %s to %s\n", url, platform.LatestName)
 			return nil
 		}
+	}
+	if c.StrictCopyLatest && len(empty) > 0 {
+		return fmt.Errorf("No release found for %s", strings.Join(empty, ", "))
+	}
+	return nil
+}
 
-		_, err := c.svc.CopyObject(&s3.CopyObjectInput{
-			Bucket:       aws.String(bucketName),
-			CopySource:   aws.String(url),
-			Key:          aws.String(platform.LatestName),
-			CacheControl: aws.String(defaultCacheControl),
-			ACL:          aws.String("public-read"),
-		})
+// CopyLatestForPlatform copies the latest release to the fixed path for a
+// single platform (darwin, deb, rpm or windows) and its variants (see
+// PlatformVariants), leaving the others alone
+func (c *Client) CopyLatestForPlatform(bucketName string, platformName string) error {
+	platform, err := platformForName(platformName)
+	if err != nil {
+		return err
+	}
+	var empty []string
+	for _, p := range append([]Platform{platform}, c.PlatformVariants[platform.Name]...) {
+		if err := p.Validate(); err != nil {
+			return err
+		}
+		copied, err := c.copyLatest(bucketName, p, false)
 		if err != nil {
 			return err
 		}
+		if !copied {
+			empty = append(empty, p.Name)
+		}
+	}
+	if c.StrictCopyLatest && len(empty) > 0 {
+		return fmt.Errorf("No release found for %s", strings.Join(empty, ", "))
 	}
 	return nil
 }
 
-func (c *Client) copyFromUpdate(platform Platform, bucketName string) (url string, err error) {
+// copyLatest copies the latest release for a platform to its LatestName,
+// returning false if there is no release
+func (c *Client) copyLatest(bucketName string, platform Platform, dryRun bool) (bool, error) {
+	var version, key string
+	var err error
+	// Use update json to look for current DMG (for darwin)
+	// TODO: Fix for linux
+	if platform.Name == PlatformTypeDarwin || platform.Name == PlatformTypeWindows {
+		version, key, err = c.copyFromUpdate(platform, bucketName)
+	} else {
+		var release *Release
+		release, key, err = c.copyFromReleases(platform, bucketName)
+		if release != nil {
+			version = release.Version
+		}
+	}
+	if err != nil {
+		return false, err
+	}
+	if key == "" {
+		c.logf(VerbosityNormal, "No release found for %s, not updating %s", platform.Name, platform.LatestName)
+		return false, nil
+	}
+	url, name := urlStringForKey(key, bucketName, platform.Prefix)
+	latestNames := []string{platform.LatestName}
+	if platform.VersionedLatestName != "" {
+		versionedName, err := platform.versionedLatestName(version, name)
+		if err != nil {
+			return false, err
+		}
+		latestNames = append(latestNames, versionedName)
+	}
+
+	if dryRun {
+		for _, latestName := range latestNames {
+			c.logf(VerbosityNormal, "DRYRUN: Would copy latest %s to %s", url, latestName)
+		}
+		return true, nil
+	}
+
+	input, err := c.latestCopyInput(bucketName, platform, key)
+	if err != nil {
+		return false, err
+	}
+	for _, latestName := range latestNames {
+		input.Key = aws.String(latestName)
+		if _, err := c.svc.CopyObject(input); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// latestCopyInput is the copy of a release (at key) to a latest name, without
+// the destination Key. With a ContentDisposition, browsers save the copy with
+// the release's name.
+func (c *Client) latestCopyInput(bucketName string, platform Platform, key string) (*s3.CopyObjectInput, error) {
+	url, name := urlStringForKey(key, bucketName, platform.Prefix)
+	input := &s3.CopyObjectInput{
+		Bucket:       aws.String(bucketName),
+		CopySource:   aws.String(url),
+		CacheControl: aws.String(defaultCacheControl),
+		ACL:          aws.String("public-read"),
+	}
+	if platform.ContentDisposition != "" {
+		// Replacing metadata also replaces the content type, so keep the
+		// one from the source.
+		head, err := c.svc.HeadObject(&s3.HeadObjectInput{
+			Bucket: aws.String(bucketName),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			return nil, err
+		}
+		input.ContentType = head.ContentType
+		input.ContentDisposition = aws.String(fmt.Sprintf(platform.ContentDisposition, name))
+		input.MetadataDirective = aws.String(s3.MetadataDirectiveReplace)
+	}
+	return input, nil
+}
+
+func (c *Client) copyFromUpdate(platform Platform, bucketName string) (version string, key string, err error) {
 	currentUpdate, path, err := c.CurrentUpdate(bucketName, defaultChannel, platform.Name, "prod")
 	if err != nil {
 		err = fmt.Errorf("Error getting current public update: %s", err)
@@ -407,39 +1218,79 @@ func (c *Client) copyFromUpdate(platform Platform, bucketName string) (url strin
 		err = fmt.Errorf("No latest for %s at %s", platform.Name, path)
 		return
 	}
-	switch platform.Name {
-	case PlatformTypeDarwin:
-		url = urlString(bucketName, platform.Prefix, fmt.Sprintf("Keybase-%s.dmg", currentUpdate.Version))
-	case PlatformTypeWindows:
-		url = urlString(bucketName, platform.Prefix, fmt.Sprintf("Keybase_%s.amd64.msi", currentUpdate.Version))
-	default:
+	name, err := platform.releaseFileName(currentUpdate.Version)
+	if err != nil {
 		err = fmt.Errorf("Unsupported platform for copyFromUpdate")
+		return
 	}
+	version = currentUpdate.Version
+	key = normalizePrefix(platform.Prefix) + name
 	return
 }
 
-func (c *Client) copyFromReleases(platform Platform, bucketName string) (release *Release, url string, err error) {
-	release, err = platform.FindRelease(bucketName, func(r Release) bool { return true })
+func (c *Client) copyFromReleases(platform Platform, bucketName string) (release *Release, key string, err error) {
+	release, err = c.findLatestRelease(bucketName, platform, func(r Release) bool {
+		if r.IsPrerelease() && !c.CopyLatestPrereleases {
+			c.logf(VerbosityVerbose, "Skipping pre-release %s", r.Version)
+			return false
+		}
+		return true
+	})
 	if err != nil || release == nil {
 		return
 	}
-	url, _ = urlStringForKey(release.Key, bucketName, platform.Prefix)
+	key = release.Key
 	return
 }
 
 // CurrentUpdate returns current update for a platform
 func (c *Client) CurrentUpdate(bucketName string, channel string, platformName string, env string) (currentUpdate *Update, path string, err error) {
-	path = updateJSONName(channel, platformName, env)
+	path = UpdateJSONName(channel, platformName, env)
+	currentUpdate, err = c.getUpdate(bucketName, path)
+	return
+}
+
+// CurrentUpdateRaw returns the bytes of the current update JSON for a
+// platform, as stored, without decoding it. If there is no current update, it
+// returns nil.
+func (c *Client) CurrentUpdateRaw(bucketName string, platformName string, env string, channel string) ([]byte, error) {
 	resp, err := c.svc.GetObject(&s3.GetObjectInput{
 		Bucket: aws.String(bucketName),
-		Key:    aws.String(path),
+		Key:    aws.String(UpdateJSONName(channel, platformName, env)),
 	})
+	if isNotFound(err) {
+		return nil, nil
+	}
 	if err != nil {
-		return
+		return nil, err
 	}
 	defer func() { _ = resp.Body.Close() }()
-	currentUpdate, err = DecodeJSON(resp.Body)
-	return
+	return ioutil.ReadAll(resp.Body)
+}
+
+func (c *Client) getUpdate(bucketName string, key string) (*Update, error) {
+	return c.getUpdateIfMatch(bucketName, key, "")
+}
+
+// getUpdateIfMatch is getUpdate, failing if etag is set and the object
+// doesn't have it
+func (c *Client) getUpdateIfMatch(bucketName string, key string, etag string) (*Update, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(key),
+	}
+	if etag != "" {
+		input.IfMatch = aws.String(quoteETag(etag))
+	}
+	resp, err := c.svc.GetObject(input)
+	if isPreconditionFailed(err) {
+		return nil, fmt.Errorf("%s changed since it was reviewed (ETag isn't %s)", key, quoteETag(etag))
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	return DecodeJSON(resp.Body)
 }
 
 func promoteRelease(bucketName string, delay time.Duration, hourEastern int, toChannel string, platform Platform, env string, allowDowngrade bool, release string) (*Release, error) {
@@ -450,7 +1301,9 @@ func promoteRelease(bucketName string, delay time.Duration, hourEastern int, toC
 	return client.PromoteRelease(bucketName, delay, hourEastern, toChannel, platform, env, allowDowngrade, release)
 }
 
-func updateJSONName(channel string, platformName string, env string) string {
+// UpdateJSONName is the name of a platform's update JSON for a channel, at
+// the top of the bucket. The base update JSON's channel is "".
+func UpdateJSONName(channel string, platformName string, env string) string {
 	if channel == "" {
 		return fmt.Sprintf("update-%s-%s.json", platformName, env)
 	}
@@ -484,7 +1337,7 @@ func PromoteARelease(releaseName string, bucketName string, platform string, dry
 	if dryRun {
 		return release, nil
 	}
-	log.Printf("Promoted %s release: %s\n", platform, releaseName)
+	client.logf(VerbosityNormal, "Promoted %s release: %s", platform, releaseName)
 	return release, nil
 }
 
@@ -499,7 +1352,7 @@ func (c *Client) promoteAReleaseToProd(releaseName string, bucketName string, pl
 		return nil, fmt.Errorf("Unsupported for this platform: %s", platform.Name)
 	}
 
-	release, err = platform.FindRelease(bucketName, func(r Release) bool {
+	release, err = c.findRelease(bucketName, platform, func(r Release) bool {
 		return r.Name == filePath
 	})
 	if err != nil {
@@ -508,15 +1361,15 @@ func (c *Client) promoteAReleaseToProd(releaseName string, bucketName string, pl
 	if release == nil {
 		return nil, fmt.Errorf("No matching release found")
 	}
-	log.Printf("Found %s release %s (%s), %s", platform.Name, release.Name, time.Since(release.Date), release.Version)
-	jsonName := updateJSONName(toChannel, platform.Name, env)
-	jsonURL := urlString(bucketName, platform.PrefixSupport, fmt.Sprintf("update-%s-%s-%s.json", platform.Name, env, release.Version))
+	c.logf(VerbosityVerbose, "Found %s release %s (%s), %s", platform.Name, release.Name, time.Since(release.Date), release.Version)
+	jsonName := UpdateJSONName(toChannel, platform.Name, env)
+	jsonURL := urlString(bucketName, platform.PrefixSupport, SupportUpdateName(platform.Name, env, release.Version))
 
 	if dryRun {
-		log.Printf("DRYRUN: Would PutCopy %s to %s\n", jsonURL, jsonName)
+		c.logf(VerbosityNormal, "DRYRUN: Would PutCopy %s to %s", jsonURL, jsonName)
 		return release, nil
 	}
-	log.Printf("PutCopying %s to %s\n", jsonURL, jsonName)
+	c.logf(VerbosityNormal, "PutCopying %s to %s", jsonURL, jsonName)
 	_, err = c.svc.CopyObject(&s3.CopyObjectInput{
 		Bucket:       aws.String(bucketName),
 		CopySource:   aws.String(jsonURL),
@@ -529,45 +1382,143 @@ func (c *Client) promoteAReleaseToProd(releaseName string, bucketName string, pl
 
 // PromoteRelease promotes a release to a channel
 func (c *Client) PromoteRelease(bucketName string, delay time.Duration, beforeHourEastern int, toChannel string, platform Platform, env string, allowDowngrade bool, releaseName string) (*Release, error) {
-	log.Printf("Finding release to promote to %q (%s delay)", toChannel, delay)
-	var release *Release
-	var err error
+	result, err := c.PromoteReleaseWithOptions(bucketName, toChannel, platform, env, PromoteOptions{
+		Delay:             delay,
+		BeforeHourEastern: beforeHourEastern,
+		AllowDowngrade:    allowDowngrade,
+		ReleaseName:       releaseName,
+	})
+	if err != nil || !result.Promoted {
+		return nil, err
+	}
+	return result.Release, nil
+}
 
-	if releaseName != "" {
-		releaseName = fmt.Sprintf("Keybase-%s.dmg", releaseName)
-		release, err = platform.FindRelease(bucketName, func(r Release) bool {
+// PromoteReleaseWithOptions promotes a release to a channel. If nothing was
+// promoted, the result says why.
+func (c *Client) PromoteReleaseWithOptions(bucketName string, toChannel string, platform Platform, env string, opts PromoteOptions) (*PromoteResult, error) {
+	p, err := c.evaluatePromotion(bucketName, toChannel, platform, env, opts, nil)
+	if err != nil {
+		return nil, err
+	}
+	if p.result.Reason != "" {
+		return p.result, nil
+	}
+	if err := c.writePromotion(bucketName, p); err != nil {
+		return nil, err
+	}
+	return p.result, nil
+}
+
+// promotion is an evaluated promotion, to write unless its result has a
+// Reason it isn't promoted
+type promotion struct {
+	result   *PromoteResult
+	platform Platform
+	opts     PromoteOptions
+	// upd is the update JSON to write, if it isn't a copy of the support JSON
+	upd *Update
+}
+
+// promotionListing is what evaluating a promotion lists, to share between
+// promotions: the platform's releases and the held versions
+type promotionListing struct {
+	releases []Release
+	held     map[string]string
+}
+
+// evaluatePromotion finds the release to promote to a channel and checks it
+// can be, without writing anything. If listing is set, it's used instead of
+// listing the bucket again.
+func (c *Client) evaluatePromotion(bucketName string, toChannel string, platform Platform, env string, opts PromoteOptions, listing *promotionListing) (*promotion, error) {
+	c.logf(VerbosityVerbose, "Finding release to promote to %q (%s delay)", toChannel, opts.Delay)
+	p := &promotion{result: &PromoteResult{Platform: platform.Name, Channel: toChannel, Env: env}, platform: platform, opts: opts}
+	if opts.MinimumFromVersion != "" {
+		if err := validateMinimumFromVersion(opts.MinimumFromVersion, ""); err != nil {
+			return nil, err
+		}
+	}
+	lockReason, locked, err := c.promotionLock(bucketName)
+	if err != nil {
+		return nil, err
+	}
+	if locked {
+		c.logf(VerbosityQuiet, "Promotions are locked: %s", lockReason)
+		p.result.Reason = "locked"
+		return p, nil
+	}
+	var match func(r Release) bool
+	if opts.ReleaseName != "" {
+		releaseName := fmt.Sprintf("Keybase-%s.dmg", opts.ReleaseName)
+		match = func(r Release) bool {
 			return r.Name == releaseName
-		})
+		}
 	} else {
-		release, err = platform.FindRelease(bucketName, func(r Release) bool {
-			log.Printf("Checking release date %s", r.Date)
-			if delay != 0 && time.Since(r.Date) < delay {
+		cutoff := opts.cutoff()
+		match = func(r Release) bool {
+			c.logf(VerbosityDebug, "Checking release date %s", r.Date)
+			if opts.Delay != 0 && time.Since(r.Date) < opts.Delay {
 				return false
 			}
-			hour, _, _ := r.Date.Clock()
-			if beforeHourEastern != 0 && hour >= beforeHourEastern {
+			if cutoff != nil && !cutoff.Allows(r.Date) {
 				return false
 			}
 			return true
-		})
+		}
+	}
+
+	var held map[string]string
+	if listing != nil {
+		held = listing.held
+	} else if held, err = c.heldVersions(bucketName); err != nil {
+		return nil, err
 	}
 
+	notAllowed, isHeld := false, false
+	release, err := c.findPromotable(bucketName, platform, listing, func(r Release) bool {
+		if !match(r) {
+			return false
+		}
+		if !opts.allows(r.Version) {
+			c.logf(VerbosityVerbose, "Skipping release %s, not in allowlist", r.Version)
+			notAllowed = true
+			return false
+		}
+		if reason, ok := held[r.Version]; ok {
+			c.logf(VerbosityVerbose, "Skipping release %s, it's held: %s", r.Version, reason)
+			isHeld = true
+			return false
+		}
+		return true
+	})
 	if err != nil {
 		return nil, err
 	}
 
 	if release == nil {
-		log.Printf("No matching release found")
-		return nil, nil
+		if notAllowed {
+			p.result.Reason = "not in allowlist"
+			return p, nil
+		}
+		if isHeld {
+			p.result.Reason = "held"
+			return p, nil
+		}
+		c.logf(VerbosityVerbose, "No matching release found")
+		p.result.Reason = "no matching release"
+		return p, nil
 	}
-	log.Printf("Found release %s (%s), %s", release.Name, time.Since(release.Date), release.Version)
+	c.logf(VerbosityVerbose, "Found release %s (%s), %s", release.Name, time.Since(release.Date), release.Version)
+	p.result.Release = release
+	result := p.result
 
 	currentUpdate, _, err := c.CurrentUpdate(bucketName, toChannel, platform.Name, env)
 	if err != nil {
-		log.Printf("Error looking for current update: %s (%s)", err, platform.Name)
+		c.logf(VerbosityQuiet, "Error looking for current update: %s (%s)", err, platform.Name)
 	}
 	if currentUpdate != nil {
-		log.Printf("Found current update: %s", currentUpdate.Version)
+		c.logf(VerbosityVerbose, "Found current update: %s", currentUpdate.Version)
+		result.FromVersion = currentUpdate.Version
 		var currentVer semver.Version
 		currentVer, err = semver.Make(currentUpdate.Version)
 		if err != nil {
@@ -579,33 +1530,172 @@ func (c *Client) PromoteRelease(bucketName string, delay time.Duration, beforeHo
 			return nil, err
 		}
 
-		if releaseVer.Equals(currentVer) {
-			log.Printf("Release unchanged")
-			return nil, nil
+		if releaseVer.Equals(currentVer) && release.Version != currentUpdate.Version {
+			// Semver ignores build metadata, but it's a different commit
+			c.logf(VerbosityVerbose, "Release %s is a different build of the current update %s", release.Version, currentUpdate.Version)
+			if !opts.PromoteRebuilds {
+				result.Reason = "rebuild of current update"
+				return p, nil
+			}
+			c.logf(VerbosityNormal, "Promoting rebuild")
+		} else if releaseVer.Equals(currentVer) {
+			c.logf(VerbosityVerbose, "Release unchanged")
+			result.Reason = "unchanged"
+			return p, nil
 		} else if releaseVer.LT(currentVer) {
-			if !allowDowngrade {
-				log.Printf("Release older than current update")
-				return nil, nil
+			if !opts.AllowDowngrade {
+				c.logf(VerbosityVerbose, "Release older than current update")
+				result.Reason = "older than current update"
+				return p, nil
+			}
+			c.logf(VerbosityNormal, "Allowing downgrade")
+		}
+
+		if opts.Cooldown != 0 {
+			var promotedAt time.Time
+			promotedAt, err = c.lastPromoted(bucketName, UpdateJSONName(toChannel, platform.Name, env))
+			if err != nil {
+				return nil, err
+			}
+			if since := timeNow().Sub(promotedAt); since < opts.Cooldown {
+				c.logf(VerbosityVerbose, "Channel %s was promoted %s ago, within cooldown (%s)", toChannel, since, opts.Cooldown)
+				result.Reason = "within cooldown"
+				return p, nil
+			}
+		}
+
+		if opts.MaxSizeGrowthPercent != 0 {
+			var currentSize int64
+			currentSize, err = c.releaseSize(bucketName, platform, listing, currentUpdate.Version)
+			if err != nil {
+				return nil, err
+			}
+			if currentSize < 0 {
+				c.logf(VerbosityVerbose, "No release found for current update %s, not checking size", currentUpdate.Version)
+			} else if growth := sizeGrowthPercent(currentSize, release.Size); growth > opts.MaxSizeGrowthPercent {
+				c.logf(VerbosityVerbose, "Release %s is %d bytes, %.1f%% bigger than %s (%d bytes)", release.Version, release.Size, growth, currentUpdate.Version, currentSize)
+				result.Reason = fmt.Sprintf("size regression (+%.1f%%)", growth)
+				return p, nil
 			}
-			log.Printf("Allowing downgrade")
 		}
 	}
 
-	jsonURL := urlString(bucketName, platform.PrefixSupport, fmt.Sprintf("update-%s-%s-%s.json", platform.Name, env, release.Version))
-	jsonName := updateJSONName(toChannel, platform.Name, env)
-	log.Printf("PutCopying %s to %s\n", jsonURL, jsonName)
-	_, err = c.svc.CopyObject(&s3.CopyObjectInput{
-		Bucket:       aws.String(bucketName),
-		CopySource:   aws.String(jsonURL),
-		Key:          aws.String(jsonName),
-		CacheControl: aws.String(defaultCacheControl),
-		ACL:          aws.String("public-read"),
-	})
+	if opts.MinSignoffs > 0 {
+		signoffs, err := c.countSignoffs(bucketName, release.Version)
+		if err != nil {
+			return nil, err
+		}
+		if signoffs < opts.MinSignoffs {
+			result.Reason = fmt.Sprintf("awaiting signoffs (%d/%d)", signoffs, opts.MinSignoffs)
+			c.logf(VerbosityVerbose, "Release %s is %s", release.Version, result.Reason)
+			return p, nil
+		}
+		c.logf(VerbosityVerbose, "Release %s has %d signoff(s)", release.Version, signoffs)
+	}
+
+	if opts.RequireSmokeTest {
+		var passed bool
+		passed, err = c.objectExists(bucketName, smokeTestKey(platform.Name, release.Version))
+		if err != nil {
+			return nil, err
+		}
+		if !passed {
+			result.Reason = "smoke test not passed"
+			c.logf(VerbosityVerbose, "Release %s: %s", release.Version, result.Reason)
+			return p, nil
+		}
+	}
+
+	if opts.RequireVariants {
+		var missing []string
+		missing, err = c.missingVariants(bucketName, platform.Name, release.Version)
+		if err != nil {
+			return nil, err
+		}
+		if len(missing) > 0 {
+			result.Reason = fmt.Sprintf("missing variants (%s)", strings.Join(missing, ", "))
+			c.logf(VerbosityVerbose, "Release %s is %s", release.Version, result.Reason)
+			return p, nil
+		}
+	}
+
+	if opts.Probe != nil {
+		if err = opts.Probe(*release); err != nil {
+			c.logf(VerbosityQuiet, "Canary probe for %s failed: %s", release.Version, err)
+			result.Reason = "canary failed"
+			return p, nil
+		}
+	}
+
+	if opts.VerifyAsset {
+		var upd *Update
+		upd, err = c.getUpdate(bucketName, platform.PrefixSupport+SupportUpdateName(platform.Name, env, release.Version))
+		if err != nil {
+			return nil, err
+		}
+		if err = c.checkAsset(bucketName, upd); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.SourceETag != "" {
+		if err = c.checkSourceETag(bucketName, platform.PrefixSupport+SupportUpdateName(platform.Name, env, release.Version), opts.SourceETag); err != nil {
+			return nil, err
+		}
+	}
+
+	var delta *Delta
+	if opts.IncludeDelta && result.FromVersion != "" {
+		delta, err = c.findDelta(bucketName, platform, result.FromVersion, release.Version)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var upd *Update
+	if opts.MinimumFromVersion != "" || opts.Required || delta != nil {
+		if opts.MinimumFromVersion != "" {
+			if err = validateMinimumFromVersion(opts.MinimumFromVersion, release.Version); err != nil {
+				return nil, err
+			}
+		}
+		// The update JSON is written from this copy, so it must be what was
+		// reviewed too
+		upd, err = c.getUpdateIfMatch(bucketName, platform.PrefixSupport+SupportUpdateName(platform.Name, env, release.Version), opts.SourceETag)
+		if err != nil {
+			return nil, err
+		}
+		upd.MinimumFromVersion = opts.MinimumFromVersion
+		upd.Required = opts.Required
+		upd.Delta = delta
+	}
+	p.upd = upd
+	return p, nil
+}
 
+// writePromotion writes the channel's update JSON (and manifest) for an
+// evaluated promotion
+func (c *Client) writePromotion(bucketName string, p *promotion) error {
+	release, platform, opts := p.result.Release, p.platform, p.opts
+	toChannel, env := p.result.Channel, p.result.Env
+	jsonName := UpdateJSONName(toChannel, platform.Name, env)
+	if opts.ManifestSwap {
+		if err := c.swapPromotionManifest(bucketName, platform, toChannel, env, *release, p.upd, opts.SourceETag); err != nil {
+			return err
+		}
+	}
+	metadata := promotionMetadata(c.promotedBy(opts), release.Version)
+	var err error
+	if p.upd != nil {
+		err = c.putUpdateJSONVerified(bucketName, jsonName, *p.upd, metadata)
+	} else {
+		err = c.copyUpdateJSONVerified(bucketName, platform.PrefixSupport, SupportUpdateName(platform.Name, env, release.Version), jsonName, release.Version, opts.SourceETag, metadata)
+	}
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return release, nil
+	p.result.Promoted = true
+	return nil
 }
 
 func copyUpdateJSON(bucketName string, fromChannel string, toChannel string, platformName string, env string) error {
@@ -613,10 +1703,10 @@ func copyUpdateJSON(bucketName string, fromChannel string, toChannel string, pla
 	if err != nil {
 		return err
 	}
-	jsonNameDest := updateJSONName(toChannel, platformName, env)
-	jsonURLSource := urlString(bucketName, "", updateJSONName(fromChannel, platformName, env))
+	jsonNameDest := UpdateJSONName(toChannel, platformName, env)
+	jsonURLSource := urlString(bucketName, "", UpdateJSONName(fromChannel, platformName, env))
 
-	log.Printf("PutCopying %s to %s\n", jsonURLSource, jsonNameDest)
+	client.logf(VerbosityNormal, "PutCopying %s to %s", jsonURLSource, jsonNameDest)
 	_, err = client.svc.CopyObject(&s3.CopyObjectInput{
 		Bucket:       aws.String(bucketName),
 		CopySource:   aws.String(jsonURLSource),
@@ -732,7 +1822,7 @@ func ReleaseBroken(releaseName string, bucketName string, platformName string) (
 		for _, path := range files {
 			sourceURL := urlString(bucketName, "", path)
 			brokenPath := fmt.Sprintf("broken/%s", path)
-			log.Printf("Copying %s to %s", sourceURL, brokenPath)
+			client.logf(VerbosityNormal, "Copying %s to %s", sourceURL, brokenPath)
 
 			_, err := client.svc.CopyObject(&s3.CopyObjectInput{
 				Bucket:       aws.String(bucketName),
@@ -742,11 +1832,11 @@ func ReleaseBroken(releaseName string, bucketName string, platformName string) (
 				ACL:          aws.String("public-read"),
 			})
 			if err != nil {
-				log.Printf("There was an error trying to (put) copy %s: %s", sourceURL, err)
+				client.logf(VerbosityQuiet, "There was an error trying to (put) copy %s: %s", sourceURL, err)
 				continue
 			}
 
-			log.Printf("Deleting: %s", path)
+			client.logf(VerbosityNormal, "Deleting: %s", path)
 			_, err = client.svc.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String(bucketName), Key: aws.String(path)})
 			if err != nil {
 				return removed, err
@@ -756,15 +1846,15 @@ func ReleaseBroken(releaseName string, bucketName string, platformName string) (
 
 		// Update html for platform
 		if err := platform.WriteHTML(bucketName); err != nil {
-			log.Printf("Error updating html: %s", err)
+			client.logf(VerbosityQuiet, "Error updating html: %s", err)
 		}
 
 		// Fix test releases if needed
 		if err := PromoteTestReleases(bucketName, platform.Name, ""); err != nil {
-			log.Printf("Error fixing test releases: %s", err)
+			client.logf(VerbosityQuiet, "Error fixing test releases: %s", err)
 		}
 	}
-	log.Printf("Deleted %d files for %s", len(removed), releaseName)
+	client.logf(VerbosityNormal, "Deleted %d files for %s", len(removed), releaseName)
 	if len(removed) == 0 {
 		return removed, fmt.Errorf("No files to remove for %s", releaseName)
 	}
@@ -4,8 +4,21 @@
 package update
 
 import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
 	"testing"
+	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/keybase/release/update/s3test"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -19,3 +32,727 @@ func testFindRelease(t *testing.T) { // nolint
 	t.Logf("Release: %#v", release)
 	assert.NotEqual(t, "", release.URL)
 }
+
+func testObjects(keys ...string) []*s3.Object {
+	objs := make([]*s3.Object, 0, len(keys))
+	for _, key := range keys {
+		objs = append(objs, &s3.Object{Key: aws.String(key)})
+	}
+	return objs
+}
+
+func TestLoadReleasesPrefixNormalization(t *testing.T) {
+	objs := testObjects(
+		"darwin/Keybase-1.0.14-20160312013917+cd6f696.dmg",
+		"darwin/Keybase-1.0.15-20160313013917+ab12cd3.dmg",
+	)
+	for _, prefix := range []string{"darwin", "darwin/"} {
+		releases := loadReleases(objs, "prerelease.keybase.io", prefix, ".dmg", 0)
+		require.Len(t, releases, 2, prefix)
+		assert.Equal(t, "Keybase-1.0.15-20160313013917+ab12cd3.dmg", releases[0].Name, prefix)
+		assert.Equal(t, "https://s3.amazonaws.com/prerelease.keybase.io/darwin/Keybase-1.0.15-20160313013917%2Bab12cd3.dmg", releases[0].URL, prefix)
+		assert.Equal(t, "darwin/Keybase-1.0.15-20160313013917+ab12cd3.dmg", releases[0].Key, prefix)
+	}
+}
+
+func TestLoadReleasesDedupEscapedKeys(t *testing.T) {
+	older := time.Date(2016, 3, 13, 0, 0, 0, 0, time.UTC)
+	newer := older.Add(time.Hour)
+	objs := []*s3.Object{
+		{Key: aws.String("darwin/Keybase-1.0.15-20160313013917+ab12cd3.dmg"), LastModified: aws.Time(older)},
+		{Key: aws.String("darwin/Keybase-1.0.15-20160313013917%2Bab12cd3.dmg"), LastModified: aws.Time(newer)},
+		{Key: aws.String("darwin/Keybase-1.0.14-20160312013917+cd6f696.dmg"), LastModified: aws.Time(older)},
+	}
+	releases := loadReleases(objs, "bucket", "darwin/", ".dmg", 0)
+	require.Len(t, releases, 2)
+	assert.Equal(t, "darwin/Keybase-1.0.15-20160313013917%2Bab12cd3.dmg", releases[0].Key)
+	assert.Equal(t, "Keybase-1.0.15-20160313013917+ab12cd3.dmg", releases[0].Name)
+	assert.Equal(t, "1.0.15-20160313013917+ab12cd3", releases[0].Version)
+	assert.Equal(t, "darwin/Keybase-1.0.14-20160312013917+cd6f696.dmg", releases[1].Key)
+}
+
+func TestURLStringPrefixNormalization(t *testing.T) {
+	assert.Equal(t, "https://s3.amazonaws.com/bucket/darwin/Keybase.dmg", urlString("bucket", "darwin", "Keybase.dmg"))
+	assert.Equal(t, "https://s3.amazonaws.com/bucket/darwin/Keybase.dmg", urlString("bucket", "darwin/", "Keybase.dmg"))
+	assert.Equal(t, "https://s3.amazonaws.com/bucket/Keybase.dmg", urlString("bucket", "", "Keybase.dmg"))
+}
+
+func TestParseReleasesNameDateLocation(t *testing.T) {
+	eastern, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	objs := testObjects("darwin/Keybase-1.0.14-20160312013917+cd6f696.dmg")
+
+	// UTC in the name is converted to Eastern
+	var c Client
+	releases := c.parseReleases(objs, "bucket", "darwin/", "")
+	require.Len(t, releases, 1)
+	assert.Equal(t, "2016-03-11 20:39:17 EST", releases[0].Date.Format("2006-01-02 15:04:05 MST"))
+	assert.True(t, releases[0].Date.Equal(time.Date(2016, 3, 12, 1, 39, 17, 0, time.UTC)))
+
+	// Eastern in the name is only converted once (stays the same)
+	c.NameDateLocation = eastern
+	releases = c.parseReleases(objs, "bucket", "darwin/", "")
+	require.Len(t, releases, 1)
+	assert.Equal(t, "2016-03-12 01:39:17 EST", releases[0].Date.Format("2006-01-02 15:04:05 MST"))
+	assert.Equal(t, "Sat Mar 12 01:39:17 EST 2016", releases[0].DateString)
+}
+
+func TestParseReleasesNameDateLayout(t *testing.T) {
+	objs := testObjects("darwin/Keybase-1.0.14-2016-03-12T013917+cd6f696.dmg")
+	var c Client
+	releases := c.parseReleases(objs, "bucket", "darwin/", "")
+	require.Len(t, releases, 1)
+	assert.Equal(t, "", releases[0].Version)
+
+	c.NameDateLayout = "2006-01-02T150405"
+	releases = c.parseReleases(objs, "bucket", "darwin/", "")
+	require.Len(t, releases, 1)
+	assert.Equal(t, "1.0.14-2016-03-12T013917+cd6f696", releases[0].Version)
+	assert.True(t, releases[0].Date.Equal(time.Date(2016, 3, 12, 1, 39, 17, 0, time.UTC)))
+}
+
+func seedLargeListing(n int) *s3test.Bucket {
+	f := newFakeS3()
+	f.PageSize = 1000
+	start := time.Date(2016, 3, 12, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < n; i++ {
+		date := start.Add(time.Duration(i) * time.Minute).Format("20060102150405")
+		f.Put(testBucket, fmt.Sprintf("darwin/Keybase-1.0.%d-%s+cd6f696.dmg", i, date), "", start)
+	}
+	return f
+}
+
+func TestFindReleaseStreaming(t *testing.T) {
+	f := seedLargeListing(2500)
+	c := newTestClient(f)
+	first := func(r Release) bool { return true }
+
+	streamed, err := c.findReleaseStreaming(testBucket, platformDarwin, first)
+	require.NoError(t, err)
+	listed, err := c.findReleaseInListing(testBucket, platformDarwin, first)
+	require.NoError(t, err)
+	require.NotNil(t, streamed)
+	assert.Equal(t, listed.Name, streamed.Name)
+	assert.Equal(t, "1.0.2499-20160313173900+cd6f696", streamed.Version)
+
+	notNewest := func(r Release) bool { return r.Version != "1.0.2499-20160313173900+cd6f696" }
+	streamed, err = c.findReleaseStreaming(testBucket, platformDarwin, notNewest)
+	require.NoError(t, err)
+	assert.Equal(t, "1.0.2498-20160313173800+cd6f696", streamed.Version)
+}
+
+func benchmarkFindRelease(b *testing.B, find func(c *Client) (*Release, error)) {
+	c := newTestClient(seedLargeListing(20000))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := find(c); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFindReleaseStreaming(b *testing.B) {
+	benchmarkFindRelease(b, func(c *Client) (*Release, error) {
+		return c.findReleaseStreaming(testBucket, platformDarwin, func(r Release) bool { return true })
+	})
+}
+
+func BenchmarkFindReleaseInListing(b *testing.B) {
+	benchmarkFindRelease(b, func(c *Client) (*Release, error) {
+		return c.findReleaseInListing(testBucket, platformDarwin, func(r Release) bool { return true })
+	})
+}
+
+func TestCopyLatestContentDisposition(t *testing.T) {
+	f := newFakeS3()
+	version := "1.0.15-20160313013917+ab12cd3"
+	f.SetObject(testBucket, "darwin/Keybase-"+version+".dmg", &s3test.Object{Body: []byte("dmg"), ContentType: "application/x-apple-diskimage"})
+	f.Put(testBucket, "linux_binaries/deb/keybase_1.0.15-20160313013917.ab12cd3_amd64.deb", "deb", time.Now())
+	putUpdateJSON(f, testBucket, UpdateJSONName(defaultChannel, PlatformTypeDarwin, "prod"), version)
+	c := newTestClient(f)
+
+	require.NoError(t, c.CopyLatest(testBucket, PlatformTypeDarwin, false))
+	latest := f.Get(testBucket, "Keybase.dmg")
+	require.NotNil(t, latest)
+	assert.Equal(t, "dmg", string(latest.Body))
+	assert.Equal(t, `attachment; filename="Keybase-1.0.15-20160313013917+ab12cd3.dmg"`, latest.ContentDisposition)
+	assert.Equal(t, "application/x-apple-diskimage", latest.ContentType)
+
+	// No disposition configured for deb
+	require.NoError(t, c.CopyLatest(testBucket, PlatformTypeLinux, false))
+	latest = f.Get(testBucket, "keybase_amd64.deb")
+	require.NotNil(t, latest)
+	assert.Equal(t, "", latest.ContentDisposition)
+}
+
+func TestFindReleaseNewestOnLastPage(t *testing.T) {
+	for _, omitNextMarker := range []bool{false, true} {
+		f := newFakeS3()
+		f.OmitNextMarker = omitNextMarker
+		// Keys sort by name, so the newest build is on the second page
+		f.Put(testBucket, "darwin/Keybase-1.0.10-20160301000000+aaaaaaa.dmg", "", time.Now())
+		f.Put(testBucket, "darwin/Keybase-1.0.11-20160101000000+bbbbbbb.dmg", "", time.Now())
+		f.Put(testBucket, "darwin/Keybase-1.0.9-20160401000000+ccccccc.dmg", "", time.Now())
+
+		c := newTestClient(f)
+		c.ListPageSize = 2
+		release, err := c.findRelease(testBucket, platformDarwin, func(r Release) bool { return true })
+		require.NoError(t, err)
+		require.NotNil(t, release)
+		assert.Equal(t, "1.0.9-20160401000000+ccccccc", release.Version, "omitNextMarker=%v", omitNextMarker)
+		assert.Equal(t, 2, f.ListCalls)
+	}
+}
+
+func TestPlatformValidate(t *testing.T) {
+	for _, platform := range platformsAll {
+		assert.NoError(t, platform.Validate(), platform.Name)
+	}
+	mismatched := Platform{Name: "deb", Prefix: "linux_binaries/deb/", Suffix: "_amd64.deb", LatestName: "keybase_amd64.rpm"}
+	assert.Error(t, mismatched.Validate())
+	noLatest := Platform{Name: "deb", Prefix: "linux_binaries/deb/", Suffix: "_amd64.deb"}
+	assert.Error(t, noLatest.Validate())
+	noSuffix := Platform{Name: PlatformTypeDarwin, Prefix: "darwin/", LatestName: "Keybase.dmg"}
+	assert.NoError(t, noSuffix.Validate())
+	// Copied from amd64 without updating the LatestName
+	wrongArch := Platform{Name: "deb-arm64", Prefix: "linux_binaries/deb-arm64/", Suffix: "_arm64.deb", LatestName: "keybase_amd64.deb", Arch: ArchARM64}
+	assert.EqualError(t, wrongArch.Validate(), "Platform deb-arm64 is arm64 but has keybase_amd64.deb for amd64")
+	wrongArch.LatestName = "keybase_arm64.deb"
+	assert.NoError(t, wrongArch.Validate())
+	wrongArch.Suffix = ".x86_64.deb"
+	assert.Error(t, wrongArch.Validate())
+
+	// Windows has no Suffix, so its names have to be installers
+	windows := platformWindows
+	windows.LatestName = "keybase_setup_amd64.zip"
+	assert.EqualError(t, windows.Validate(), "Platform windows has LatestName keybase_setup_amd64.zip that isn't a windows installer (.msi, .exe)")
+	windows.LatestName = "keybase_setup_amd64.exe"
+	assert.NoError(t, windows.Validate())
+	windows.VersionedLatestName = "keybase_setup_{{.Version}}_amd64.json"
+	assert.Error(t, windows.Validate())
+	windows.VersionedLatestName = "keybase_setup_{{.Version}}_amd64.msi"
+	assert.NoError(t, windows.Validate())
+}
+
+func TestListPageSize(t *testing.T) {
+	f := seedLargeListing(25)
+	c := newTestClient(f)
+	objs, err := c.listAllObjects(testBucket, "darwin/")
+	require.NoError(t, err)
+	assert.Len(t, objs, 25)
+	assert.Equal(t, 1, f.ListCalls)
+
+	f.ListCalls = 0
+	c.ListPageSize = 10
+	objs, err = c.listAllObjects(testBucket, "darwin/")
+	require.NoError(t, err)
+	assert.Len(t, objs, 25)
+	assert.Equal(t, 3, f.ListCalls)
+}
+
+func TestCurrentUpdateRaw(t *testing.T) {
+	f := newFakeS3()
+	c := newTestClient(f)
+
+	raw, err := c.CurrentUpdateRaw(testBucket, PlatformTypeDarwin, "prod", "v2")
+	require.NoError(t, err)
+	assert.Nil(t, raw)
+
+	body := `{"version":  "1.0.15", "unknown": true}`
+	f.Put(testBucket, UpdateJSONName("v2", PlatformTypeDarwin, "prod"), body, time.Now())
+	raw, err = c.CurrentUpdateRaw(testBucket, PlatformTypeDarwin, "prod", "v2")
+	require.NoError(t, err)
+	assert.Equal(t, body, string(raw))
+}
+
+func TestWriteHTMLOutputs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestWriteHTMLOutputs")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	enTemplate := filepath.Join(dir, "en.tmpl")
+	frTemplate := filepath.Join(dir, "fr.tmpl")
+	require.NoError(t, ioutil.WriteFile(enTemplate, []byte(`{{ range .Sections }}{{ range .Releases }}Download {{ .Version }}
+{{ end }}{{ end }}`), 0644))
+	require.NoError(t, ioutil.WriteFile(frTemplate, []byte(`{{ range .Sections }}{{ range .Releases }}Télécharger {{ .Version }}
+{{ end }}{{ end }}`), 0644))
+
+	f := newFakeS3()
+	f.Put(testBucket, "darwin/Keybase-1.0.15-20160313013917+ab12cd3.dmg", "dmg", time.Now())
+	c := newTestClient(f)
+	err = c.WriteHTMLOutputs(testBucket, "darwin/", "", []HTMLOutput{
+		{Path: filepath.Join(dir, "en", "index.html"), TemplatePath: enTemplate},
+		{Path: filepath.Join(dir, "fr", "index.html"), TemplatePath: frTemplate},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, f.ListCalls)
+
+	en, err := ioutil.ReadFile(filepath.Join(dir, "en", "index.html"))
+	require.NoError(t, err)
+	assert.Equal(t, "Download 1.0.15-20160313013917+ab12cd3\n", string(en))
+	fr, err := ioutil.ReadFile(filepath.Join(dir, "fr", "index.html"))
+	require.NoError(t, err)
+	assert.Equal(t, "Télécharger 1.0.15-20160313013917+ab12cd3\n", string(fr))
+
+	// SafeOverwrite checks every output before writing any
+	c.SafeOverwrite = true
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "fr", "index.html"), []byte("important"), 0644))
+	require.NoError(t, os.Remove(filepath.Join(dir, "en", "index.html")))
+	err = c.WriteHTMLOutputs(testBucket, "darwin/", "", []HTMLOutput{
+		{Path: filepath.Join(dir, "en", "index.html"), TemplatePath: enTemplate},
+		{Path: filepath.Join(dir, "fr", "index.html"), TemplatePath: frTemplate},
+	})
+	require.EqualError(t, err, "Not overwriting "+filepath.Join(dir, "fr", "index.html")+", it isn't a generated index")
+	_, err = os.Stat(filepath.Join(dir, "en", "index.html"))
+	assert.True(t, os.IsNotExist(err))
+	fr, err = ioutil.ReadFile(filepath.Join(dir, "fr", "index.html"))
+	require.NoError(t, err)
+	assert.Equal(t, "important", string(fr))
+}
+
+func TestCopyLatestStrict(t *testing.T) {
+	f := newFakeS3()
+	f.Put(testBucket, "linux_binaries/deb/keybase_1.0.15-20160313013917.ab12cd3_amd64.deb", "deb", time.Now())
+	c := newTestClient(f)
+
+	// Lenient skips the empty rpm platform
+	require.NoError(t, c.CopyLatest(testBucket, PlatformTypeLinux, false))
+	assert.NotNil(t, f.Get(testBucket, "keybase_amd64.deb"))
+
+	f.Delete(testBucket, "keybase_amd64.deb")
+	c.StrictCopyLatest = true
+	err := c.CopyLatest(testBucket, PlatformTypeLinux, false)
+	require.EqualError(t, err, "No release found for rpm")
+	// Platforms with releases are still copied
+	assert.NotNil(t, f.Get(testBucket, "keybase_amd64.deb"))
+}
+
+func TestListEmptyPrefixErrors(t *testing.T) {
+	f := newFakeS3()
+	f.ListErrs = map[string]error{
+		"darwin/":             awserr.New(request.ErrCodeSerialization, "failed to decode REST XML response", io.EOF),
+		"windows/":            awserr.New(s3.ErrCodeNoSuchKey, "The specified key does not exist.", nil),
+		"linux_binaries/deb/": awserr.New("AccessDenied", "Access Denied", nil),
+	}
+	c := newTestClient(f)
+
+	releases, err := c.ListReleases(testBucket, "darwin/", "")
+	require.NoError(t, err)
+	assert.Empty(t, releases)
+	release, err := c.findRelease(testBucket, platformWindows, func(r Release) bool { return true })
+	require.NoError(t, err)
+	assert.Nil(t, release)
+
+	// Genuine errors still fail
+	_, err = c.ListReleases(testBucket, "linux_binaries/deb/", "")
+	require.Error(t, err)
+}
+
+func TestFindReleaseDarwinIgnoresNonDMG(t *testing.T) {
+	f := newFakeS3()
+	f.Put(testBucket, "darwin/Keybase-1.0.14-20160312013917+cd6f696.dmg", "dmg", time.Now())
+	f.Put(testBucket, "darwin/Keybase-1.0.15-20160313013917+ab12cd3.zip", "zip", time.Now())
+	f.Put(testBucket, "darwin/update-darwin-prod-1.0.16-20160314013917+ef01234.json", "{}", time.Now())
+	c := newTestClient(f)
+
+	release, err := c.findRelease(testBucket, platformDarwin, func(r Release) bool { return true })
+	require.NoError(t, err)
+	require.NotNil(t, release)
+	assert.Equal(t, "Keybase-1.0.14-20160312013917+cd6f696.dmg", release.Name)
+
+	releases, err := c.ListReleases(testBucket, platformDarwin.Prefix, platformDarwin.Suffix)
+	require.NoError(t, err)
+	require.Len(t, releases, 1)
+}
+
+func TestCopyLatestForPlatform(t *testing.T) {
+	f := newFakeS3()
+	f.Put(testBucket, "linux_binaries/deb/keybase_1.0.15-20160313013917.ab12cd3_amd64.deb", "deb", time.Now())
+	f.Put(testBucket, "linux_binaries/rpm/keybase-1.0.15-20160313013917.ab12cd3.x86_64.rpm", "rpm", time.Now())
+	c := newTestClient(f)
+
+	require.NoError(t, c.CopyLatestForPlatform(testBucket, "rpm"))
+	assert.NotNil(t, f.Get(testBucket, "keybase_amd64.rpm"))
+	assert.Nil(t, f.Get(testBucket, "keybase_amd64.deb"))
+
+	require.EqualError(t, c.CopyLatestForPlatform(testBucket, "linux"), `Platform "linux" is not a single platform`)
+	require.EqualError(t, c.CopyLatestForPlatform(testBucket, ""), `Platform "" is not a single platform`)
+	require.EqualError(t, c.CopyLatestForPlatform(testBucket, "beos"), "Invalid platform beos")
+
+	// Variants are copied too
+	rpmArm64 := Platform{Name: "rpm-arm64", Prefix: "linux_binaries/rpm-arm64/", Suffix: ".aarch64.rpm", LatestName: "keybase_arm64.rpm", Arch: ArchARM64}
+	c.PlatformVariants = map[string][]Platform{"rpm": {rpmArm64}}
+	c.StrictCopyLatest = true
+	require.EqualError(t, c.CopyLatestForPlatform(testBucket, "rpm"), "No release found for rpm-arm64")
+	f.Put(testBucket, "linux_binaries/rpm-arm64/keybase-1.0.15-20160313013917.ab12cd3.aarch64.rpm", "arm64", time.Now())
+	require.NoError(t, c.CopyLatestForPlatform(testBucket, "rpm"))
+	assert.Equal(t, "arm64", string(f.Get(testBucket, "keybase_arm64.rpm").Body))
+}
+
+func TestPublicBaseURL(t *testing.T) {
+	f := newFakeS3()
+	f.Put(testBucket, "darwin/Keybase-1.0.15-20160313013917+ab12cd3.dmg", "dmg", time.Now())
+	c := newTestClient(f)
+
+	releases, err := c.ListReleases(testBucket, "darwin/", "")
+	require.NoError(t, err)
+	require.Len(t, releases, 1)
+	assert.Equal(t, "https://s3.amazonaws.com/test-bucket/darwin/Keybase-1.0.15-20160313013917%2Bab12cd3.dmg", releases[0].URL)
+	assert.Equal(t, "https://s3.amazonaws.com/test-bucket/Keybase.dmg", c.LatestURL(testBucket, platformDarwin))
+
+	c.PublicBaseURL = "https://downloads.example.com/"
+	releases, err = c.ListReleases(testBucket, "darwin/", "")
+	require.NoError(t, err)
+	require.Len(t, releases, 1)
+	assert.Equal(t, "https://downloads.example.com/darwin/Keybase-1.0.15-20160313013917%2Bab12cd3.dmg", releases[0].URL)
+	assert.Equal(t, "https://downloads.example.com/Keybase.dmg", c.LatestURL(testBucket, platformDarwin))
+
+	// Copies still come from S3
+	putUpdateJSON(f, testBucket, UpdateJSONName(defaultChannel, PlatformTypeDarwin, "prod"), "1.0.15-20160313013917+ab12cd3")
+	require.NoError(t, c.CopyLatest(testBucket, PlatformTypeDarwin, false))
+	assert.Equal(t, "dmg", string(f.Get(testBucket, "Keybase.dmg").Body))
+}
+
+func TestKeyVersionPattern(t *testing.T) {
+	f := newFakeS3()
+	built := time.Date(2016, 3, 13, 12, 0, 0, 0, time.UTC)
+	f.Put(testBucket, "mirror/1.2.3/Keybase.dmg", "dmg", built)
+	f.Put(testBucket, "mirror/1.2.4/Keybase.dmg", "dmg", built.Add(24*time.Hour))
+	f.Put(testBucket, "mirror/1.2.5-20160315013917+ab12cd3/Keybase.dmg", "dmg", built)
+	f.Put(testBucket, "mirror/1.2.4/index.html", "html", built)
+	c := newTestClient(f)
+
+	// Names don't have versions, and subdirectories aren't listed
+	releases, err := c.ListReleases(testBucket, "mirror/", ".dmg")
+	require.NoError(t, err)
+	assert.Empty(t, releases)
+
+	c.KeyVersionPattern = regexp.MustCompile(`^mirror/([^/]+)/`)
+	releases, err = c.ListReleases(testBucket, "mirror/", ".dmg")
+	require.NoError(t, err)
+	require.Len(t, releases, 3)
+	assert.Equal(t, "1.2.5-20160315013917+ab12cd3", releases[0].Version)
+	assert.Equal(t, "ab12cd3", releases[0].Commit)
+	assert.Equal(t, "1.2.4", releases[1].Version)
+	assert.Equal(t, "1.2.4/Keybase.dmg", releases[1].Name)
+	assert.True(t, releases[1].Date.Equal(built.Add(24*time.Hour)))
+	assert.Equal(t, "1.2.3", releases[2].Version)
+}
+
+func TestCopyLatestVersionedLatestName(t *testing.T) {
+	f := newFakeS3()
+	f.Put(testBucket, "linux_binaries/deb/keybase_1.0.15-20160313013917.ab12cd3_amd64.deb", "deb", time.Now())
+	c := newTestClient(f)
+
+	platform := platformLinuxDeb
+	platform.VersionedLatestName = "keybase_{{.Version}}_{{.Arch}}.deb"
+	require.NoError(t, platform.Validate())
+	copied, err := c.copyLatest(testBucket, platform, false)
+	require.NoError(t, err)
+	assert.True(t, copied)
+	assert.NotNil(t, f.Get(testBucket, "keybase_amd64.deb"))
+	versioned := f.Get(testBucket, "keybase_1.0.15-20160313013917+ab12cd3_amd64.deb")
+	require.NotNil(t, versioned)
+	assert.Equal(t, "deb", string(versioned.Body))
+
+	platform.VersionedLatestName = "latest/{{.Name}}"
+	copied, err = c.copyLatest(testBucket, platform, false)
+	require.NoError(t, err)
+	assert.True(t, copied)
+	assert.NotNil(t, f.Get(testBucket, "latest/keybase_1.0.15-20160313013917.ab12cd3_amd64.deb"))
+}
+
+func TestPlatformValidateVersionedLatestName(t *testing.T) {
+	platform := platformDarwin
+	platform.VersionedLatestName = "Keybase-{{.Version}}-{{.Arch}}.dmg"
+	assert.NoError(t, platform.Validate())
+	platform.VersionedLatestName = "Keybase-{{.Version}.dmg"
+	assert.Error(t, platform.Validate())
+	platform.VersionedLatestName = "Keybase-{{.Commit}}.dmg"
+	assert.Error(t, platform.Validate())
+	platform.VersionedLatestName = "Keybase-{{.Version}}.zip"
+	assert.Error(t, platform.Validate())
+}
+
+func TestSplitPrefixes(t *testing.T) {
+	assert.Equal(t, []string{"darwin/", "linux_binaries/deb/"}, splitPrefixes(" darwin/, linux_binaries/deb/ ,,darwin/,\t"))
+	assert.Equal(t, []string{"darwin/", "linux_binaries/deb/"}, splitPrefixes("darwin,darwin/,linux_binaries/deb"))
+	assert.Empty(t, splitPrefixes(" , "))
+}
+
+func TestWriteHTMLMessyPrefixes(t *testing.T) {
+	f := newFakeS3()
+	f.Put(testBucket, "darwin/Keybase-1.0.15-20160313013917+ab12cd3.dmg", "dmg", time.Now())
+	f.Put(testBucket, "linux_binaries/deb/keybase_1.0.15-20160313013917.ab12cd3_amd64.deb", "deb", time.Now())
+	c := newTestClient(f)
+
+	sections, err := c.htmlSections(testBucket, "darwin/ , linux_binaries/deb/,, darwin/", "")
+	require.NoError(t, err)
+	require.Len(t, sections, 2)
+	assert.Equal(t, "darwin/", sections[0].Header)
+	assert.Len(t, sections[0].Releases, 1)
+	assert.Equal(t, "linux_binaries/deb/", sections[1].Header)
+	assert.Len(t, sections[1].Releases, 1)
+}
+
+func TestWriteHTMLCommitLength(t *testing.T) {
+	commit := "ab12cd34ef56ab12cd34ef56ab12cd34ef56ab12"
+	sections := []Section{{Header: "darwin/", Releases: []Release{{Name: "Keybase.dmg", Version: "1.0.15", Commit: commit}}}}
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteHTMLForLinks(testBucket, sections, &buf))
+	assert.Contains(t, buf.String(), `<a href="https://github.com/keybase/client/commit/`+commit+`">ab12cd3</a>`)
+
+	buf.Reset()
+	require.NoError(t, writeHTMLForLinks(PageData{Title: testBucket, Sections: sections}, nil, 12, &buf))
+	assert.Contains(t, buf.String(), `<a href="https://github.com/keybase/client/commit/`+commit+`">ab12cd34ef56</a>`)
+
+	assert.Equal(t, "abc", shortCommit("abc", 0))
+}
+
+func TestWriteHTMLNoCommit(t *testing.T) {
+	sections := []Section{{Header: "darwin/", Releases: []Release{{Name: "Keybase.dmg", Version: "1.0.15", PreviousCommit: "ab12cd3"}}}}
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteHTMLForLinks(testBucket, sections, &buf))
+	assert.NotContains(t, buf.String(), "github.com/keybase/client")
+	assert.Contains(t, buf.String(), `<strong>1.0.15</strong>`)
+}
+
+func TestReleaseIsPrerelease(t *testing.T) {
+	assert.False(t, Release{Version: "1.0.15-20160313013917+ab12cd3"}.IsPrerelease())
+	assert.False(t, Release{Version: "1.0.15"}.IsPrerelease())
+	assert.True(t, Release{Version: "1.0.16-beta.1+ab12cd3"}.IsPrerelease())
+	assert.True(t, Release{Version: "1.0.16-rc1"}.IsPrerelease())
+	assert.False(t, Release{Version: "invalid"}.IsPrerelease())
+}
+
+func TestCopyLatestSkipsPrereleases(t *testing.T) {
+	f := newFakeS3()
+	now := time.Now()
+	f.Put(testBucket, "linux_binaries/deb/keybase_1.0.15-20160313013917.ab12cd3_amd64.deb", "stable", now.Add(-time.Hour))
+	f.Put(testBucket, "linux_binaries/deb/keybase_1.0.16-20160314013917.ef01234_amd64.deb", "beta", now)
+	f.Put(testBucket, "linux_binaries/deb/keybase_1.0.16-20160314013917.ef01234_amd64.deb.meta.json", `{"version": "1.0.16-beta.1+ef01234"}`, now)
+	c := newTestClient(f)
+	c.MetaSidecars = true
+
+	copied, err := c.copyLatest(testBucket, platformLinuxDeb, false)
+	require.NoError(t, err)
+	assert.True(t, copied)
+	assert.Equal(t, "stable", string(f.Get(testBucket, "keybase_amd64.deb").Body))
+
+	c.CopyLatestPrereleases = true
+	copied, err = c.copyLatest(testBucket, platformLinuxDeb, false)
+	require.NoError(t, err)
+	assert.True(t, copied)
+	assert.Equal(t, "beta", string(f.Get(testBucket, "keybase_amd64.deb").Body))
+}
+
+func TestCopyLatestStrategy(t *testing.T) {
+	f := newFakeS3()
+	// The 1.0.15 build has a skewed (newer) date
+	f.Put(testBucket, "linux_binaries/deb/keybase_1.0.15-20170101000000.ab12cd3_amd64.deb", "1.0.15", time.Now())
+	f.Put(testBucket, "linux_binaries/deb/keybase_1.0.16-20160314013917.ef01234_amd64.deb", "1.0.16", time.Now())
+	f.Put(testBucket, "linux_binaries/deb/keybase_invalid_amd64.deb", "invalid", time.Now())
+	c := newTestClient(f)
+
+	_, err := c.copyLatest(testBucket, platformLinuxDeb, false)
+	require.NoError(t, err)
+	assert.Equal(t, "1.0.15", string(f.Get(testBucket, "keybase_amd64.deb").Body))
+
+	c.LatestStrategy = BySemver
+	_, err = c.copyLatest(testBucket, platformLinuxDeb, false)
+	require.NoError(t, err)
+	assert.Equal(t, "1.0.16", string(f.Get(testBucket, "keybase_amd64.deb").Body))
+}
+
+func TestWriteHTMLAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestWriteHTMLAtomic")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	f := newFakeS3()
+	f.Put(testBucket, "darwin/Keybase-1.0.15-20160313013917+ab12cd3.dmg", "dmg", time.Now())
+	c := newTestClient(f)
+
+	// Parent dirs are made, and the index is 0644 whatever the temp file was
+	index := filepath.Join(dir, "site", "index.html")
+	require.NoError(t, c.WriteHTML(testBucket, "darwin/", "", index, ""))
+	info, err := os.Stat(index)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+
+	// The rename fails (the path is a directory that isn't empty), so the
+	// write does, leaving nothing behind
+	blocked := filepath.Join(dir, "blocked.html")
+	require.NoError(t, os.MkdirAll(filepath.Join(blocked, "keep"), 0755))
+	require.Error(t, c.WriteHTML(testBucket, "darwin/", "", blocked, ""))
+	entries, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.Equal(t, []string{"blocked.html", "site"}, names)
+	entries, err = ioutil.ReadDir(filepath.Join(dir, "site"))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	// Same for the incremental manifest
+	require.Error(t, writeHTMLManifest(blocked, HTMLManifest{}))
+	entries, err = ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
+
+func TestWriteHTMLSafeOverwrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestWriteHTMLSafeOverwrite")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	f := newFakeS3()
+	f.Put(testBucket, "darwin/Keybase-1.0.15-20160313013917+ab12cd3.dmg", "dmg", time.Now())
+	c := newTestClient(f)
+	c.SafeOverwrite = true
+
+	important := filepath.Join(dir, "important.txt")
+	require.NoError(t, ioutil.WriteFile(important, []byte("important"), 0644))
+	require.EqualError(t, c.WriteHTML(testBucket, "darwin/", "", important, ""), "Not overwriting "+important+", it isn't a generated index")
+	data, err := ioutil.ReadFile(important)
+	require.NoError(t, err)
+	assert.Equal(t, "important", string(data))
+
+	// New and previously generated files are written
+	index := filepath.Join(dir, "index.html")
+	require.NoError(t, c.WriteHTML(testBucket, "darwin/", "", index, ""))
+	require.NoError(t, c.WriteHTML(testBucket, "darwin/", "", index, ""))
+	data, err = ioutil.ReadFile(index)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), htmlMarker)
+	info, err := os.Stat(index)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+
+	// No temp files are left
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, files, 2)
+}
+
+func TestWriteHTMLPartialFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestWriteHTMLPartialFailure")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	f := newFakeS3()
+	f.Put(testBucket, "darwin/Keybase-1.0.15-20160313013917+ab12cd3.dmg", "dmg", time.Now())
+	f.ListErrs = map[string]error{"windows/": awserr.New("AccessDenied", "Access Denied", nil)}
+	c := newTestClient(f)
+
+	index := filepath.Join(dir, "index.html")
+	err = c.WriteHTML(testBucket, "windows/,darwin/", "", index, "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Error listing windows/")
+	data, err := ioutil.ReadFile(index)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "1.0.15-20160313013917+ab12cd3")
+	assert.NotContains(t, string(data), "<h3>windows/</h3>")
+
+	// Nothing is written if every prefix fails
+	require.NoError(t, os.Remove(index))
+	require.Error(t, c.WriteHTML(testBucket, "windows/", "", index, ""))
+	_, err = os.Stat(index)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestListReleasesPreviousVersion(t *testing.T) {
+	f := newFakeS3()
+	f.Put(testBucket, "darwin/Keybase-1.0.14-20160312013917+cd6f696.dmg", "dmg", time.Now())
+	f.Put(testBucket, "darwin/Keybase-1.0.16-20160314013917+ef01234.dmg", "dmg", time.Now())
+	f.Put(testBucket, "darwin/Keybase-1.0.15-20160313013917+ab12cd3.dmg", "dmg", time.Now())
+	c := newTestClient(f)
+
+	releases, err := c.ListReleases(testBucket, "darwin/", "")
+	require.NoError(t, err)
+	require.Len(t, releases, 3)
+	assert.Equal(t, "1.0.15-20160313013917+ab12cd3", releases[0].PreviousVersion)
+	assert.Equal(t, "ab12cd3", releases[0].PreviousCommit)
+	assert.Equal(t, "1.0.14-20160312013917+cd6f696", releases[1].PreviousVersion)
+	assert.Equal(t, "cd6f696", releases[1].PreviousCommit)
+	assert.Equal(t, "", releases[2].PreviousVersion)
+	assert.Equal(t, "", releases[2].PreviousCommit)
+
+	// The predecessor is linked before truncating
+	releases, err = c.listReleases(testBucket, "darwin/", "", 2)
+	require.NoError(t, err)
+	require.Len(t, releases, 2)
+	assert.Equal(t, "1.0.14-20160312013917+cd6f696", releases[1].PreviousVersion)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteHTMLForLinks(testBucket, []Section{{Header: "darwin/", Releases: releases}}, &buf))
+	assert.Contains(t, buf.String(), `<a href="https://github.com/keybase/client/compare/ab12cd3...ef01234">diff</a>`)
+}
+
+func TestRegionURLs(t *testing.T) {
+	f := newFakeS3()
+	f.Put(testBucket, "darwin/Keybase-1.0.15-20160313013917+ab12cd3.dmg", "dmg", time.Now())
+	f.Put("prerelease.example.com", "darwin/Keybase-1.0.15-20160313013917+ab12cd3.dmg", "dmg", time.Now())
+	c := newTestClient(f)
+
+	for region, expected := range map[string]string{
+		"":          "https://s3.amazonaws.com/" + testBucket + "/darwin/Keybase-1.0.15-20160313013917%2Bab12cd3.dmg",
+		"us-east-1": "https://s3.amazonaws.com/" + testBucket + "/darwin/Keybase-1.0.15-20160313013917%2Bab12cd3.dmg",
+		"eu-west-1": "https://" + testBucket + ".s3.eu-west-1.amazonaws.com/darwin/Keybase-1.0.15-20160313013917%2Bab12cd3.dmg",
+		"us-west-2": "https://" + testBucket + ".s3.us-west-2.amazonaws.com/darwin/Keybase-1.0.15-20160313013917%2Bab12cd3.dmg",
+	} {
+		c.Region = region
+		releases, err := c.ListReleases(testBucket, "darwin/", "")
+		require.NoError(t, err)
+		require.Len(t, releases, 1)
+		assert.Equal(t, expected, releases[0].URL, region)
+	}
+
+	// Dots in the bucket name need path-style
+	c.Region = "eu-west-1"
+	releases, err := c.ListReleases("prerelease.example.com", "darwin/", "")
+	require.NoError(t, err)
+	require.Len(t, releases, 1)
+	assert.Equal(t, "https://s3.eu-west-1.amazonaws.com/prerelease.example.com/darwin/Keybase-1.0.15-20160313013917%2Bab12cd3.dmg", releases[0].URL)
+	assert.Equal(t, "https://"+testBucket+".s3.eu-west-1.amazonaws.com/Keybase.dmg", c.LatestURL(testBucket, platformDarwin))
+
+	// Copies still work, with path-style sources
+	putUpdateJSON(f, testBucket, UpdateJSONName(defaultChannel, PlatformTypeDarwin, "prod"), "1.0.15-20160313013917+ab12cd3")
+	require.NoError(t, c.CopyLatest(testBucket, PlatformTypeDarwin, false))
+	assert.NotNil(t, f.Get(testBucket, "Keybase.dmg"))
+}
+
+func TestWriteHTMLTemplateData(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestWriteHTMLTemplateData")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	tmpl := filepath.Join(dir, "index.tmpl")
+	require.NoError(t, ioutil.WriteFile(tmpl, []byte(`<img src="{{ .Logo }}"> {{ .Title }}
+{{ range .Sections }}{{ range .Releases }}{{ .Version }}
+{{ end }}{{ end }}<a href="{{ .Support }}">Support</a>`), 0644))
+
+	f := newFakeS3()
+	f.Put(testBucket, "darwin/Keybase-1.0.15-20160313013917+ab12cd3.dmg", "dmg", time.Now())
+	c := newTestClient(f)
+	c.TemplateData = map[string]interface{}{
+		"Logo":    "https://keybase.io/logo.png",
+		"Support": "https://keybase.io/support",
+	}
+	outPath := filepath.Join(dir, "index.html")
+	require.NoError(t, c.WriteHTMLOutputs(testBucket, "darwin/", "", []HTMLOutput{{Path: outPath, TemplatePath: tmpl}}))
+	out, err := ioutil.ReadFile(outPath)
+	require.NoError(t, err)
+	assert.Equal(t, `<img src="https://keybase.io/logo.png"> `+testBucket+`
+1.0.15-20160313013917+ab12cd3
+<a href="https://keybase.io/support">Support</a>`, string(out))
+
+	// Extra data can't replace the reserved fields
+	c.TemplateData = map[string]interface{}{"Title": "Other"}
+	err = c.WriteHTMLOutputs(testBucket, "darwin/", "", []HTMLOutput{{Path: outPath, TemplatePath: tmpl}})
+	require.EqualError(t, err, `Template data "Title" is reserved`)
+
+	var buf bytes.Buffer
+	err = WriteHTMLForLinksWithData(testBucket, nil, map[string]interface{}{"Sections": nil}, &buf)
+	require.EqualError(t, err, `Template data "Sections" is reserved`)
+	require.NoError(t, WriteHTMLForLinksWithData(testBucket, nil, map[string]interface{}{"Logo": "x"}, &buf))
+}
@@ -0,0 +1,426 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+// Package s3test is an in-memory S3 bucket with the calls an update.Client
+// makes, for the update package's tests and the updatetest harness. It
+// doesn't import update, so update's own tests can use it.
+package s3test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// allUsersGroup is the grantee for anonymous access
+const allUsersGroup = "http://acs.amazonaws.com/groups/global/AllUsers"
+
+// Object is an object in a Bucket
+type Object struct {
+	Body               []byte
+	LastModified       time.Time
+	ACL                string
+	CacheControl       string
+	ContentType        string
+	ContentDisposition string
+	Metadata           map[string]string
+	WebsiteRedirect    string
+}
+
+// ETag is the ETag S3 returns for the object, its body's quoted MD5
+func (o *Object) ETag() string {
+	sum := md5.Sum(o.Body)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// Version is a version of a key, in a bucket with versioning
+type Version struct {
+	ID           string
+	Body         string
+	LastModified time.Time
+	DeleteMarker bool
+}
+
+// Bucket is an in-memory S3 store, with the calls an update.Client makes.
+// Objects are keyed by bucket and key, so one Bucket can hold several S3
+// buckets. The fields other than Now are for simulating S3's failures and
+// quirks; hold the lock to change them once the Bucket is in use.
+type Bucket struct {
+	sync.Mutex
+	objects map[string]*Object
+	// Now is the time objects are modified at, time.Now if nil
+	Now func() time.Time
+	// PageSize is the most keys a listing returns, if MaxKeys isn't less
+	PageSize int
+	// OmitNextMarker leaves NextMarker out of truncated listings
+	OmitNextMarker bool
+	// ListCalls is how many listings there have been
+	ListCalls int
+	// ListErrs are errors to return for listing a prefix
+	ListErrs map[string]error
+	// GetErrs are errors to return for GETs of a key
+	GetErrs map[string]error
+	// GetBodies are bodies to return for the next GETs of a key, instead of
+	// the object, to simulate eventual consistency
+	GetBodies map[string][]string
+	// CorruptCopies is how many of the next copies to a key write garbage
+	CorruptCopies map[string]int
+	// ObjectVersions are the versions of keys, in a bucket with versioning
+	ObjectVersions map[string][]Version
+	// VersionsNotImplemented is a store without ListObjectVersions
+	VersionsNotImplemented bool
+	// HeadLatency is how long HEADs take
+	HeadLatency time.Duration
+}
+
+// NewBucket returns an empty Bucket
+func NewBucket() *Bucket {
+	return &Bucket{objects: map[string]*Object{}}
+}
+
+func objectKey(bucketName string, key string) string {
+	return bucketName + "/" + key
+}
+
+func (b *Bucket) now() time.Time {
+	if b.Now != nil {
+		return b.Now()
+	}
+	return time.Now()
+}
+
+func noSuchKey(key string) error {
+	return awserr.New(s3.ErrCodeNoSuchKey, fmt.Sprintf("The specified key does not exist: %s", key), nil)
+}
+
+func preconditionFailed() error {
+	return awserr.New("PreconditionFailed", "At least one of the pre-conditions you specified did not hold", nil)
+}
+
+// Put sets an object
+func (b *Bucket) Put(bucketName string, key string, body string, lastModified time.Time) {
+	b.SetObject(bucketName, key, &Object{Body: []byte(body), LastModified: lastModified})
+}
+
+// SetObject sets an object, with its headers
+func (b *Bucket) SetObject(bucketName string, key string, obj *Object) {
+	b.Lock()
+	defer b.Unlock()
+	b.objects[objectKey(bucketName, key)] = obj
+}
+
+// Get returns an object, or nil if there isn't one
+func (b *Bucket) Get(bucketName string, key string) *Object {
+	b.Lock()
+	defer b.Unlock()
+	return b.objects[objectKey(bucketName, key)]
+}
+
+// Delete removes an object, if there is one
+func (b *Bucket) Delete(bucketName string, key string) {
+	b.Lock()
+	defer b.Unlock()
+	delete(b.objects, objectKey(bucketName, key))
+}
+
+// Keys returns the keys in a bucket, sorted
+func (b *Bucket) Keys(bucketName string) []string {
+	b.Lock()
+	defer b.Unlock()
+	return b.keys(bucketName, "")
+}
+
+func (b *Bucket) keys(bucketName string, prefix string) []string {
+	var keys []string
+	for k := range b.objects {
+		if strings.HasPrefix(k, objectKey(bucketName, prefix)) {
+			keys = append(keys, strings.TrimPrefix(k, bucketName+"/"))
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ListObjects lists keys at a prefix, a page at a time. Like S3, truncated
+// listings only have a NextMarker if there's a delimiter.
+func (b *Bucket) ListObjects(input *s3.ListObjectsInput) (*s3.ListObjectsOutput, error) {
+	b.Lock()
+	defer b.Unlock()
+	b.ListCalls++
+	prefix := aws.StringValue(input.Prefix)
+	delimiter := aws.StringValue(input.Delimiter)
+	marker := aws.StringValue(input.Marker)
+	if err := b.ListErrs[prefix]; err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, key := range b.keys(*input.Bucket, prefix) {
+		if key <= marker {
+			continue
+		}
+		if delimiter != "" && strings.Contains(strings.TrimPrefix(key, prefix), delimiter) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+
+	pageSize := b.PageSize
+	if input.MaxKeys != nil && *input.MaxKeys > 0 && (pageSize == 0 || int(*input.MaxKeys) < pageSize) {
+		pageSize = int(*input.MaxKeys)
+	}
+	truncated := false
+	if pageSize > 0 && len(keys) > pageSize {
+		keys = keys[:pageSize]
+		truncated = true
+	}
+	out := &s3.ListObjectsOutput{IsTruncated: aws.Bool(truncated)}
+	for _, key := range keys {
+		obj := b.objects[objectKey(*input.Bucket, key)]
+		out.Contents = append(out.Contents, &s3.Object{
+			Key:          aws.String(key),
+			LastModified: aws.Time(obj.LastModified),
+			Size:         aws.Int64(int64(len(obj.Body))),
+			ETag:         aws.String(obj.ETag()),
+		})
+	}
+	if truncated && delimiter != "" && !b.OmitNextMarker {
+		out.NextMarker = aws.String(keys[len(keys)-1])
+	}
+	return out, nil
+}
+
+// GetObject returns an object's body, or a version's. An IfMatch that isn't
+// the object's ETag fails with PreconditionFailed.
+func (b *Bucket) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	b.Lock()
+	defer b.Unlock()
+	if err := b.GetErrs[*input.Key]; err != nil {
+		return nil, err
+	}
+	if bodies := b.GetBodies[*input.Key]; len(bodies) > 0 {
+		b.GetBodies[*input.Key] = bodies[1:]
+		return &s3.GetObjectOutput{Body: ioutil.NopCloser(strings.NewReader(bodies[0]))}, nil
+	}
+	if input.VersionId != nil {
+		for _, v := range b.ObjectVersions[*input.Key] {
+			if v.ID == *input.VersionId && !v.DeleteMarker {
+				return &s3.GetObjectOutput{Body: ioutil.NopCloser(strings.NewReader(v.Body))}, nil
+			}
+		}
+		return nil, awserr.New("NoSuchVersion", "The specified version does not exist.", nil)
+	}
+	obj := b.objects[objectKey(*input.Bucket, *input.Key)]
+	if obj == nil {
+		return nil, noSuchKey(*input.Key)
+	}
+	if ifMatch := aws.StringValue(input.IfMatch); ifMatch != "" && ifMatch != obj.ETag() {
+		return nil, preconditionFailed()
+	}
+	return &s3.GetObjectOutput{
+		Body:          ioutil.NopCloser(bytes.NewReader(obj.Body)),
+		ContentLength: aws.Int64(int64(len(obj.Body))),
+		LastModified:  aws.Time(obj.LastModified),
+		ContentType:   aws.String(obj.ContentType),
+		ETag:          aws.String(obj.ETag()),
+	}, nil
+}
+
+// PutObject sets an object
+func (b *Bucket) PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	body, err := ioutil.ReadAll(input.Body)
+	if err != nil {
+		return nil, err
+	}
+	b.Lock()
+	defer b.Unlock()
+	b.objects[objectKey(*input.Bucket, *input.Key)] = &Object{
+		Body:         body,
+		LastModified: b.now(),
+		ACL:          aws.StringValue(input.ACL),
+		CacheControl: aws.StringValue(input.CacheControl),
+		ContentType:  aws.StringValue(input.ContentType),
+		Metadata:     aws.StringValueMap(input.Metadata),
+	}
+	return &s3.PutObjectOutput{}, nil
+}
+
+// PutObjectWithContext is PutObject, supporting If-None-Match: *
+func (b *Bucket) PutObjectWithContext(ctx aws.Context, input *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error) {
+	req := &request.Request{HTTPRequest: &http.Request{Header: http.Header{}}}
+	for _, opt := range opts {
+		opt(req)
+	}
+	if req.HTTPRequest.Header.Get("If-None-Match") == "*" && b.Get(*input.Bucket, *input.Key) != nil {
+		return nil, preconditionFailed()
+	}
+	return b.PutObject(input)
+}
+
+// copySourceKey parses a copy source, either as bucket/key or as the
+// https://s3.amazonaws.com/bucket/key form the update package uses
+func copySourceKey(source string) (string, error) {
+	source = strings.TrimPrefix(source, "https://s3.amazonaws.com/")
+	return url.QueryUnescape(source)
+}
+
+// CopyObject copies an object. A CopySourceIfMatch that isn't the source's
+// ETag fails with PreconditionFailed. The headers and user metadata are the
+// source's, unless the MetadataDirective is REPLACE.
+func (b *Bucket) CopyObject(input *s3.CopyObjectInput) (*s3.CopyObjectOutput, error) {
+	source, err := copySourceKey(*input.CopySource)
+	if err != nil {
+		return nil, err
+	}
+	b.Lock()
+	defer b.Unlock()
+	obj := b.objects[source]
+	if obj == nil {
+		return nil, noSuchKey(source)
+	}
+	if ifMatch := aws.StringValue(input.CopySourceIfMatch); ifMatch != "" && ifMatch != obj.ETag() {
+		return nil, preconditionFailed()
+	}
+	copied := &Object{
+		Body:               obj.Body,
+		LastModified:       b.now(),
+		ACL:                aws.StringValue(input.ACL),
+		CacheControl:       aws.StringValue(input.CacheControl),
+		ContentType:        obj.ContentType,
+		ContentDisposition: obj.ContentDisposition,
+		Metadata:           obj.Metadata,
+	}
+	if aws.StringValue(input.MetadataDirective) == s3.MetadataDirectiveReplace {
+		copied.ContentType = aws.StringValue(input.ContentType)
+		copied.ContentDisposition = aws.StringValue(input.ContentDisposition)
+		copied.Metadata = aws.StringValueMap(input.Metadata)
+	}
+	if b.CorruptCopies[*input.Key] > 0 {
+		b.CorruptCopies[*input.Key]--
+		copied.Body = []byte("garbage")
+	}
+	b.objects[objectKey(*input.Bucket, *input.Key)] = copied
+	return &s3.CopyObjectOutput{}, nil
+}
+
+// DeleteObject removes an object
+func (b *Bucket) DeleteObject(input *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error) {
+	b.Delete(*input.Bucket, *input.Key)
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+// HeadObject returns an object's size and headers
+func (b *Bucket) HeadObject(input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+	b.Lock()
+	latency := b.HeadLatency
+	b.Unlock()
+	time.Sleep(latency)
+	obj := b.Get(*input.Bucket, *input.Key)
+	if obj == nil {
+		return nil, awserr.New("NotFound", "Not Found", nil)
+	}
+	return &s3.HeadObjectOutput{
+		ContentLength:           aws.Int64(int64(len(obj.Body))),
+		ETag:                    aws.String(obj.ETag()),
+		LastModified:            aws.Time(obj.LastModified),
+		CacheControl:            aws.String(obj.CacheControl),
+		ContentType:             aws.String(obj.ContentType),
+		ContentDisposition:      aws.String(obj.ContentDisposition),
+		Metadata:                aws.StringMap(obj.Metadata),
+		WebsiteRedirectLocation: aws.String(obj.WebsiteRedirect),
+	}, nil
+}
+
+// GetObjectAcl returns an AllUsers read grant for public-read objects
+func (b *Bucket) GetObjectAcl(input *s3.GetObjectAclInput) (*s3.GetObjectAclOutput, error) {
+	obj := b.Get(*input.Bucket, *input.Key)
+	if obj == nil {
+		return nil, noSuchKey(*input.Key)
+	}
+	out := &s3.GetObjectAclOutput{}
+	if obj.ACL == s3.ObjectCannedACLPublicRead {
+		out.Grants = append(out.Grants, &s3.Grant{
+			Grantee:    &s3.Grantee{Type: aws.String(s3.TypeGroup), URI: aws.String(allUsersGroup)},
+			Permission: aws.String(s3.PermissionRead),
+		})
+	}
+	return out, nil
+}
+
+// PutObjectAcl sets a canned ACL
+func (b *Bucket) PutObjectAcl(input *s3.PutObjectAclInput) (*s3.PutObjectAclOutput, error) {
+	b.Lock()
+	defer b.Unlock()
+	obj := b.objects[objectKey(*input.Bucket, *input.Key)]
+	if obj == nil {
+		return nil, noSuchKey(*input.Key)
+	}
+	obj.ACL = aws.StringValue(input.ACL)
+	return &s3.PutObjectAclOutput{}, nil
+}
+
+// ListObjectVersions lists the versions of the keys at a prefix. A key
+// without ObjectVersions has the one null version, as in an unversioned
+// bucket.
+func (b *Bucket) ListObjectVersions(input *s3.ListObjectVersionsInput) (*s3.ListObjectVersionsOutput, error) {
+	b.Lock()
+	defer b.Unlock()
+	if b.VersionsNotImplemented {
+		return nil, awserr.New("NotImplemented", "A header you provided implies functionality that is not implemented", nil)
+	}
+	prefix := aws.StringValue(input.Prefix)
+	out := &s3.ListObjectVersionsOutput{IsTruncated: aws.Bool(false)}
+	keys := b.keys(*input.Bucket, prefix)
+	for k := range b.ObjectVersions {
+		if strings.HasPrefix(k, prefix) && b.objects[objectKey(*input.Bucket, k)] == nil {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		versions, ok := b.ObjectVersions[key]
+		if !ok {
+			obj := b.objects[objectKey(*input.Bucket, key)]
+			out.Versions = append(out.Versions, &s3.ObjectVersion{
+				Key:          aws.String(key),
+				VersionId:    aws.String("null"),
+				IsLatest:     aws.Bool(true),
+				LastModified: aws.Time(obj.LastModified),
+				Size:         aws.Int64(int64(len(obj.Body))),
+			})
+			continue
+		}
+		for i, v := range versions {
+			isLatest := i == len(versions)-1
+			if v.DeleteMarker {
+				out.DeleteMarkers = append(out.DeleteMarkers, &s3.DeleteMarkerEntry{
+					Key:          aws.String(key),
+					VersionId:    aws.String(v.ID),
+					IsLatest:     aws.Bool(isLatest),
+					LastModified: aws.Time(v.LastModified),
+				})
+				continue
+			}
+			out.Versions = append(out.Versions, &s3.ObjectVersion{
+				Key:          aws.String(key),
+				VersionId:    aws.String(v.ID),
+				IsLatest:     aws.Bool(isLatest),
+				LastModified: aws.Time(v.LastModified),
+				Size:         aws.Int64(int64(len(v.Body))),
+			})
+		}
+	}
+	return out, nil
+}
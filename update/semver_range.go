@@ -0,0 +1,97 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/blang/semver"
+)
+
+// expandRangeTerm rewrites the caret (^1.4.0) and wildcard (2.x, 1.4.x) forms,
+// which semver.ParseRange doesn't support, as comparisons
+func expandRangeTerm(term string) (string, error) {
+	if strings.HasPrefix(term, "^") {
+		v, err := semver.Parse(strings.TrimPrefix(term, "^"))
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case v.Major > 0:
+			return fmt.Sprintf(">=%s <%d.0.0", v, v.Major+1), nil
+		case v.Minor > 0:
+			return fmt.Sprintf(">=%s <0.%d.0", v, v.Minor+1), nil
+		default:
+			return fmt.Sprintf(">=%s <0.0.%d", v, v.Patch+1), nil
+		}
+	}
+
+	parts := strings.Split(term, ".")
+	if len(parts) > 3 || (parts[len(parts)-1] != "x" && parts[len(parts)-1] != "*") {
+		return term, nil
+	}
+	var nums []uint64
+	for _, part := range parts {
+		if part == "x" || part == "*" {
+			break
+		}
+		n, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("Invalid wildcard %q", term)
+		}
+		nums = append(nums, n)
+	}
+	switch len(nums) {
+	case 0:
+		return ">=0.0.0", nil
+	case 1:
+		return fmt.Sprintf(">=%d.0.0 <%d.0.0", nums[0], nums[0]+1), nil
+	default:
+		return fmt.Sprintf(">=%d.%d.0 <%d.%d.0", nums[0], nums[1], nums[0], nums[1]+1), nil
+	}
+}
+
+// parseRange parses a semver range, also allowing caret and wildcard terms
+func parseRange(expr string) (semver.Range, error) {
+	var terms []string
+	for _, term := range strings.Fields(expr) {
+		expanded, err := expandRangeTerm(term)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid range %q: %s", expr, err)
+		}
+		terms = append(terms, expanded)
+	}
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("Invalid range %q: empty", expr)
+	}
+	r, err := semver.ParseRange(strings.Join(terms, " "))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid range %q: %s", expr, err)
+	}
+	return r, nil
+}
+
+// FindReleaseInRange returns the newest release for a platform whose version
+// is in a semver range, for example "^1.4.0", "2.x" or ">=1.4.0 <1.6.0". Our
+// versions have the build date as a pre-release, so only major.minor.patch is
+// compared: 1.4.0-20160313013917+ab12cd3 is in ">=1.4.0".
+func (c *Client) FindReleaseInRange(bucketName string, platformName string, rangeExpr string) (*Release, error) {
+	inRange, err := parseRange(rangeExpr)
+	if err != nil {
+		return nil, err
+	}
+	platform, err := platformForName(platformName)
+	if err != nil {
+		return nil, err
+	}
+	return c.findRelease(bucketName, platform, func(r Release) bool {
+		v, err := semver.Make(r.Version)
+		if err != nil {
+			return false
+		}
+		return inRange(semver.Version{Major: v.Major, Minor: v.Minor, Patch: v.Patch})
+	})
+}
@@ -0,0 +1,68 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"testing"
+	"time"
+
+	"github.com/blang/semver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRange(t *testing.T) {
+	cases := []struct {
+		expr    string
+		in, out []string
+	}{
+		{"^1.4.0", []string{"1.4.0", "1.9.2"}, []string{"1.3.9", "2.0.0"}},
+		{"^0.4.1", []string{"0.4.1", "0.4.9"}, []string{"0.5.0"}},
+		{"2.x", []string{"2.0.0", "2.7.1"}, []string{"1.9.9", "3.0.0"}},
+		{"1.4.x", []string{"1.4.0", "1.4.9"}, []string{"1.5.0"}},
+		{">=1.4.0 <1.6.0", []string{"1.5.3"}, []string{"1.6.0"}},
+		{"1.x || ^3.1.0", []string{"1.2.0", "3.2.0"}, []string{"2.0.0"}},
+	}
+	for _, c := range cases {
+		r, err := parseRange(c.expr)
+		require.NoError(t, err, c.expr)
+		for _, v := range c.in {
+			assert.True(t, r(semver.MustParse(v)), "%s in %s", v, c.expr)
+		}
+		for _, v := range c.out {
+			assert.False(t, r(semver.MustParse(v)), "%s not in %s", v, c.expr)
+		}
+	}
+
+	for _, expr := range []string{"", "^abc", "1.y.x", ">=one"} {
+		_, err := parseRange(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestFindReleaseInRange(t *testing.T) {
+	f := newFakeS3()
+	f.Put(testBucket, "darwin/Keybase-1.4.2-20160311013917+aaaaaaa.dmg", "dmg", time.Now())
+	f.Put(testBucket, "darwin/Keybase-1.5.0-20160312013917+bbbbbbb.dmg", "dmg", time.Now())
+	f.Put(testBucket, "darwin/Keybase-2.0.0-20160313013917+ccccccc.dmg", "dmg", time.Now())
+	c := newTestClient(f)
+
+	release, err := c.FindReleaseInRange(testBucket, PlatformTypeDarwin, "^1.4.0")
+	require.NoError(t, err)
+	require.NotNil(t, release)
+	assert.Equal(t, "1.5.0-20160312013917+bbbbbbb", release.Version)
+
+	release, err = c.FindReleaseInRange(testBucket, PlatformTypeDarwin, "1.4.x")
+	require.NoError(t, err)
+	require.NotNil(t, release)
+	assert.Equal(t, "1.4.2-20160311013917+aaaaaaa", release.Version)
+
+	release, err = c.FindReleaseInRange(testBucket, PlatformTypeDarwin, "3.x")
+	require.NoError(t, err)
+	assert.Nil(t, release)
+
+	_, err = c.FindReleaseInRange(testBucket, PlatformTypeDarwin, "^not-a-version")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Invalid range")
+}
@@ -0,0 +1,78 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const metaSidecarSuffix = ".meta.json"
+
+// releaseMeta is the sidecar manifest (<name>.meta.json) uploaded next to an
+// artifact by the build pipeline.
+type releaseMeta struct {
+	Version string    `json:"version"`
+	Commit  string    `json:"commit"`
+	BuiltAt time.Time `json:"builtAt"`
+}
+
+func (c *Client) getReleaseMeta(bucketName string, key string) (*releaseMeta, error) {
+	resp, err := c.svc.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var meta releaseMeta
+	if err := json.NewDecoder(resp.Body).Decode(&meta); err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+// applyMeta overrides the name-parsed fields of a release with those set in
+// the sidecar.
+func (r *Release) applyMeta(meta releaseMeta) {
+	if meta.Version != "" {
+		r.Version = meta.Version
+	}
+	if meta.Commit != "" {
+		r.Commit = meta.Commit
+	}
+	if !meta.BuiltAt.IsZero() {
+		r.Date = convertEastern(meta.BuiltAt)
+		r.DateString = r.Date.Format(releaseDateFormat)
+	}
+}
+
+// applyMetaSidecars updates releases from their sidecars, for those releases
+// that have one in the listing. Releases without a sidecar (or with one we
+// can't read) keep what was parsed from the name.
+func (c *Client) applyMetaSidecars(bucketName string, objs []*s3.Object, releases []Release) {
+	keys := map[string]bool{}
+	for _, obj := range objs {
+		keys[*obj.Key] = true
+	}
+
+	c.enrichReleases(releases, func(r *Release) {
+		sidecarKey := r.Key + metaSidecarSuffix
+		if !keys[sidecarKey] {
+			return
+		}
+		var meta *releaseMeta
+		var err error
+		c.limitFetch(func() { meta, err = c.getReleaseMeta(bucketName, sidecarKey) })
+		if err != nil {
+			c.logf(VerbosityQuiet, "Couldn't read %s, using name for version: %s", sidecarKey, err)
+			return
+		}
+		r.applyMeta(*meta)
+	})
+}
@@ -0,0 +1,43 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListReleasesMetaSidecars(t *testing.T) {
+	f := newFakeS3()
+	bucket := "test-bucket"
+	now := time.Now()
+	f.Put(bucket, "darwin/Keybase-1.0.14-20160312013917+cd6f696.dmg", "", now)
+	f.Put(bucket, "darwin/Keybase-renamed.dmg", "", now)
+	f.Put(bucket, "darwin/Keybase-renamed.dmg.meta.json", `{"version": "1.0.15-20160313000000+ab12cd3", "commit": "ab12cd3", "builtAt": "2016-03-13T00:00:00Z"}`, now)
+
+	client := newTestClient(f)
+	client.MetaSidecars = true
+	releases, err := client.listReleases(bucket, "darwin/", "", 0)
+	require.NoError(t, err)
+	require.Len(t, releases, 2)
+
+	assert.Equal(t, "Keybase-renamed.dmg", releases[0].Name)
+	assert.Equal(t, "1.0.15-20160313000000+ab12cd3", releases[0].Version)
+	assert.Equal(t, "ab12cd3", releases[0].Commit)
+	assert.True(t, releases[0].Date.Equal(time.Date(2016, 3, 13, 0, 0, 0, 0, time.UTC)))
+
+	assert.Equal(t, "Keybase-1.0.14-20160312013917+cd6f696.dmg", releases[1].Name)
+	assert.Equal(t, "1.0.14-20160312013917+cd6f696", releases[1].Version)
+	assert.Equal(t, "cd6f696", releases[1].Commit)
+
+	client.MetaSidecars = false
+	releases, err = client.listReleases(bucket, "darwin/", "", 0)
+	require.NoError(t, err)
+	require.Len(t, releases, 2)
+	assert.Equal(t, "1.0.14-20160312013917+cd6f696", releases[0].Version)
+	assert.Equal(t, "", releases[1].Version)
+}
@@ -0,0 +1,141 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/keybase/saltpack"
+)
+
+// assetDownloadTimeout is how long VerifyUpdateSignature waits to download an
+// asset that isn't in the bucket
+const assetDownloadTimeout = 10 * time.Minute
+
+// VerifyUpdateSignature checks that the asset of the current update for a
+// channel is signed by publicKey. The asset signature is what update-json
+// reads from --signature: a saltpack detached signature of the asset (from
+// keybase sign -d), armored or binary. The asset is read from the bucket if
+// its URL is for it, otherwise it's downloaded.
+func (c *Client) VerifyUpdateSignature(bucketName string, platformName string, env string, channel string, publicKey ed25519.PublicKey) error {
+	upd, path, err := c.CurrentUpdate(bucketName, channel, platformName, env)
+	if err != nil {
+		return fmt.Errorf("Error getting current update %s: %s", path, err)
+	}
+	if err := checkSignedUpdate(upd, publicKey); err != nil {
+		return err
+	}
+	asset, err := c.openAsset(bucketName, upd)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = asset.Close() }()
+	return verifyUpdateSignature(upd, asset, publicKey)
+}
+
+// checkSignedUpdate checks an update has what's needed to verify its
+// signature
+func checkSignedUpdate(upd *Update, publicKey ed25519.PublicKey) error {
+	if len(publicKey) != ed25519.PublicKeySize {
+		return fmt.Errorf("Invalid public key size %d", len(publicKey))
+	}
+	if upd.Asset == nil {
+		return fmt.Errorf("Update %s has no asset", upd.Version)
+	}
+	if upd.Asset.Signature == "" {
+		return fmt.Errorf("Update %s is not signed", upd.Version)
+	}
+	return nil
+}
+
+// openAsset opens an update's asset, from the bucket if its URL is for it
+func (c *Client) openAsset(bucketName string, upd *Update) (io.ReadCloser, error) {
+	assetURL := upd.Asset.URL
+	if assetURL == "" {
+		return nil, fmt.Errorf("Update %s has no asset URL", upd.Version)
+	}
+	if key, ok := c.bucketKeyForURL(bucketName, assetURL); ok {
+		resp, err := c.svc.GetObject(&s3.GetObjectInput{
+			Bucket: aws.String(bucketName),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Error getting asset %s for %s: %s", key, upd.Version, err)
+		}
+		return resp.Body, nil
+	}
+	client := &http.Client{Timeout: assetDownloadTimeout}
+	resp, err := client.Get(assetURL)
+	if err != nil {
+		return nil, fmt.Errorf("Error downloading asset %s for %s: %s", assetURL, upd.Version, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("Error downloading asset %s for %s: %s", assetURL, upd.Version, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// verifyUpdateSignature verifies an update's saltpack detached signature over
+// the asset's contents, and that the contents match the asset digest, if
+// there is one
+func verifyUpdateSignature(upd *Update, asset io.Reader, publicKey ed25519.PublicKey) error {
+	if err := checkSignedUpdate(upd, publicKey); err != nil {
+		return err
+	}
+	digest := sha256.New()
+	message := io.TeeReader(asset, digest)
+	keyring := signingKeyring{key: signingPublicKey(publicKey)}
+	sig := strings.TrimSpace(upd.Asset.Signature)
+	var err error
+	if strings.HasPrefix(sig, "BEGIN ") {
+		_, _, err = saltpack.Dearmor62VerifyDetachedReader(saltpack.CheckKnownMajorVersion, message, sig, keyring)
+	} else {
+		_, err = saltpack.VerifyDetachedReader(saltpack.CheckKnownMajorVersion, message, []byte(upd.Asset.Signature), keyring)
+	}
+	if err != nil {
+		return fmt.Errorf("Signature verification failed for %s: %s", upd.Version, err)
+	}
+	if upd.Asset.Digest != "" && hex.EncodeToString(digest.Sum(nil)) != upd.Asset.Digest {
+		return fmt.Errorf("Asset for %s doesn't match its digest %s", upd.Version, upd.Asset.Digest)
+	}
+	return nil
+}
+
+// signingPublicKey is an Ed25519 key as a saltpack signing key, whose key ID
+// is the key itself
+type signingPublicKey ed25519.PublicKey
+
+func (k signingPublicKey) ToKID() []byte {
+	return k
+}
+
+func (k signingPublicKey) Verify(message []byte, signature []byte) error {
+	if !ed25519.Verify(ed25519.PublicKey(k), message, signature) {
+		return fmt.Errorf("Bad signature")
+	}
+	return nil
+}
+
+// signingKeyring is a saltpack keyring with one signing key
+type signingKeyring struct {
+	key signingPublicKey
+}
+
+func (k signingKeyring) LookupSigningPublicKey(kid []byte) saltpack.SigningPublicKey {
+	if !bytes.Equal(kid, k.key) {
+		return nil
+	}
+	return k.key
+}
@@ -0,0 +1,90 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/keybase/release/update/s3test"
+	"github.com/stretchr/testify/require"
+)
+
+// The fixtures in testdata are an asset, its armored saltpack detached
+// signature (as keybase sign -d writes it) and the signing key
+const (
+	signedAssetVersion = "1.0.15-20160313013917+ab12cd3"
+	signedAssetFile    = "testdata/Keybase-" + signedAssetVersion + ".zip"
+	signedAssetDigest  = "4dc4d3192e819b846c66f3cde9c58b8ca6bcec2dba0c02c98306e6e3d6e0a81b"
+)
+
+func readTestdata(t *testing.T, path string) string {
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func signingKey(t *testing.T) ed25519.PublicKey {
+	key, err := hex.DecodeString(strings.TrimSpace(readTestdata(t, "testdata/signing-key.hex")))
+	require.NoError(t, err)
+	return key
+}
+
+func putSignedUpdate(t *testing.T, f *s3test.Bucket, key string, assetKey string, digest string, signature string) {
+	data, err := json.Marshal(Update{
+		Version: signedAssetVersion,
+		Asset: &Asset{
+			Name:      "Keybase.zip",
+			URL:       urlStringNoEscape(testBucket, assetKey),
+			Digest:    digest,
+			Signature: signature,
+		},
+	})
+	require.NoError(t, err)
+	f.Put(testBucket, key, string(data), time.Now())
+}
+
+func TestVerifyUpdateSignature(t *testing.T) {
+	publicKey := signingKey(t)
+	otherKey, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	sig := readTestdata(t, signedAssetFile+".sig")
+	require.True(t, strings.HasPrefix(sig, "BEGIN KEYBASE SALTPACK DETACHED SIGNATURE."))
+
+	f := newFakeS3()
+	c := newTestClient(f)
+	key := UpdateJSONName("v2", PlatformTypeDarwin, "prod")
+	assetKey := "darwin-updates/Keybase-" + signedAssetVersion + ".zip"
+	f.Put(testBucket, assetKey, readTestdata(t, signedAssetFile), time.Now())
+
+	putSignedUpdate(t, f, key, assetKey, signedAssetDigest, sig)
+	require.NoError(t, c.VerifyUpdateSignature(testBucket, PlatformTypeDarwin, "prod", "v2", publicKey))
+	require.Error(t, c.VerifyUpdateSignature(testBucket, PlatformTypeDarwin, "prod", "v2", otherKey))
+
+	// Tampered digest
+	putSignedUpdate(t, f, key, assetKey, "0"+signedAssetDigest[1:], sig)
+	require.Error(t, c.VerifyUpdateSignature(testBucket, PlatformTypeDarwin, "prod", "v2", publicKey))
+
+	// Tampered asset
+	tampered := "darwin-updates/Keybase-tampered.zip"
+	f.Put(testBucket, tampered, readTestdata(t, signedAssetFile)+"x", time.Now())
+	putSignedUpdate(t, f, key, tampered, "", sig)
+	require.Error(t, c.VerifyUpdateSignature(testBucket, PlatformTypeDarwin, "prod", "v2", publicKey))
+
+	// Missing asset
+	putSignedUpdate(t, f, key, "darwin-updates/missing.zip", signedAssetDigest, sig)
+	require.Error(t, c.VerifyUpdateSignature(testBucket, PlatformTypeDarwin, "prod", "v2", publicKey))
+
+	// Unsigned
+	putSignedUpdate(t, f, key, assetKey, signedAssetDigest, "")
+	require.Error(t, c.VerifyUpdateSignature(testBucket, PlatformTypeDarwin, "prod", "v2", publicKey))
+
+	// Missing update
+	require.Error(t, c.VerifyUpdateSignature(testBucket, PlatformTypeDarwin, "prod", "test-v2", publicKey))
+}
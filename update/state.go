@@ -0,0 +1,144 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/keybase/release/version"
+)
+
+// stateChannels are the channels always checked for each platform that
+// supports promoting a version, even if there's no bucket listing access
+var stateChannels = map[string][]string{
+	PlatformTypeDarwin:  {defaultChannel, "test-v2"},
+	PlatformTypeWindows: {defaultChannel, "test-v2"},
+}
+
+// servedChannels are the channels a platform's clients in an env might be
+// on: the default ones, the bucket config's, the rings', and any other with an
+// update JSON in the bucket. The base update JSON's is "".
+func (c *Client) servedChannels(bucketName string, platformName string, env string) ([]string, error) {
+	var channels []string
+	seen := map[string]bool{}
+	add := func(channel string) {
+		if !seen[channel] {
+			seen[channel] = true
+			channels = append(channels, channel)
+		}
+	}
+	for _, channel := range stateChannels[platformName] {
+		add(channel)
+	}
+	config, err := c.LoadBucketConfig(bucketName)
+	if err != nil {
+		return nil, err
+	}
+	add(config.Channel)
+	for _, ring := range c.rings() {
+		add(ring.channel())
+	}
+	namePrefix := strings.TrimSuffix(UpdateJSONName("", platformName, env), ".json")
+	objs, err := c.listAllObjects(bucketName, namePrefix)
+	if err != nil {
+		return nil, err
+	}
+	for _, obj := range objs {
+		rest := strings.TrimPrefix(aws.StringValue(obj.Key), namePrefix)
+		if !strings.HasSuffix(rest, ".json") {
+			continue
+		}
+		rest = strings.TrimSuffix(rest, ".json")
+		if rest == "" {
+			add("")
+		} else if strings.HasPrefix(rest, "-") {
+			add(strings.TrimPrefix(rest, "-"))
+		}
+	}
+	return channels, nil
+}
+
+// StateLock is a snapshot of the version every channel points to
+type StateLock struct {
+	Env     string           `json:"env"`
+	Entries []StateLockEntry `json:"entries"`
+}
+
+// StateLockEntry is the version a platform's channel points to
+type StateLockEntry struct {
+	Platform string `json:"platform"`
+	Channel  string `json:"channel"`
+	Version  string `json:"version"`
+	Commit   string `json:"commit,omitempty"`
+}
+
+// ReadStateLock decodes a lockfile written with WriteStateLock
+func ReadStateLock(r io.Reader) (*StateLock, error) {
+	var lock StateLock
+	if err := json.NewDecoder(r).Decode(&lock); err != nil {
+		return nil, err
+	}
+	return &lock, nil
+}
+
+// WriteStateLock encodes a lockfile
+func WriteStateLock(lock StateLock, w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(lock)
+}
+
+// ExportState returns the version each platform's served channels (see
+// servedChannels) currently point to. Channels without an update, and so
+// platforms without any, are left out.
+func (c *Client) ExportState(bucketName string, env string) (*StateLock, error) {
+	lock := StateLock{Env: env}
+	for _, platform := range platformsAll {
+		platformName := platform.Name
+		channels, err := c.servedChannels(bucketName, platformName, env)
+		if err != nil {
+			return nil, err
+		}
+		for _, channel := range channels {
+			upd, _, err := c.CurrentUpdate(bucketName, channel, platformName, env)
+			if isNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			_, _, _, commit, _ := version.Parse(upd.Version)
+			lock.Entries = append(lock.Entries, StateLockEntry{
+				Platform: platformName,
+				Channel:  channel,
+				Version:  upd.Version,
+				Commit:   commit,
+			})
+		}
+	}
+	return &lock, nil
+}
+
+// ImportState promotes versions so every channel in the lockfile points to
+// the version it had when exported, even if that is a downgrade.
+func (c *Client) ImportState(bucketName string, lock StateLock) error {
+	for _, entry := range lock.Entries {
+		upd, _, err := c.CurrentUpdate(bucketName, entry.Channel, entry.Platform, lock.Env)
+		if err != nil && !isNotFound(err) {
+			return err
+		}
+		if upd != nil && upd.Version == entry.Version {
+			c.logf(VerbosityVerbose, "%s %s is already at %s", entry.Platform, entry.Channel, entry.Version)
+			continue
+		}
+		c.logf(VerbosityNormal, "Promoting %s %s to %s", entry.Platform, entry.Channel, entry.Version)
+		if err := c.promoteSpecificVersion(bucketName, entry.Version, entry.Channel, entry.Platform, lock.Env, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportImportState(t *testing.T) {
+	f := newFakeS3()
+	older := "1.0.14-20160312013917+cd6f696"
+	newer := "1.0.15-20160313013917+ab12cd3"
+	seedDarwinRelease(f, older)
+	seedDarwinRelease(f, newer)
+	c := newTestClient(f)
+	require.NoError(t, c.PromoteSpecificVersion(testBucket, older, "v2", PlatformTypeDarwin, "prod", false))
+	require.NoError(t, c.PromoteSpecificVersion(testBucket, newer, "test-v2", PlatformTypeDarwin, "prod", false))
+	require.NoError(t, c.PromoteSpecificVersion(testBucket, newer, "nightly", PlatformTypeDarwin, "prod", false))
+	putUpdateJSON(f, testBucket, UpdateJSONName("v2", PlatformTypeWindows, "prod"), older)
+	putUpdateJSON(f, testBucket, UpdateJSONName("", platformLinuxDeb.Name, "prod"), newer)
+
+	lock, err := c.ExportState(testBucket, "prod")
+	require.NoError(t, err)
+	assert.Equal(t, []StateLockEntry{
+		{Platform: PlatformTypeDarwin, Channel: "v2", Version: older, Commit: "cd6f696"},
+		{Platform: PlatformTypeDarwin, Channel: "test-v2", Version: newer, Commit: "ab12cd3"},
+		{Platform: PlatformTypeDarwin, Channel: "nightly", Version: newer, Commit: "ab12cd3"},
+		{Platform: platformLinuxDeb.Name, Channel: "", Version: newer, Commit: "ab12cd3"},
+		{Platform: PlatformTypeWindows, Channel: "v2", Version: older, Commit: "cd6f696"},
+	}, lock.Entries)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteStateLock(*lock, &buf))
+	read, err := ReadStateLock(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, lock, read)
+
+	// Move v2 forward and test-v2 back, then restore from the lockfile
+	require.NoError(t, c.PromoteSpecificVersion(testBucket, newer, "v2", PlatformTypeDarwin, "prod", false))
+	require.NoError(t, c.PromoteSpecificVersion(testBucket, older, "test-v2", PlatformTypeDarwin, "prod", true))
+	require.NoError(t, c.ImportState(testBucket, *read))
+	assert.Equal(t, older, currentTestUpdate(t, c, "v2").Version)
+	assert.Equal(t, newer, currentTestUpdate(t, c, "test-v2").Version)
+}
@@ -0,0 +1,64 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/blang/semver"
+)
+
+// LatestStrategy is how CopyLatest picks the newest release from a listing
+type LatestStrategy int
+
+const (
+	// ByDate picks the release with the newest date (see ByRelease)
+	ByDate LatestStrategy = iota
+	// BySemver picks the release with the highest version, for when dates
+	// are skewed. Releases without a valid version are never picked.
+	BySemver
+)
+
+// findReleaseBySemver finds the matching release with the highest version
+func (c *Client) findReleaseBySemver(bucketName string, p Platform, f func(r Release) bool) (*Release, error) {
+	releases, err := c.listReleases(bucketName, p.Prefix, p.Suffix, 0)
+	if err != nil {
+		return nil, err
+	}
+	type versionedRelease struct {
+		release Release
+		version semver.Version
+	}
+	var versioned []versionedRelease
+	for _, release := range releases {
+		if !strings.HasSuffix(release.Key, p.Suffix) {
+			continue
+		}
+		ver, err := semver.Make(release.Version)
+		if err != nil {
+			continue
+		}
+		versioned = append(versioned, versionedRelease{release: release, version: ver})
+	}
+	sort.SliceStable(versioned, func(i, j int) bool {
+		return versioned[i].version.GT(versioned[j].version)
+	})
+	for _, v := range versioned {
+		if f(v.release) {
+			release := v.release
+			return &release, nil
+		}
+	}
+	return nil, nil
+}
+
+// findLatestRelease finds the newest matching release by the client's
+// LatestStrategy
+func (c *Client) findLatestRelease(bucketName string, p Platform, f func(r Release) bool) (*Release, error) {
+	if c.LatestStrategy == BySemver {
+		return c.findReleaseBySemver(bucketName, p, f)
+	}
+	return c.findRelease(bucketName, p, f)
+}
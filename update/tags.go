@@ -0,0 +1,22 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"fmt"
+)
+
+// PromoteByTag promotes the version built from a git tag, as mapped by
+// TagVersions, to a channel. The release for the version must exist.
+func (c *Client) PromoteByTag(bucketName string, tag string, channel string, platformName string, env string) error {
+	version, ok := c.TagVersions[tag]
+	if !ok {
+		return fmt.Errorf("Unknown tag %s", tag)
+	}
+	if version == "" {
+		return fmt.Errorf("No version for tag %s", tag)
+	}
+	c.logf(VerbosityVerbose, "Tag %s is version %s", tag, version)
+	return c.PromoteSpecificVersion(bucketName, version, channel, platformName, env, false)
+}
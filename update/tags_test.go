@@ -0,0 +1,33 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPromoteByTag(t *testing.T) {
+	f := newFakeS3()
+	version := "1.0.15-20160313013917+ab12cd3"
+	seedDarwinRelease(f, version)
+	c := newTestClient(f)
+	c.TagVersions = map[string]string{
+		"v1.0.15":  version,
+		"v1.0.16":  "1.0.16-20160314013917+ef01234",
+		"untagged": "",
+	}
+
+	require.NoError(t, c.PromoteByTag(testBucket, "v1.0.15", "v2", PlatformTypeDarwin, "prod"))
+	assert.Equal(t, version, currentTestUpdate(t, c, "v2").Version)
+
+	require.EqualError(t, c.PromoteByTag(testBucket, "v9.9.9", "v2", PlatformTypeDarwin, "prod"), "Unknown tag v9.9.9")
+	require.EqualError(t, c.PromoteByTag(testBucket, "untagged", "v2", PlatformTypeDarwin, "prod"), "No version for tag untagged")
+	err := c.PromoteByTag(testBucket, "v1.0.16", "v2", PlatformTypeDarwin, "prod")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "No release found")
+	assert.Equal(t, version, currentTestUpdate(t, c, "v2").Version)
+}
@@ -0,0 +1,154 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Default timeouts for each type of S3 request. Copies of big releases (to
+// another region, say) can take a while, so get much longer than listing.
+const (
+	defaultListTimeout = 30 * time.Second
+	defaultHeadTimeout = 10 * time.Second
+	defaultGetTimeout  = 30 * time.Second
+	defaultCopyTimeout = 5 * time.Minute
+)
+
+// OperationTimeouts are how long each type of S3 request can take. A zero
+// timeout uses the default.
+type OperationTimeouts struct {
+	// List is for listing objects and object versions (per page)
+	List time.Duration
+	// Head is for HEADs and reading ACLs
+	Head time.Duration
+	// Get is for reading objects, including the body
+	Get time.Duration
+	// Copy is for copies, and other writes (puts, deletes, ACLs)
+	Copy time.Duration
+}
+
+func timeoutOrDefault(timeout time.Duration, defaultTimeout time.Duration) time.Duration {
+	if timeout <= 0 {
+		return defaultTimeout
+	}
+	return timeout
+}
+
+// s3ContextAPI is the part of the S3 service timeoutS3 calls
+type s3ContextAPI interface {
+	ListObjectsWithContext(aws.Context, *s3.ListObjectsInput, ...request.Option) (*s3.ListObjectsOutput, error)
+	GetObjectWithContext(aws.Context, *s3.GetObjectInput, ...request.Option) (*s3.GetObjectOutput, error)
+	PutObjectWithContext(aws.Context, *s3.PutObjectInput, ...request.Option) (*s3.PutObjectOutput, error)
+	CopyObjectWithContext(aws.Context, *s3.CopyObjectInput, ...request.Option) (*s3.CopyObjectOutput, error)
+	DeleteObjectWithContext(aws.Context, *s3.DeleteObjectInput, ...request.Option) (*s3.DeleteObjectOutput, error)
+	HeadObjectWithContext(aws.Context, *s3.HeadObjectInput, ...request.Option) (*s3.HeadObjectOutput, error)
+	GetObjectAclWithContext(aws.Context, *s3.GetObjectAclInput, ...request.Option) (*s3.GetObjectAclOutput, error)
+	PutObjectAclWithContext(aws.Context, *s3.PutObjectAclInput, ...request.Option) (*s3.PutObjectAclOutput, error)
+	ListObjectVersionsWithContext(aws.Context, *s3.ListObjectVersionsInput, ...request.Option) (*s3.ListObjectVersionsOutput, error)
+}
+
+// timeoutS3 is the S3 service with the client's timeout for each type of
+// request, under the client's context
+type timeoutS3 struct {
+	svc    s3ContextAPI
+	client *Client
+}
+
+// parent is the client's context, or the background context if it has none
+func (t timeoutS3) parent() context.Context {
+	if t.client.Context != nil {
+		return t.client.Context
+	}
+	return aws.BackgroundContext()
+}
+
+func (t timeoutS3) context(timeout time.Duration) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(t.parent(), timeout)
+}
+
+func (t timeoutS3) timeouts() OperationTimeouts {
+	return t.client.Timeouts
+}
+
+func (t timeoutS3) ListObjects(input *s3.ListObjectsInput) (*s3.ListObjectsOutput, error) {
+	ctx, cancel := t.context(timeoutOrDefault(t.timeouts().List, defaultListTimeout))
+	defer cancel()
+	return t.svc.ListObjectsWithContext(ctx, input)
+}
+
+func (t timeoutS3) ListObjectVersions(input *s3.ListObjectVersionsInput) (*s3.ListObjectVersionsOutput, error) {
+	ctx, cancel := t.context(timeoutOrDefault(t.timeouts().List, defaultListTimeout))
+	defer cancel()
+	return t.svc.ListObjectVersionsWithContext(ctx, input)
+}
+
+// cancelOnClose cancels a request's context once its body is closed, since
+// the body is read after GetObject returns
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelOnClose) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
+func (t timeoutS3) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	ctx, cancel := t.context(timeoutOrDefault(t.timeouts().Get, defaultGetTimeout))
+	resp, err := t.svc.GetObjectWithContext(ctx, input)
+	if err != nil || resp.Body == nil {
+		cancel()
+		return resp, err
+	}
+	resp.Body = cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+func (t timeoutS3) HeadObject(input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+	ctx, cancel := t.context(timeoutOrDefault(t.timeouts().Head, defaultHeadTimeout))
+	defer cancel()
+	return t.svc.HeadObjectWithContext(ctx, input)
+}
+
+func (t timeoutS3) GetObjectAcl(input *s3.GetObjectAclInput) (*s3.GetObjectAclOutput, error) {
+	ctx, cancel := t.context(timeoutOrDefault(t.timeouts().Head, defaultHeadTimeout))
+	defer cancel()
+	return t.svc.GetObjectAclWithContext(ctx, input)
+}
+
+func (t timeoutS3) PutObjectAcl(input *s3.PutObjectAclInput) (*s3.PutObjectAclOutput, error) {
+	ctx, cancel := t.context(timeoutOrDefault(t.timeouts().Copy, defaultCopyTimeout))
+	defer cancel()
+	return t.svc.PutObjectAclWithContext(ctx, input)
+}
+
+func (t timeoutS3) CopyObject(input *s3.CopyObjectInput) (*s3.CopyObjectOutput, error) {
+	ctx, cancel := t.context(timeoutOrDefault(t.timeouts().Copy, defaultCopyTimeout))
+	defer cancel()
+	return t.svc.CopyObjectWithContext(ctx, input)
+}
+
+func (t timeoutS3) PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	return t.PutObjectWithContext(t.parent(), input)
+}
+
+func (t timeoutS3) PutObjectWithContext(parent aws.Context, input *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error) {
+	ctx, cancel := context.WithTimeout(parent, timeoutOrDefault(t.timeouts().Copy, defaultCopyTimeout))
+	defer cancel()
+	return t.svc.PutObjectWithContext(ctx, input, opts...)
+}
+
+func (t timeoutS3) DeleteObject(input *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error) {
+	ctx, cancel := t.context(timeoutOrDefault(t.timeouts().Copy, defaultCopyTimeout))
+	defer cancel()
+	return t.svc.DeleteObjectWithContext(ctx, input)
+}
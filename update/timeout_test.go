@@ -0,0 +1,80 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// slowS3 takes delay for HEADs and copies, unless the context is done first
+type slowS3 struct {
+	s3ContextAPI
+	delay time.Duration
+}
+
+func (s slowS3) wait(ctx aws.Context) error {
+	select {
+	case <-time.After(s.delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s slowS3) HeadObjectWithContext(ctx aws.Context, input *s3.HeadObjectInput, opts ...request.Option) (*s3.HeadObjectOutput, error) {
+	return &s3.HeadObjectOutput{}, s.wait(ctx)
+}
+
+func (s slowS3) CopyObjectWithContext(ctx aws.Context, input *s3.CopyObjectInput, opts ...request.Option) (*s3.CopyObjectOutput, error) {
+	return &s3.CopyObjectOutput{}, s.wait(ctx)
+}
+
+func (s slowS3) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return &s3.GetObjectOutput{Body: ioutil.NopCloser(strings.NewReader("body"))}, nil
+}
+
+func TestOperationTimeouts(t *testing.T) {
+	c := &Client{Timeouts: OperationTimeouts{Head: 10 * time.Millisecond, Copy: time.Second}}
+	svc := timeoutS3{svc: slowS3{delay: 100 * time.Millisecond}, client: c}
+
+	_, err := svc.HeadObject(&s3.HeadObjectInput{})
+	assert.Equal(t, context.DeadlineExceeded, err)
+	_, err = svc.CopyObject(&s3.CopyObjectInput{})
+	assert.NoError(t, err)
+
+	// The body can be read after GetObject returns
+	resp, err := svc.GetObject(&s3.GetObjectInput{})
+	require.NoError(t, err)
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "body", string(body))
+	require.NoError(t, resp.Body.Close())
+
+	// Under the client's context
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.Context = ctx
+	_, err = svc.CopyObject(&s3.CopyObjectInput{})
+	assert.Equal(t, context.Canceled, err)
+	_, err = svc.GetObject(&s3.GetObjectInput{})
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestTimeoutOrDefault(t *testing.T) {
+	assert.Equal(t, defaultCopyTimeout, timeoutOrDefault(0, defaultCopyTimeout))
+	assert.Equal(t, time.Minute, timeoutOrDefault(time.Minute, defaultCopyTimeout))
+}
@@ -0,0 +1,54 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeJSONMinimumFromVersion(t *testing.T) {
+	data, err := json.Marshal(Update{Version: "1.0.15", MinimumFromVersion: "1.0.12"})
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"minimumFromVersion":"1.0.12"`)
+	upd, err := DecodeJSON(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, "1.0.12", upd.MinimumFromVersion)
+
+	data, err = EncodeJSON("1.0.15-20160313013917+ab12cd3", "v1.0.15", "", nil, "", nil, "")
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "minimumFromVersion")
+	upd, err = DecodeJSON(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, "", upd.MinimumFromVersion)
+}
+
+func TestDecodeJSONRequired(t *testing.T) {
+	data, err := json.Marshal(Update{Version: "1.0.15", Required: true})
+	require.NoError(t, err)
+	upd, err := DecodeJSON(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.True(t, upd.Required)
+
+	data, err = json.Marshal(Update{Version: "1.0.15"})
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "required")
+}
+
+func TestDecodeJSONDelta(t *testing.T) {
+	delta := &Delta{FromVersion: "1.0.14", URL: "https://example.com/darwin/darwin-1.0.14-1.0.15.delta"}
+	data, err := json.Marshal(Update{Version: "1.0.15", Delta: delta})
+	require.NoError(t, err)
+	upd, err := DecodeJSON(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, delta, upd.Delta)
+
+	data, err = json.Marshal(Update{Version: "1.0.15"})
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "delta")
+}
@@ -0,0 +1,19 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package updatetest
+
+import (
+	"github.com/keybase/release/update/s3test"
+)
+
+// Bucket is an in-memory S3 store, with the calls an update.Client makes
+type Bucket = s3test.Bucket
+
+// Object is an object in a Bucket
+type Object = s3test.Object
+
+// NewBucket returns an empty Bucket
+func NewBucket() *Bucket {
+	return s3test.NewBucket()
+}
@@ -0,0 +1,178 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+// Package updatetest builds scenarios for testing promotions against an
+// in-memory bucket: seed releases and channel updates, run the update
+// package's operations, then check what changed.
+package updatetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/keybase/release/update"
+)
+
+// DefaultBucketName is the bucket a Harness uses
+const DefaultBucketName = "test-bucket"
+
+// Harness is a bucket and a Client using it, for a test
+type Harness struct {
+	t          testing.TB
+	BucketName string
+	S3         *Bucket
+	Client     *update.Client
+	// Env is the env of support JSONs and updates, prod by default
+	Env string
+	// Now is the time objects are added or modified at. It starts at the
+	// current time; use Advance to move it.
+	Now time.Time
+}
+
+// New returns a Harness with an empty bucket
+func New(t testing.TB) *Harness {
+	h := &Harness{
+		t:          t,
+		BucketName: DefaultBucketName,
+		S3:         NewBucket(),
+		Env:        "prod",
+		Now:        time.Now(),
+	}
+	h.S3.Now = func() time.Time { return h.Now }
+	h.Client = update.NewClientWithS3(h.S3)
+	return h
+}
+
+// Advance moves the harness clock forward
+func (h *Harness) Advance(d time.Duration) {
+	h.Now = h.Now.Add(d)
+}
+
+func (h *Harness) platform(platformName string) update.Platform {
+	platforms, err := update.Platforms("")
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	for _, platform := range platforms {
+		if platform.Name == platformName {
+			return platform
+		}
+	}
+	h.t.Fatalf("Platform %q is not a single platform", platformName)
+	return update.Platform{}
+}
+
+// releaseFileName is the name a platform's build of a version is uploaded
+// with
+func releaseFileName(platformName string, version string) (string, error) {
+	// Package names use dots for the date and commit separators
+	pkgVersion := strings.NewReplacer("-", ".", "+", ".").Replace(version)
+	if i := strings.Index(version, "-"); i >= 0 {
+		pkgVersion = version[:i] + "-" + pkgVersion[i+1:]
+	}
+	switch platformName {
+	case update.PlatformTypeDarwin:
+		return fmt.Sprintf("Keybase-%s.dmg", version), nil
+	case update.PlatformTypeWindows:
+		return fmt.Sprintf("Keybase_%s.amd64.msi", version), nil
+	case "deb":
+		return fmt.Sprintf("keybase_%s_amd64.deb", pkgVersion), nil
+	case "rpm":
+		return fmt.Sprintf("keybase-%s.x86_64.rpm", pkgVersion), nil
+	default:
+		return "", fmt.Errorf("Unsupported platform %s", platformName)
+	}
+}
+
+func (h *Harness) putUpdate(key string, version string) {
+	data, err := json.Marshal(update.Update{Version: version, Name: "v" + version})
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	h.S3.Put(h.BucketName, key, string(data), h.Now)
+}
+
+// AddRelease uploads a platform's build of a version (deb, rpm, darwin or
+// windows), and its versioned update JSON for platforms that have one. It
+// returns the release's key.
+func (h *Harness) AddRelease(platformName string, version string) string {
+	platform := h.platform(platformName)
+	name, err := releaseFileName(platform.Name, version)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	key := platform.Prefix + name
+	h.S3.Put(h.BucketName, key, platform.Name+" "+version, h.Now)
+	if platform.PrefixSupport != "" {
+		h.putUpdate(platform.PrefixSupport+update.SupportUpdateName(platform.Name, h.Env, version), version)
+	}
+	return key
+}
+
+// SeedCurrentUpdate sets the version a platform's channel is at
+func (h *Harness) SeedCurrentUpdate(channel string, platformName string, version string) {
+	h.putUpdate(update.UpdateJSONName(channel, platformName, h.Env), version)
+}
+
+// CurrentVersion returns the version a platform's channel is at, or "" if it
+// has no update
+func (h *Harness) CurrentVersion(channel string, platformName string) string {
+	if h.S3.Get(h.BucketName, update.UpdateJSONName(channel, platformName, h.Env)) == nil {
+		return ""
+	}
+	upd, _, err := h.Client.CurrentUpdate(h.BucketName, channel, platformName, h.Env)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	return upd.Version
+}
+
+// Promote runs PromoteReleaseWithOptions for a platform's channel
+func (h *Harness) Promote(channel string, platformName string, opts update.PromoteOptions) *update.PromoteResult {
+	result, err := h.Client.PromoteReleaseWithOptions(h.BucketName, channel, h.platform(platformName), h.Env, opts)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	return result
+}
+
+// CopyLatest runs CopyLatest for a platform (or all, if "")
+func (h *Harness) CopyLatest(platformName string) {
+	if err := h.Client.CopyLatest(h.BucketName, platformName, false); err != nil {
+		h.t.Fatal(err)
+	}
+}
+
+// Snapshot is the body of every object in the bucket, by key
+type Snapshot map[string]string
+
+// Snapshot returns the bucket's objects
+func (h *Harness) Snapshot() Snapshot {
+	snapshot := Snapshot{}
+	for _, key := range h.S3.Keys(h.BucketName) {
+		snapshot[key] = string(h.S3.Get(h.BucketName, key).Body)
+	}
+	return snapshot
+}
+
+// Changed returns the keys that were added, removed or modified between s and
+// after, sorted
+func (s Snapshot) Changed(after Snapshot) []string {
+	changed := []string{}
+	for key, body := range after {
+		if before, ok := s[key]; !ok || before != body {
+			changed = append(changed, key)
+		}
+	}
+	for key := range s {
+		if _, ok := after[key]; !ok {
+			changed = append(changed, key)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
@@ -0,0 +1,82 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package updatetest
+
+import (
+	"testing"
+
+	"github.com/keybase/release/update"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPromoteNewerRelease(t *testing.T) {
+	h := New(t)
+	h.AddRelease(update.PlatformTypeDarwin, "1.0.14-20160312013917+cd6f696")
+	h.AddRelease(update.PlatformTypeDarwin, "1.0.15-20160313013917+ab12cd3")
+	h.SeedCurrentUpdate("v2", update.PlatformTypeDarwin, "1.0.14-20160312013917+cd6f696")
+	before := h.Snapshot()
+
+	result := h.Promote("v2", update.PlatformTypeDarwin, update.PromoteOptions{})
+	assert.True(t, result.Promoted)
+	assert.Equal(t, "1.0.14-20160312013917+cd6f696", result.FromVersion)
+	assert.Equal(t, "1.0.15-20160313013917+ab12cd3", h.CurrentVersion("v2", update.PlatformTypeDarwin))
+	assert.Equal(t, []string{"update-darwin-prod-v2.json"}, before.Changed(h.Snapshot()))
+}
+
+func TestPromoteUnchangedWritesNothing(t *testing.T) {
+	h := New(t)
+	h.AddRelease(update.PlatformTypeWindows, "1.0.15-20160313013917+ab12cd3")
+	h.SeedCurrentUpdate("v2", update.PlatformTypeWindows, "1.0.15-20160313013917+ab12cd3")
+	before := h.Snapshot()
+
+	result := h.Promote("v2", update.PlatformTypeWindows, update.PromoteOptions{})
+	assert.False(t, result.Promoted)
+	assert.Equal(t, "unchanged", result.Reason)
+	assert.Empty(t, before.Changed(h.Snapshot()))
+}
+
+func TestPromoteThenCopyLatest(t *testing.T) {
+	h := New(t)
+	h.AddRelease(update.PlatformTypeDarwin, "1.0.15-20160313013917+ab12cd3")
+	assert.Equal(t, "", h.CurrentVersion("v2", update.PlatformTypeDarwin))
+
+	// CopyLatest copies what the v2 channel is at
+	result := h.Promote("v2", update.PlatformTypeDarwin, update.PromoteOptions{})
+	require.True(t, result.Promoted)
+	before := h.Snapshot()
+	h.CopyLatest(update.PlatformTypeDarwin)
+	assert.Equal(t, []string{"Keybase.dmg"}, before.Changed(h.Snapshot()))
+	assert.Equal(t, "darwin 1.0.15-20160313013917+ab12cd3", h.Snapshot()["Keybase.dmg"])
+}
+
+func TestCopyLatestLinux(t *testing.T) {
+	h := New(t)
+	key := h.AddRelease("deb", "1.0.15-20160313013917+ab12cd3")
+	assert.Equal(t, "linux_binaries/deb/keybase_1.0.15-20160313013917.ab12cd3_amd64.deb", key)
+	h.AddRelease("rpm", "1.0.15-20160313013917+ab12cd3")
+
+	h.CopyLatest(update.PlatformTypeLinux)
+	snapshot := h.Snapshot()
+	assert.Equal(t, "deb 1.0.15-20160313013917+ab12cd3", snapshot["keybase_amd64.deb"])
+	assert.Equal(t, "rpm 1.0.15-20160313013917+ab12cd3", snapshot["keybase_amd64.rpm"])
+}
+
+func TestPromoteSourceETag(t *testing.T) {
+	h := New(t)
+	version := "1.0.15-20160313013917+ab12cd3"
+	h.AddRelease(update.PlatformTypeDarwin, version)
+	supportKey := "darwin-support/" + update.SupportUpdateName(update.PlatformTypeDarwin, h.Env, version)
+	reviewed := h.S3.Get(h.BucketName, supportKey).ETag()
+
+	// Changed since it was reviewed
+	h.S3.Put(h.BucketName, supportKey, `{"version": "`+version+`", "name": "changed"}`, h.Now)
+	_, err := h.Client.PromoteReleaseWithOptions(h.BucketName, "v2", h.platform(update.PlatformTypeDarwin), h.Env, update.PromoteOptions{SourceETag: reviewed})
+	require.Error(t, err)
+	assert.Equal(t, "", h.CurrentVersion("v2", update.PlatformTypeDarwin))
+
+	result := h.Promote("v2", update.PlatformTypeDarwin, update.PromoteOptions{SourceETag: h.S3.Get(h.BucketName, supportKey).ETag()})
+	assert.True(t, result.Promoted)
+	assert.Equal(t, version, h.CurrentVersion("v2", update.PlatformTypeDarwin))
+}
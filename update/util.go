@@ -7,14 +7,31 @@ import (
 	"crypto/rand"
 	"encoding/base32"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
 )
 
+// normalizePrefix makes sure a non-empty prefix ends in a slash, so a prefix
+// of "darwin" and "darwin/" match the same keys and yield the same names.
+func normalizePrefix(prefix string) string {
+	if prefix == "" || strings.HasSuffix(prefix, "/") {
+		return prefix
+	}
+	return prefix + "/"
+}
+
 func urlStringForKey(key string, bucketName string, prefix string) (string, string) {
-	name := key[len(prefix):]
+	prefix = normalizePrefix(prefix)
+	name := strings.TrimPrefix(key, prefix)
 	return fmt.Sprintf("https://s3.amazonaws.com/%s/%s%s", bucketName, prefix, url.QueryEscape(name)), name
 }
 
@@ -22,7 +39,39 @@ func urlString(bucketName string, prefix string, name string) string {
 	if prefix == "" {
 		return fmt.Sprintf("https://s3.amazonaws.com/%s/%s", bucketName, url.QueryEscape(name))
 	}
-	return fmt.Sprintf("https://s3.amazonaws.com/%s/%s%s", bucketName, prefix, url.QueryEscape(name))
+	return fmt.Sprintf("https://s3.amazonaws.com/%s/%s%s", bucketName, normalizePrefix(prefix), url.QueryEscape(name))
+}
+
+// regionURLString is the URL for a key on S3 in the client's region. Outside
+// us-east-1 it's virtual-hosted (https://<bucket>.s3.<region>.amazonaws.com),
+// unless the bucket name has dots, which the S3 certificate doesn't cover, so
+// it's path-style on the regional host. Copy sources always use urlString.
+func (c *Client) regionURLString(bucketName string, prefix string, name string) string {
+	if c.Region == "" || c.Region == defaultRegion {
+		return urlString(bucketName, prefix, name)
+	}
+	key := normalizePrefix(prefix) + url.QueryEscape(name)
+	if strings.Contains(bucketName, ".") {
+		return fmt.Sprintf("https://s3.%s.amazonaws.com/%s/%s", c.Region, bucketName, key)
+	}
+	return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", bucketName, c.Region, key)
+}
+
+// publicURLForKey is the URL a key is downloaded from, on the PublicBaseURL
+// host if there is one. The name (after the last slash) is escaped, like for
+// the S3 URLs.
+func (c *Client) publicURLForKey(bucketName string, key string) string {
+	i := strings.LastIndex(key, "/")
+	prefix, name := key[:i+1], key[i+1:]
+	if c.PublicBaseURL == "" {
+		return c.regionURLString(bucketName, prefix, name)
+	}
+	return fmt.Sprintf("%s/%s%s", strings.TrimSuffix(c.PublicBaseURL, "/"), prefix, url.QueryEscape(name))
+}
+
+// LatestURL is the URL the latest release for a platform is downloaded from
+func (c *Client) LatestURL(bucketName string, platform Platform) string {
+	return c.publicURLForKey(bucketName, platform.LatestName)
 }
 
 func urlStringNoEscape(bucketName string, name string) string {
@@ -56,6 +105,39 @@ func fileExists(path string) (bool, error) {
 	return false, err
 }
 
+// writeFileAtomic writes data to a temp file next to path and renames it into
+// place, so a crash (or a failed write) never leaves a partial file at path
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	tmpPath := f.Name()
+	if _, err = f.Write(data); err == nil {
+		err = f.Chmod(perm)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// isNotFound returns true if the error is S3 saying there is no such key.
+// GETs fail with NoSuchKey, HEADs (which have no body) with NotFound.
+func isNotFound(err error) bool {
+	if aerr, ok := err.(awserr.Error); ok {
+		return aerr.Code() == s3.ErrCodeNoSuchKey || aerr.Code() == "NotFound"
+	}
+	return false
+}
+
 // CombineErrors returns a single error for multiple errors, or nil if none
 func CombineErrors(errs ...error) error {
 	errs = RemoveNilErrors(errs)
@@ -94,8 +176,41 @@ func RandomID() (string, error) {
 	return str, nil
 }
 
+// isEmptyListing returns true if a list error is how some S3 compatible
+// stores (MinIO, Ceph) respond to a prefix with no objects: not found, or an
+// empty body the SDK can't decode.
+func isEmptyListing(err error) bool {
+	if isNotFound(err) {
+		return true
+	}
+	if aerr, ok := err.(awserr.Error); ok {
+		return aerr.Code() == request.ErrCodeSerialization && aerr.OrigErr() == io.EOF
+	}
+	return false
+}
+
+// splitPrefixes splits a comma separated list of prefixes, trimming
+// whitespace, normalizing them (see normalizePrefix) and dropping empty and
+// duplicate entries, so "darwin/, deb," doesn't list " deb" or "" as
+// sections and "darwin" and "darwin/" are one.
+func splitPrefixes(prefixes string) []string {
+	var split []string
+	seen := map[string]bool{}
+	for _, prefix := range strings.Split(prefixes, ",") {
+		prefix = normalizePrefix(strings.TrimSpace(prefix))
+		if prefix == "" || seen[prefix] {
+			continue
+		}
+		seen[prefix] = true
+		split = append(split, prefix)
+	}
+	return split
+}
+
 var randRead = rand.Read
 
+var timeNow = time.Now
+
 // RandBytes returns random bytes of length
 func RandBytes(length int) ([]byte, error) {
 	buf := make([]byte, length)
@@ -0,0 +1,51 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+// missingVariants returns the names of the variants of a platform (see
+// Client.PlatformVariants) that have no release of version
+func (c *Client) missingVariants(bucketName string, platformName string, version string) ([]string, error) {
+	var missing []string
+	for _, variant := range c.PlatformVariants[platformName] {
+		if err := variant.Validate(); err != nil {
+			return nil, err
+		}
+		releases, err := c.ListReleases(bucketName, variant.Prefix, variant.Suffix)
+		if err != nil {
+			return nil, err
+		}
+		found := false
+		for _, release := range releases {
+			if release.Version == version {
+				found = true
+				break
+			}
+		}
+		if !found {
+			c.logf(VerbosityVerbose, "No %s release for %s", variant.Name, version)
+			missing = append(missing, variant.Name)
+		}
+	}
+	return missing, nil
+}
+
+// MissingVariants finds the newest release for a platform and returns its
+// version and the names of the configured variants that don't have a release
+// of that version, for example if only the amd64 build was uploaded. If there
+// is no release, the version is empty.
+func (c *Client) MissingVariants(bucketName string, platformName string) (string, []string, error) {
+	platform, err := platformForName(platformName)
+	if err != nil {
+		return "", nil, err
+	}
+	release, err := c.findRelease(bucketName, platform, func(r Release) bool { return true })
+	if err != nil || release == nil {
+		return "", nil, err
+	}
+	missing, err := c.missingVariants(bucketName, platform.Name, release.Version)
+	if err != nil {
+		return "", nil, err
+	}
+	return release.Version, missing, nil
+}
@@ -0,0 +1,61 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var platformDarwinArm64 = Platform{Name: "darwin-arm64", Prefix: "darwin-arm64/", Suffix: ".dmg", LatestName: "Keybase-arm64.dmg", Arch: ArchARM64}
+
+func TestMissingVariants(t *testing.T) {
+	f := newFakeS3()
+	older := "1.0.14-20160312013917+cd6f696"
+	newer := "1.0.15-20160313013917+ab12cd3"
+	seedDarwinRelease(f, older)
+	seedDarwinRelease(f, newer)
+	f.Put(testBucket, "darwin-arm64/Keybase-"+older+".dmg", "arm64", time.Now())
+	c := newTestClient(f)
+	c.PlatformVariants = map[string][]Platform{PlatformTypeDarwin: {platformDarwinArm64}}
+
+	version, missing, err := c.MissingVariants(testBucket, PlatformTypeDarwin)
+	require.NoError(t, err)
+	assert.Equal(t, newer, version)
+	assert.Equal(t, []string{"darwin-arm64"}, missing)
+
+	result, err := c.PromoteReleaseWithOptions(testBucket, "v2", platformDarwin, "prod", PromoteOptions{RequireVariants: true})
+	require.NoError(t, err)
+	assert.False(t, result.Promoted)
+	assert.Equal(t, "missing variants (darwin-arm64)", result.Reason)
+	assert.Nil(t, f.Get(testBucket, UpdateJSONName("v2", PlatformTypeDarwin, "prod")))
+
+	// Not checked unless required
+	result, err = c.PromoteReleaseWithOptions(testBucket, "test-v2", platformDarwin, "prod", PromoteOptions{})
+	require.NoError(t, err)
+	assert.True(t, result.Promoted)
+
+	f.Put(testBucket, "darwin-arm64/Keybase-"+newer+".dmg", "arm64", time.Now())
+	_, missing, err = c.MissingVariants(testBucket, PlatformTypeDarwin)
+	require.NoError(t, err)
+	assert.Empty(t, missing)
+	result, err = c.PromoteReleaseWithOptions(testBucket, "v2", platformDarwin, "prod", PromoteOptions{RequireVariants: true})
+	require.NoError(t, err)
+	assert.True(t, result.Promoted)
+}
+
+func TestMissingVariantsInvalidVariant(t *testing.T) {
+	f := newFakeS3()
+	seedDarwinRelease(f, "1.0.15-20160313013917+ab12cd3")
+	c := newTestClient(f)
+	mismatched := platformDarwinArm64
+	mismatched.LatestName = "Keybase-arm64.zip"
+	c.PlatformVariants = map[string][]Platform{PlatformTypeDarwin: {mismatched}}
+
+	_, _, err := c.MissingVariants(testBucket, PlatformTypeDarwin)
+	require.EqualError(t, err, "Platform darwin-arm64 has LatestName Keybase-arm64.zip that doesn't match suffix .dmg")
+}
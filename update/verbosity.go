@@ -0,0 +1,29 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import "log"
+
+// Verbosity is how much a Client logs. Package functions that don't take a
+// Client (like PromoteReleases) log as VerbosityNormal.
+type Verbosity int
+
+const (
+	// VerbosityQuiet only logs problems (releases or metadata that couldn't
+	// be read, failed listings)
+	VerbosityQuiet Verbosity = -1
+	// VerbosityNormal also logs what was done (copies, promotions, writes)
+	VerbosityNormal Verbosity = 0
+	// VerbosityVerbose also logs each release found and skipped
+	VerbosityVerbose Verbosity = 1
+	// VerbosityDebug also logs every check and page of a listing
+	VerbosityDebug Verbosity = 2
+)
+
+// logf logs if the client's verbosity is at least level
+func (c *Client) logf(level Verbosity, format string, args ...interface{}) {
+	if c.Verbosity >= level {
+		log.Printf(format, args...)
+	}
+}
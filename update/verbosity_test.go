@@ -0,0 +1,82 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func captureLog(f func()) string {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	f()
+	return buf.String()
+}
+
+func TestVerbosity(t *testing.T) {
+	f := newFakeS3()
+	f.Put(testBucket, "darwin/Keybase-1.0.15-20160313013917+ab12cd3.dmg", "dmg", time.Now())
+	f.Put(testBucket, "darwin/Keybase-invalid.dmg", "dmg", time.Now())
+	f.PageSize = 1
+	c := newTestClient(f)
+
+	listing := func() {
+		_, err := c.htmlSections(testBucket, "darwin/", "")
+		require.NoError(t, err)
+	}
+	for _, test := range []struct {
+		verbosity Verbosity
+		logged    []string
+		notLogged []string
+	}{
+		{VerbosityQuiet, []string{"Couldn't get version"}, []string{"Found 2 release(s)", "Keybase-1.0.15", "truncated"}},
+		{VerbosityNormal, []string{"Couldn't get version", "Found 2 release(s)"}, []string{"Keybase-1.0.15", "truncated"}},
+		{VerbosityVerbose, []string{"Found 2 release(s)", "Keybase-1.0.15-20160313013917+ab12cd3.dmg 1.0.15"}, []string{"truncated"}},
+		{VerbosityDebug, []string{"Found 2 release(s)", "Keybase-1.0.15", "truncated"}, nil},
+	} {
+		c.Verbosity = test.verbosity
+		out := captureLog(listing)
+		for _, s := range test.logged {
+			assert.Contains(t, out, s, "verbosity %d", test.verbosity)
+		}
+		for _, s := range test.notLogged {
+			assert.NotContains(t, out, s, "verbosity %d", test.verbosity)
+		}
+	}
+}
+
+func TestVerbosityPromotion(t *testing.T) {
+	for _, test := range []struct {
+		verbosity Verbosity
+		logged    []string
+		notLogged []string
+	}{
+		{VerbosityQuiet, nil, []string{"Finding release", "Found release", "PutCopying"}},
+		{VerbosityNormal, []string{"PutCopying"}, []string{"Finding release", "Found release"}},
+		{VerbosityVerbose, []string{"Finding release", "Found release", "PutCopying"}, nil},
+	} {
+		f := newFakeS3()
+		seedDarwinRelease(f, "1.0.15-20160313013917+ab12cd3")
+		c := newTestClient(f)
+		c.Verbosity = test.verbosity
+		out := captureLog(func() {
+			_, err := c.PromoteReleaseWithOptions(testBucket, "v2", platformDarwin, "prod", PromoteOptions{})
+			require.NoError(t, err)
+		})
+		for _, s := range test.logged {
+			assert.Contains(t, out, s, "verbosity %d", test.verbosity)
+		}
+		for _, s := range test.notLogged {
+			assert.NotContains(t, out, s, "verbosity %d", test.verbosity)
+		}
+	}
+}
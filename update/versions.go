@@ -0,0 +1,124 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"io/ioutil"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// unversionedID is the version id S3 gives objects written while versioning
+// was off
+const unversionedID = "null"
+
+// ObjectVersion is a version of an object in a bucket with versioning
+type ObjectVersion struct {
+	VersionID    string
+	Size         int64
+	LastModified time.Time
+	IsLatest     bool
+	// IsDeleteMarker is true if the object was deleted in this version
+	IsDeleteMarker bool
+}
+
+// ListObjectVersions returns the history of an object, newest first, so a
+// previous LatestName can be found after it's overwritten. Buckets without
+// versioning just have the current object, with version id "null".
+func (c *Client) ListObjectVersions(bucketName string, key string) ([]ObjectVersion, error) {
+	var versions []ObjectVersion
+	keyMarker, versionIDMarker := "", ""
+	for {
+		input := &s3.ListObjectVersionsInput{
+			Bucket: aws.String(bucketName),
+			Prefix: aws.String(key),
+		}
+		if keyMarker != "" {
+			input.KeyMarker = aws.String(keyMarker)
+			input.VersionIdMarker = aws.String(versionIDMarker)
+		}
+		resp, err := c.svc.ListObjectVersions(input)
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "NotImplemented" {
+			c.logf(VerbosityVerbose, "Versions aren't supported for %s, using current object", bucketName)
+			return c.currentObjectVersion(bucketName, key)
+		}
+		if err != nil {
+			return nil, err
+		}
+		// The prefix can match other keys
+		for _, v := range resp.Versions {
+			if aws.StringValue(v.Key) != key {
+				continue
+			}
+			versions = append(versions, ObjectVersion{
+				VersionID:    aws.StringValue(v.VersionId),
+				Size:         aws.Int64Value(v.Size),
+				LastModified: aws.TimeValue(v.LastModified),
+				IsLatest:     aws.BoolValue(v.IsLatest),
+			})
+		}
+		for _, m := range resp.DeleteMarkers {
+			if aws.StringValue(m.Key) != key {
+				continue
+			}
+			versions = append(versions, ObjectVersion{
+				VersionID:      aws.StringValue(m.VersionId),
+				LastModified:   aws.TimeValue(m.LastModified),
+				IsLatest:       aws.BoolValue(m.IsLatest),
+				IsDeleteMarker: true,
+			})
+		}
+		if !aws.BoolValue(resp.IsTruncated) {
+			break
+		}
+		keyMarker = aws.StringValue(resp.NextKeyMarker)
+		versionIDMarker = aws.StringValue(resp.NextVersionIdMarker)
+	}
+	sort.SliceStable(versions, func(i, j int) bool {
+		return versions[i].LastModified.After(versions[j].LastModified)
+	})
+	return versions, nil
+}
+
+// currentObjectVersion is the history for a store without versions, just the
+// current object (if any)
+func (c *Client) currentObjectVersion(bucketName string, key string) ([]ObjectVersion, error) {
+	head, err := c.svc.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(key),
+	})
+	if isNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []ObjectVersion{{
+		VersionID:    unversionedID,
+		Size:         aws.Int64Value(head.ContentLength),
+		LastModified: aws.TimeValue(head.LastModified),
+		IsLatest:     true,
+	}}, nil
+}
+
+// GetObjectVersion returns the contents of a version of an object
+func (c *Client) GetObjectVersion(bucketName string, key string, versionID string) ([]byte, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(key),
+	}
+	if versionID != unversionedID {
+		input.VersionId = aws.String(versionID)
+	}
+	resp, err := c.svc.GetObject(input)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	return ioutil.ReadAll(resp.Body)
+}
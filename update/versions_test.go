@@ -0,0 +1,65 @@
+// Copyright 2015 Keybase, Inc. All rights reserved. Use of
+// this source code is governed by the included BSD license.
+
+package update
+
+import (
+	"testing"
+	"time"
+
+	"github.com/keybase/release/update/s3test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListObjectVersions(t *testing.T) {
+	f := newFakeS3()
+	published := time.Date(2016, 3, 13, 12, 0, 0, 0, time.UTC)
+	f.Put(testBucket, "Keybase.dmg", "new dmg", published.Add(time.Hour))
+	f.ObjectVersions = map[string][]s3test.Version{
+		"Keybase.dmg": {
+			{ID: "v1", Body: "old dmg", LastModified: published},
+			{ID: "v2", Body: "new dmg", LastModified: published.Add(time.Hour)},
+		},
+		"Keybase.dmg.old": {
+			{ID: "x1", Body: "other", LastModified: published},
+		},
+	}
+	c := newTestClient(f)
+
+	versions, err := c.ListObjectVersions(testBucket, "Keybase.dmg")
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	assert.Equal(t, ObjectVersion{VersionID: "v2", Size: 7, LastModified: published.Add(time.Hour), IsLatest: true}, versions[0])
+	assert.Equal(t, "v1", versions[1].VersionID)
+	assert.False(t, versions[1].IsLatest)
+
+	body, err := c.GetObjectVersion(testBucket, "Keybase.dmg", "v1")
+	require.NoError(t, err)
+	assert.Equal(t, "old dmg", string(body))
+}
+
+func TestListObjectVersionsUnversioned(t *testing.T) {
+	f := newFakeS3()
+	f.Put(testBucket, "Keybase.dmg", "dmg", time.Now())
+	c := newTestClient(f)
+
+	versions, err := c.ListObjectVersions(testBucket, "Keybase.dmg")
+	require.NoError(t, err)
+	require.Len(t, versions, 1)
+	assert.Equal(t, "null", versions[0].VersionID)
+	body, err := c.GetObjectVersion(testBucket, "Keybase.dmg", versions[0].VersionID)
+	require.NoError(t, err)
+	assert.Equal(t, "dmg", string(body))
+
+	// Stores without the versions API
+	f.VersionsNotImplemented = true
+	versions, err = c.ListObjectVersions(testBucket, "Keybase.dmg")
+	require.NoError(t, err)
+	require.Len(t, versions, 1)
+	assert.Equal(t, "null", versions[0].VersionID)
+	assert.Equal(t, int64(3), versions[0].Size)
+	versions, err = c.ListObjectVersions(testBucket, "Missing.dmg")
+	require.NoError(t, err)
+	assert.Empty(t, versions)
+}
@@ -6,12 +6,52 @@ package version
 import (
 	"fmt"
 	"regexp"
+	"strings"
 	"time"
+	"unicode"
 )
 
-// Parse parses version, time and commit info from string
+// defaultDateLayout is the layout of the date in names, like 20160312013917
+const defaultDateLayout = "20060102150405"
+
+// commitRegex matches a (possibly abbreviated) git commit hash
+var commitRegex = regexp.MustCompile(`^[0-9a-fA-F]{7,40}$`)
+
+// Parser parses names with the date in a specific layout
+type Parser struct {
+	// DateLayout is the time layout of the date in names (as for time.Parse),
+	// for example 2006-01-02T150405. If it's empty, the date is the digits
+	// between the version and the commit, as 20060102150405.
+	DateLayout string
+}
+
+// Parse parses version, time and commit info from string. The time in the
+// string is assumed to be UTC. If the commit isn't a 7 to 40 character hex
+// hash, it's left empty (the version still has it).
 func Parse(name string) (version string, versionShort string, t time.Time, commit string, err error) {
-	versionRegex := regexp.MustCompile(`(\d+\.\d+\.\d+)[-.](\d+)[+.]([[:alnum:]]+)`)
+	return ParseInLocation(name, time.UTC)
+}
+
+// ParseInLocation is like Parse but interprets the time in the string as
+// being in the given location.
+func ParseInLocation(name string, loc *time.Location) (version string, versionShort string, t time.Time, commit string, err error) {
+	return Parser{}.ParseInLocation(name, loc)
+}
+
+// Parse is like the package Parse, with the parser's date layout
+func (p Parser) Parse(name string) (version string, versionShort string, t time.Time, commit string, err error) {
+	return p.ParseInLocation(name, time.UTC)
+}
+
+// ParseInLocation is like the package ParseInLocation, with the parser's date
+// layout. Unlike the default, a date that doesn't parse with the layout is an
+// error.
+func (p Parser) ParseInLocation(name string, loc *time.Location) (version string, versionShort string, t time.Time, commit string, err error) {
+	datePattern := `\d+`
+	if p.DateLayout != "" {
+		datePattern = layoutPattern(p.DateLayout)
+	}
+	versionRegex := regexp.MustCompile(`(\d+\.\d+\.\d+)[-.](` + datePattern + `)[+.]([[:alnum:]]+)`)
 	parts := versionRegex.FindAllStringSubmatch(name, -1)
 	if len(parts) == 0 || len(parts[0]) < 4 {
 		err = fmt.Errorf("Unable to parse: %s", name)
@@ -21,6 +61,55 @@ func Parse(name string) (version string, versionShort string, t time.Time, commi
 	date := parts[0][2]
 	commit = parts[0][3]
 	version = fmt.Sprintf("%s-%s+%s", versionShort, date, commit)
-	t, _ = time.Parse("20060102150405", date)
+	if !commitRegex.MatchString(commit) {
+		commit = ""
+	}
+	if p.DateLayout == "" {
+		t, _ = time.ParseInLocation(defaultDateLayout, date, loc)
+		return
+	}
+	t, err = time.ParseInLocation(p.DateLayout, date, loc)
+	if err != nil {
+		err = fmt.Errorf("Unable to parse date %s in %s with layout %s: %s", date, name, p.DateLayout, err)
+	}
 	return
 }
+
+// Validate checks a release name parses the way release listings parse it,
+// with a version, a valid date and a valid commit, so a naming mistake can be
+// caught before it's uploaded
+func Validate(name string) error {
+	return Parser{}.Validate(name)
+}
+
+// Validate is like the package Validate, with the parser's date layout
+func (p Parser) Validate(name string) error {
+	_, _, t, commit, err := p.Parse(name)
+	if err != nil {
+		return err
+	}
+	if t.IsZero() {
+		return fmt.Errorf("Invalid date in %s, expected it like %s", name, defaultDateLayout)
+	}
+	if commit == "" {
+		return fmt.Errorf("Invalid commit in %s, expected a 7 to 40 character hex hash", name)
+	}
+	return nil
+}
+
+// layoutPattern is a regex matching dates in a time layout: a digit for each
+// digit, letters (month and day names) for letters, the rest as is
+func layoutPattern(layout string) string {
+	var pattern strings.Builder
+	for _, r := range layout {
+		switch {
+		case unicode.IsDigit(r):
+			pattern.WriteString(`\d`)
+		case unicode.IsLetter(r):
+			pattern.WriteString(`[[:alpha:]]`)
+		default:
+			pattern.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	return pattern.String()
+}
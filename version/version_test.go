@@ -28,3 +28,130 @@ func TestParse(t *testing.T) {
 		t.Errorf("Failed to parse commit properly: %s", commit)
 	}
 }
+
+func TestParseCommit(t *testing.T) {
+	cases := []struct {
+		name   string
+		commit string
+	}{
+		{"Keybase-1.0.14-20160312013917+cd6f696.zip", "cd6f696"},
+		{"Keybase-1.0.14-20160312013917+cd6f696ab12cd34ef56ab12cd34ef56ab12cd34e.zip", "cd6f696ab12cd34ef56ab12cd34ef56ab12cd34e"},
+		// Too short
+		{"Keybase-1.0.14-20160312013917+cd6f69.zip", ""},
+		// Too long
+		{"Keybase-1.0.14-20160312013917+cd6f696ab12cd34ef56ab12cd34ef56ab12cd34ef5.zip", ""},
+		// Not hex
+		{"Keybase-1.0.14-20160312013917+release1.zip", ""},
+	}
+	for _, c := range cases {
+		version, _, _, commit, err := Parse(c.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if commit != c.commit {
+			t.Errorf("Wrong commit for %s: %q, expected %q", c.name, commit, c.commit)
+		}
+		if version == "" {
+			t.Errorf("No version for %s", c.name)
+		}
+	}
+}
+
+func TestParseInLocation(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, versionTime, _, err := ParseInLocation("Keybase-1.0.14-20160312013917+cd6f696.zip", loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if versionTime.Location() != loc {
+		t.Errorf("Wrong location: %s", versionTime.Location())
+	}
+	if versionTime.Format("2006-01-02 15:04:05") != "2016-03-12 01:39:17" {
+		t.Errorf("Failed to parse time properly: %s", versionTime)
+	}
+}
+
+func TestParserDateLayout(t *testing.T) {
+	p := Parser{DateLayout: "2006-01-02T150405"}
+	version, versionShort, versionTime, commit, err := p.Parse("Keybase-1.0.14-2016-03-12T013917+cd6f696.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != "1.0.14-2016-03-12T013917+cd6f696" || versionShort != "1.0.14" || commit != "cd6f696" {
+		t.Errorf("Failed to parse version properly: %s %s %s", version, versionShort, commit)
+	}
+	if versionTime != time.Date(2016, 3, 12, 1, 39, 17, 0, time.UTC) {
+		t.Errorf("Failed to parse time properly: %s", versionTime)
+	}
+
+	// The default layout doesn't match it
+	if _, _, _, _, err = Parse("Keybase-1.0.14-2016-03-12T013917+cd6f696.zip"); err == nil {
+		t.Error("Expected an error with the default layout")
+	}
+	// Nor does the custom layout match the default
+	if _, _, _, _, err = p.Parse("Keybase-1.0.14-20160312013917+cd6f696.zip"); err == nil {
+		t.Error("Expected an error with the custom layout")
+	}
+	// Dates that match the layout's shape but not its values are an error
+	if _, _, _, _, err = p.Parse("Keybase-1.0.14-2016-13-12T013917+cd6f696.zip"); err == nil {
+		t.Error("Expected an error for month 13")
+	}
+}
+
+func TestParserMonthName(t *testing.T) {
+	p := Parser{DateLayout: "02Jan2006.1504"}
+	_, _, versionTime, _, err := p.ParseInLocation("keybase_1.0.14-12Mar2016.0139+cd6f696_amd64.deb", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if versionTime != time.Date(2016, 3, 12, 1, 39, 0, 0, time.UTC) {
+		t.Errorf("Failed to parse time properly: %s", versionTime)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := []string{
+		"Keybase-1.0.14-20160312013917+cd6f696.dmg",
+		"Keybase-1.0.14-20160312013917+cd6f696.zip",
+		"keybase_1.0.14-20160312013917.cd6f696_amd64.deb",
+		"keybase-1.0.14.20160312013917.cd6f696-1.x86_64.rpm",
+		"Keybase_1.0.14-20160312013917+cd6f696.amd64.msi",
+	}
+	for _, name := range valid {
+		if err := Validate(name); err != nil {
+			t.Errorf("Expected %s to be valid: %s", name, err)
+		}
+	}
+
+	invalid := []string{
+		// No version
+		"Keybase.dmg",
+		"keybase_amd64.deb",
+		// No commit
+		"Keybase_1.0.14-20160312013917.amd64.msi",
+		// Not a date
+		"Keybase-1.0.14-20161312013917+cd6f696.dmg",
+		"keybase-1.0.14.2016031201.cd6f696-1.x86_64.rpm",
+		// Not a commit
+		"keybase_1.0.14-20160312013917.cd6f69_amd64.deb",
+		"Keybase-1.0.14-20160312013917+release.zip",
+	}
+	for _, name := range invalid {
+		if err := Validate(name); err == nil {
+			t.Errorf("Expected %s to be invalid", name)
+		}
+	}
+}
+
+func TestParserValidate(t *testing.T) {
+	p := Parser{DateLayout: "2006-01-02T150405"}
+	if err := p.Validate("Keybase-1.0.14-2016-03-12T013917+cd6f696.dmg"); err != nil {
+		t.Error(err)
+	}
+	if err := p.Validate("Keybase-1.0.14-20160312013917+cd6f696.dmg"); err == nil {
+		t.Error("Expected an error with the custom layout")
+	}
+}